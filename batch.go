@@ -0,0 +1,189 @@
+package sendria
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// scanPageSize is the page size used to scan the whole inbox
+const scanPageSize = 100
+
+// BatchOption is a functional option for batch calls
+type BatchOption func(*batchOptions)
+
+// batchOptions collects the options of a batch call
+type batchOptions struct {
+	concurrency int
+}
+
+// WithConcurrency sets how many requests of a batch call run in parallel. It
+// defaults to the MaxIdleConnsPerHost of the transport, so that connections
+// are reused instead of opened for every request; a higher concurrency opens
+// additional connections.
+func WithConcurrency(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.concurrency = n
+	}
+}
+
+// MessageResult is the outcome of fetching one message in a batch
+type MessageResult struct {
+	ID      string
+	Message *models.Message
+	Err     error
+}
+
+// DeleteResult is the outcome of deleting one message in a batch
+type DeleteResult struct {
+	ID  string
+	Err error
+}
+
+// GetMessages fetches the messages with the given IDs in parallel. The
+// results are in the order of ids. The returned error joins the errors of
+// all failed items and is nil if every message was fetched.
+func (c *Client) GetMessages(ctx context.Context, ids []string, opts ...BatchOption) ([]MessageResult, error) {
+	messages := make([]*models.Message, len(ids))
+	errs := c.runBatch(ctx, len(ids), opts, func(ctx context.Context, i int) error {
+		var err error
+		messages[i], err = c.GetMessageContext(ctx, ids[i])
+		return err
+	})
+
+	results := make([]MessageResult, len(ids))
+	for i, err := range errs {
+		results[i] = MessageResult{ID: ids[i], Message: messages[i], Err: err}
+	}
+	return results, joinItemErrors(ids, errs)
+}
+
+// DeleteMessages deletes the messages with the given IDs in parallel. The
+// results are in the order of ids. The returned error joins the errors of
+// all failed items and is nil if every message was deleted.
+func (c *Client) DeleteMessages(ctx context.Context, ids []string, opts ...BatchOption) ([]DeleteResult, error) {
+	errs := c.runBatch(ctx, len(ids), opts, func(ctx context.Context, i int) error {
+		return c.DeleteMessageContext(ctx, ids[i])
+	})
+
+	results := make([]DeleteResult, len(ids))
+	for i, err := range errs {
+		results[i] = DeleteResult{ID: ids[i], Err: err}
+	}
+	return results, joinItemErrors(ids, errs)
+}
+
+// DeleteWhere deletes all messages for which match returns true, e.g. the
+// emails of one test in a shared inbox. Messages are listed with their
+// sources, so match may inspect headers and parts.
+func (c *Client) DeleteWhere(ctx context.Context, match func(msg *models.Message) bool, opts ...BatchOption) ([]DeleteResult, error) {
+	var ids []string
+	err := c.eachMessage(ctx, func(msg *models.Message) error {
+		if match(msg) {
+			ids = append(ids, msg.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.DeleteMessages(ctx, ids, opts...)
+}
+
+// runBatch calls fn for the indexes 0 to n-1 with bounded concurrency and
+// returns the error of every item. Items that did not start before the
+// context ended fail with the context error.
+func (c *Client) runBatch(ctx context.Context, n int, opts []BatchOption, fn func(ctx context.Context, i int) error) []error {
+	options := batchOptions{concurrency: c.maxConns}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.concurrency <= 0 {
+		options.concurrency = c.maxConns
+	}
+	if options.concurrency <= 0 {
+		options.concurrency = 1
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, options.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// joinItemErrors joins the errors of failed batch items, prefixed by their ID
+func joinItemErrors(ids []string, errs []error) error {
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("message %s: %w", ids[i], err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// eachMessage calls fn for every message in the inbox, newest first. Pages
+// are fetched without computing totals, which would cost a request per page.
+// The scan follows the reported number of pages, as the server may serve
+// fewer messages per page than requested.
+func (c *Client) eachMessage(ctx context.Context, fn func(msg *models.Message) error) error {
+	seen := 0
+	for page := 1; ; page++ {
+		apiMessages, meta, err := c.fetchList(ctx, page, scanPageSize)
+		if err != nil {
+			return err
+		}
+
+		messages := c.toMessages(ctx, apiMessages, listOptions{})
+		for i := range messages {
+			if err := fn(&messages[i]); err != nil {
+				return err
+			}
+		}
+		seen += len(messages)
+
+		if !hasNextPage(page, seen, len(messages), meta) {
+			return nil
+		}
+	}
+}
+
+// hasNextPage reports whether a scan continues after page, given the number
+// of messages seen so far and on this page
+func hasNextPage(page, seen, count int, meta *models.APIMeta) bool {
+	switch {
+	case meta == nil || count == 0:
+		// Servers without meta return every message on each page
+		return false
+	case meta.PagesTotal > 0:
+		if meta.Page > 0 {
+			page = meta.Page
+		}
+		return page < meta.PagesTotal
+	case meta.Total > 0:
+		return seen < meta.Total
+	default:
+		return count >= scanPageSize
+	}
+}
@@ -0,0 +1,160 @@
+package sendria
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+func TestGetMessages(t *testing.T) {
+	t.Parallel()
+
+	var active, maxSeen atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := active.Add(1); n > maxSeen.Load() {
+			maxSeen.Store(n)
+		}
+		defer active.Add(-1)
+		time.Sleep(5 * time.Millisecond)
+
+		id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/messages/"), ".json"))
+		if id < 1 || id > 20 {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := json.Marshal(models.APIMessage{ID: id})
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	ids := []string{"5", "3", "404", "12", "1", "7", "9", "2", "20", "15", "11", "4"}
+	results, err := client.GetMessages(context.Background(), ids, WithConcurrency(4))
+	if err == nil || !strings.Contains(err.Error(), "message 404") {
+		t.Errorf("expected joined error for message 404, got %v", err)
+	}
+
+	for i, result := range results {
+		if result.ID != ids[i] {
+			t.Errorf("result %d: expected ID %s, got %s", i, ids[i], result.ID)
+		}
+		if ids[i] == "404" {
+			if result.Err == nil || result.Message != nil {
+				t.Errorf("expected error for message 404, got %+v", result)
+			}
+			continue
+		}
+		if result.Err != nil || result.Message == nil || result.Message.ID != ids[i] {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	if got := maxSeen.Load(); got > 4 {
+		t.Errorf("expected at most 4 concurrent requests, got %d", got)
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts []BatchOption
+		want int32
+	}{
+		{"defaults to the idle connections per host", nil, 2},
+		{"explicit concurrency above the idle connections", []BatchOption{WithConcurrency(5)}, 5},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var active, maxSeen atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for seen := maxSeen.Load(); n > seen && !maxSeen.CompareAndSwap(seen, n); seen = maxSeen.Load() {
+				}
+				time.Sleep(20 * time.Millisecond)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, WithTransport(&http.Transport{MaxIdleConnsPerHost: 2}))
+			ids := make([]string, 20)
+			for i := range ids {
+				ids[i] = strconv.Itoa(i + 1)
+			}
+			if _, err := client.DeleteMessages(context.Background(), ids, tt.opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := maxSeen.Load(); got != tt.want {
+				t.Errorf("expected %d concurrent requests, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDeleteMessages(t *testing.T) {
+	t.Parallel()
+
+	// The server caps pages at 10 messages, fewer than the scan requests
+	const total, maxPerPage = 25, 10
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/messages/"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var apiMessages []models.APIMessage
+		for id := (page-1)*maxPerPage + 1; id <= page*maxPerPage && id <= total; id++ {
+			apiMessages = append(apiMessages, models.APIMessage{ID: id, Subject: "Message " + strconv.Itoa(id)})
+		}
+		data, _ := json.Marshal(apiMessages)
+		meta := &models.APIMeta{PagesTotal: (total + maxPerPage - 1) / maxPerPage}
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data, Meta: meta}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := client.DeleteMessages(ctx, []string{"1", "2"})
+	if err == nil || results[0].Err == nil || results[1].Err == nil {
+		t.Errorf("expected context errors, got %+v", results)
+	}
+
+	results, err = client.DeleteWhere(context.Background(), func(msg *Message) bool {
+		return strings.HasSuffix(msg.Subject, "0")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "10" || results[1].ID != "20" {
+		t.Errorf("expected messages 10 and 20 on all pages to be deleted, got %+v", results)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("expected 2 delete requests, got %v", deleted)
+	}
+}
@@ -0,0 +1,287 @@
+package sendria
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// cacheMaxEntrySize is the largest response body kept in the cache. Larger
+// sources and attachments are always fetched from the server.
+const cacheMaxEntrySize = 4 << 20
+
+// WithCache enables a client-side LRU cache of responses whose bodies take up
+// to maxBytes in total. Captured messages are immutable, so each
+// representation of a message (json, plain, html, source, eml and
+// attachments) is fetched only once. Entries are dropped when the message is
+// deleted through this client or a delete event arrives on Subscribe. List
+// calls are revalidated with If-None-Match when the server sends an ETag.
+func WithCache(maxBytes int) Option {
+	return func(c *Client) {
+		if maxBytes > 0 {
+			c.cache = newResponseCache(maxBytes)
+		}
+	}
+}
+
+// cacheKey identifies a cached response
+type cacheKey struct {
+	// id is the message ID, or empty for list calls
+	id string
+	// representation is the path suffix after the ID, e.g. ".plain" or
+	// "/parts/logo", or the path and query of list calls
+	representation string
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	key    cacheKey
+	header http.Header
+	body   []byte
+	etag   string
+}
+
+// responseCache is an LRU cache of response bodies bounded by their total
+// size
+type responseCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List
+	entries  map[cacheKey]*list.Element
+}
+
+func newResponseCache(maxBytes int) *responseCache {
+	return &responseCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+	}
+}
+
+// maxEntrySize returns the largest body the cache keeps
+func (rc *responseCache) maxEntrySize() int {
+	if rc.maxBytes < cacheMaxEntrySize {
+		return rc.maxBytes
+	}
+	return cacheMaxEntrySize
+}
+
+// get returns the entry for key and marks it as recently used
+func (rc *responseCache) get(key cacheKey) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.order.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// put stores an entry, evicting the least recently used ones until the
+// bodies fit into the size limit
+func (rc *responseCache) put(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if len(entry.body) > rc.maxBytes {
+		return
+	}
+	if el, ok := rc.entries[entry.key]; ok {
+		rc.remove(el)
+	}
+
+	rc.entries[entry.key] = rc.order.PushFront(entry)
+	rc.size += len(entry.body)
+	for rc.size > rc.maxBytes {
+		rc.remove(rc.order.Back())
+	}
+}
+
+// remove drops an element; the caller holds the lock
+func (rc *responseCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	rc.order.Remove(el)
+	delete(rc.entries, entry.key)
+	rc.size -= len(entry.body)
+}
+
+// invalidate drops all representations of a message and all lists
+func (rc *responseCache) invalidate(id string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for key, el := range rc.entries {
+		if key.id == id || key.id == "" {
+			rc.remove(el)
+		}
+	}
+}
+
+// purge drops all entries
+func (rc *responseCache) purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.order.Init()
+	rc.entries = make(map[cacheKey]*list.Element)
+	rc.size = 0
+}
+
+// len returns the number of entries
+func (rc *responseCache) len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.order.Len()
+}
+
+// cacheKeyOf returns the cache key of a request path. IDs are empty for the
+// message list, ok is false for paths that are not cached.
+func cacheKeyOf(req *http.Request) (key cacheKey, ok bool) {
+	rest, found := strings.CutPrefix(req.URL.Path, "/api/messages/")
+	if !found {
+		return cacheKey{}, false
+	}
+	if rest == "" {
+		return cacheKey{representation: req.URL.RequestURI()}, true
+	}
+
+	end := strings.IndexAny(rest, "./")
+	if end < 0 {
+		return cacheKey{id: rest}, true
+	}
+	return cacheKey{id: rest[:end], representation: rest[end:]}, true
+}
+
+// cachingTransport serves repeated GET requests for messages from the cache
+// and invalidates it on successful deletes
+type cachingTransport struct {
+	next  http.RoundTripper
+	cache *responseCache
+}
+
+// RoundTrip serves the request from the cache or the next round tripper
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, cacheable := cacheKeyOf(req)
+	if !cacheable {
+		return t.next.RoundTrip(req)
+	}
+
+	if req.Method == http.MethodDelete {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return resp, err
+		}
+		if key.id == "" {
+			t.cache.purge()
+		} else {
+			t.cache.invalidate(key.id)
+		}
+		return resp, nil
+	}
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	entry, hit := t.cache.get(key)
+	if hit && key.id != "" {
+		return cachedResponse(req, entry), nil
+	}
+
+	// Lists change, so they are only reused after revalidation
+	if hit && entry.etag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if hit && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return cachedResponse(req, entry), nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode == http.StatusOK && (key.id != "" || etag != "") {
+		resp.Body = &cachingBody{
+			ReadCloser: resp.Body,
+			cache:      t.cache,
+			entry:      &cacheEntry{key: key, header: resp.Header.Clone(), etag: etag},
+			length:     resp.ContentLength,
+			tooLarge:   resp.ContentLength > int64(t.cache.maxEntrySize()),
+		}
+	}
+	return resp, nil
+}
+
+// cachedResponse builds a response from a cache entry
+func cachedResponse(req *http.Request, entry *cacheEntry) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(entry.body)),
+		ContentLength: int64(len(entry.body)),
+		Request:       req,
+	}
+}
+
+// cachingBody records a response body and stores it in the cache once it was
+// read completely
+type cachingBody struct {
+	io.ReadCloser
+	cache *responseCache
+	entry *cacheEntry
+	buf   bytes.Buffer
+	// length is the Content-Length, or -1 if unknown
+	length   int64
+	tooLarge bool
+	stored   bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.tooLarge {
+		if b.buf.Len()+n > b.cache.maxEntrySize() {
+			b.tooLarge = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.store()
+	}
+	return n, err
+}
+
+// Close closes the body without reading the rest, so that closing a stream
+// early stays cheap. A body read up to its Content-Length is still cached.
+func (b *cachingBody) Close() error {
+	if b.length >= 0 && int64(b.buf.Len()) == b.length {
+		b.store()
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *cachingBody) store() {
+	if b.stored || b.tooLarge {
+		return
+	}
+	b.stored = true
+	b.entry.body = append([]byte(nil), b.buf.Bytes()...)
+	b.cache.put(b.entry)
+}
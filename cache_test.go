@@ -0,0 +1,212 @@
+package sendria
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	count := func(key string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return counts[key]
+	}
+	deleteStatus := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts[r.Method+" "+r.URL.Path]++
+		status := deleteStatus
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(status)
+		case r.URL.Path == "/api/messages/1.json":
+			data, _ := json.Marshal(models.APIMessage{ID: 1, Subject: "Hi"})
+			if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data}); err != nil {
+				t.Errorf("failed to encode response: %v", err)
+			}
+		case r.URL.Path == "/api/messages/1.plain":
+			_, _ = w.Write([]byte("Hello"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCache(1<<20))
+	for i := 0; i < 3; i++ {
+		if plain, err := client.GetMessagePlain("1"); err != nil || plain != "Hello" {
+			t.Fatalf("unexpected plain %q, %v", plain, err)
+		}
+		if msg, err := client.GetMessage("1"); err != nil || msg.Subject != "Hi" {
+			t.Fatalf("unexpected message %+v, %v", msg, err)
+		}
+	}
+	if n := count("GET /api/messages/1.plain"); n != 1 {
+		t.Errorf("expected 1 plain request, got %d", n)
+	}
+	if n := count("GET /api/messages/1.json"); n != 1 {
+		t.Errorf("expected 1 json request, got %d", n)
+	}
+
+	if _, err := client.GetMessagePlain("404"); err == nil {
+		t.Error("expected error for missing message")
+	}
+	if _, err := client.GetMessagePlain("404"); err == nil || count("GET /api/messages/404.plain") != 2 {
+		t.Error("expected errors not to be cached")
+	}
+
+	// A failed delete keeps the message and its cached responses
+	if err := client.DeleteMessage("1"); err == nil {
+		t.Fatal("expected the delete to fail")
+	}
+	if _, err := client.GetMessagePlain("1"); err != nil || count("GET /api/messages/1.plain") != 1 {
+		t.Errorf("expected a failed delete to keep the cache, got %d requests, %v", count("GET /api/messages/1.plain"), err)
+	}
+
+	mu.Lock()
+	deleteStatus = http.StatusNoContent
+	mu.Unlock()
+	if err := client.DeleteMessage("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.GetMessagePlain("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := count("GET /api/messages/1.plain"); n != 2 {
+		t.Errorf("expected the delete to invalidate the cache, got %d requests", n)
+	}
+
+	client.invalidateCache(Event{Type: EventDeleteMessages})
+	if n := client.cache.len(); n != 0 {
+		t.Errorf("expected delete event to purge the cache, got %d entries", n)
+	}
+}
+
+func TestCacheRevalidatesLists(t *testing.T) {
+	t.Parallel()
+
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		data, _ := json.Marshal([]models.APIMessage{{ID: 1, Subject: "Hi"}})
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCache(1<<20))
+	for i := 0; i < 3; i++ {
+		list, err := client.ListMessagesContext(context.Background(), 1, 10)
+		if err != nil || len(list.Messages) != 1 {
+			t.Fatalf("unexpected list %+v, %v", list, err)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected every list call to revalidate, got %d requests", requests)
+	}
+	if notModified != 2 {
+		t.Errorf("expected 2 not modified responses, got %d", notModified)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	entry := func(id string, size int) *cacheEntry {
+		return &cacheEntry{key: cacheKey{id: id, representation: ".json"}, body: make([]byte, size)}
+	}
+	cache := newResponseCache(100)
+	cache.put(entry("1", 40))
+	cache.put(entry("2", 40))
+	cache.get(cacheKey{id: "1", representation: ".json"})
+	cache.put(entry("3", 40))
+
+	if _, ok := cache.get(cacheKey{id: "2", representation: ".json"}); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.get(cacheKey{id: "1", representation: ".json"}); !ok {
+		t.Error("expected the recently used entry to be kept")
+	}
+
+	cache.put(entry("4", 101))
+	if _, ok := cache.get(cacheKey{id: "4", representation: ".json"}); ok || cache.len() != 2 {
+		t.Errorf("expected a body over the size limit not to be cached, got %d entries", cache.len())
+	}
+	cache.put(entry("1", 90))
+	if cache.len() != 1 || cache.size != 90 {
+		t.Errorf("expected replacing an entry to evict by size, got %d entries of %d bytes", cache.len(), cache.size)
+	}
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestCachingBodyCloseDoesNotDrain(t *testing.T) {
+	t.Parallel()
+
+	cache := newResponseCache(1 << 20)
+	source := &countingReader{r: strings.NewReader(strings.Repeat("x", 64<<10))}
+	body := &cachingBody{
+		ReadCloser: io.NopCloser(source),
+		cache:      cache,
+		entry:      &cacheEntry{key: cacheKey{id: "1", representation: ".source"}},
+		length:     -1,
+	}
+
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(body, buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source.n > 4<<10 {
+		t.Errorf("expected Close not to read the rest of the body, read %d bytes", source.n)
+	}
+	if cache.len() != 0 {
+		t.Error("expected a partially read body not to be cached")
+	}
+
+	complete := &cachingBody{
+		ReadCloser: io.NopCloser(strings.NewReader("Hello\n")),
+		cache:      cache,
+		entry:      &cacheEntry{key: cacheKey{id: "1", representation: ".plain"}},
+		length:     6,
+	}
+	if _, err := io.ReadFull(complete, make([]byte, 6)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := complete.Close(); err != nil || cache.len() != 1 {
+		t.Errorf("expected a body read up to its length to be cached, got %d entries, %v", cache.len(), err)
+	}
+}
@@ -0,0 +1,168 @@
+package sendria
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// inviteSource is an invite as sent by Outlook, with a Windows TZID that is
+// only defined by its VTIMEZONE
+const inviteSource = "From: organizer@example.com\r\nTo: jane@example.org, bob@example.org\r\n" +
+	"Subject: Planning\r\nMIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"B\"\r\n\r\n" +
+	"--B\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nYou are invited.\r\n" +
+	"--B\r\nContent-Type: text/calendar; charset=utf-8; method=REQUEST\r\nContent-Transfer-Encoding: 7bit\r\n\r\n" +
+	"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN\r\nMETHOD:REQUEST\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n" +
+	"BEGIN:STANDARD\r\nDTSTART:16010101T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\nEND:STANDARD\r\n" +
+	"BEGIN:DAYLIGHT\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\nEND:DAYLIGHT\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\nUID:040000008200E00074C5B7101A82E008\r\nSEQUENCE:2\r\n" +
+	"ORGANIZER;CN=\"Org, The\":mailto:organizer@example.com\r\n" +
+	"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=Jane Doe:mailto:\r\n jane@example.org\r\n" +
+	"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=ACCEPTED;CN=Bob:MAILTO:bob@example.org\r\n" +
+	"SUMMARY:Planning\\, Q3\r\nLOCATION:Room 1\\; 2nd floor\r\nDESCRIPTION:Agenda:\\nBudget\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20260413T100000\r\n" +
+	"DTEND;TZID=W. Europe Standard Time:20260413T110000\r\n" +
+	"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20261231T235959Z\r\n" +
+	"STATUS:CONFIRMED\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:040000008200E00074C5B7101A82E008\r\nRECURRENCE-ID:20260415T080000Z\r\n" +
+	"DTSTART:20260415T090000Z\r\nDTEND:20260415T100000Z\r\nSUMMARY:Moved\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n" +
+	"--B--\r\n"
+
+func TestCalendarInvite(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(inviteSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	invite, err := msg.CalendarInvite()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if invite.Method != models.MethodRequest || invite.IsCancellation() {
+		t.Errorf("unexpected method %q", invite.Method)
+	}
+	if invite.UID != "040000008200E00074C5B7101A82E008" || invite.Sequence != 2 {
+		t.Errorf("unexpected UID %q, sequence %d", invite.UID, invite.Sequence)
+	}
+	if invite.Summary != "Planning, Q3" || invite.Location != "Room 1; 2nd floor" || invite.Description != "Agenda:\nBudget" {
+		t.Errorf("unexpected text %q, %q, %q", invite.Summary, invite.Location, invite.Description)
+	}
+	if invite.Organizer != (models.Recipient{Name: "Org, The", Email: "organizer@example.com"}) {
+		t.Errorf("unexpected organizer %+v", invite.Organizer)
+	}
+
+	jane, ok := invite.Attendee("JANE@example.org")
+	if !ok || jane != (models.Attendee{Name: "Jane Doe", Email: "jane@example.org", Role: "REQ-PARTICIPANT", PartStat: "NEEDS-ACTION", RSVP: true}) {
+		t.Errorf("unexpected attendee %+v", jane)
+	}
+	bob, ok := invite.Attendee("bob@example.org")
+	if !ok || bob.Role != "OPT-PARTICIPANT" || bob.PartStat != "ACCEPTED" || bob.RSVP {
+		t.Errorf("unexpected attendee %+v", bob)
+	}
+
+	// Daylight saving time applies in April
+	wantStart := time.Date(2026, 4, 13, 8, 0, 0, 0, time.UTC)
+	if !invite.Start.Equal(wantStart) || !invite.End.Equal(wantStart.Add(time.Hour)) {
+		t.Errorf("unexpected times %s - %s", invite.Start, invite.End)
+	}
+	if invite.TimeZone != "W. Europe Standard Time" || invite.AllDay {
+		t.Errorf("unexpected time zone %q, all day %v", invite.TimeZone, invite.AllDay)
+	}
+
+	if len(invite.RecurrenceRules) != 1 {
+		t.Fatalf("expected 1 recurrence rule, got %d", len(invite.RecurrenceRules))
+	}
+	rule := invite.RecurrenceRules[0]
+	if rule.Freq != "WEEKLY" || rule.Interval != 2 || len(rule.ByDay) != 2 ||
+		!rule.Until.Equal(time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+}
+
+func TestParseCalendarInvite(t *testing.T) {
+	t.Parallel()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	calendar := func(event string) []byte {
+		return []byte("BEGIN:VCALENDAR\nVERSION:2.0\nMETHOD:CANCEL\nBEGIN:VEVENT\nUID:e-1\n" + event + "END:VEVENT\nEND:VCALENDAR\n")
+	}
+
+	tests := []struct {
+		name      string
+		event     string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantAll   bool
+	}{
+		{
+			name:      "IANA TZID in winter",
+			event:     "DTSTART;TZID=Europe/Berlin:20261201T090000\nDTEND;TZID=Europe/Berlin:20261201T093000\n",
+			wantStart: time.Date(2026, 12, 1, 9, 0, 0, 0, berlin),
+			wantEnd:   time.Date(2026, 12, 1, 9, 30, 0, 0, berlin),
+		},
+		{
+			name:      "UTC with duration",
+			event:     "DTSTART:20260601T120000Z\nDURATION:PT1H30M\n",
+			wantStart: time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 6, 1, 13, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "all day",
+			event:     "DTSTART;VALUE=DATE:20260601\n",
+			wantStart: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC),
+			wantAll:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			invite, err := models.ParseCalendarInvite(calendar(tt.event))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !invite.IsCancellation() {
+				t.Errorf("expected a cancellation, got method %q", invite.Method)
+			}
+			if !invite.Start.Equal(tt.wantStart) || !invite.End.Equal(tt.wantEnd) || invite.AllDay != tt.wantAll {
+				t.Errorf("got %s - %s (all day %v), want %s - %s", invite.Start, invite.End, invite.AllDay, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+
+	if _, err := models.ParseCalendarInvite(calendar("DTSTART;TZID=Mars/Olympus:20260601T120000\n")); err == nil {
+		t.Error("expected an error for an unknown TZID")
+	}
+}
+
+func TestCalendarInviteMissing(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(bounceSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	if _, err := msg.CalendarInvite(); !errors.Is(err, models.ErrNoCalendarInvite) {
+		t.Errorf("expected ErrNoCalendarInvite, got %v", err)
+	}
+}
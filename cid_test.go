@@ -0,0 +1,76 @@
+package sendria
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// newsletterSource references one existing image twice, a missing one, and
+// carries an inline image the HTML never uses
+const newsletterSource = "From: news@example.com\r\nSubject: News\r\n" +
+	"Content-Type: multipart/related; boundary=rel\r\n\r\n" +
+	"--rel\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+	"<img src=\"cid:logo%40example.com\"><td background='CID:logo@example.com'>" +
+	"<div style=\"background:url(cid:hero@example.com)\"></div>\r\n" +
+	"--rel\r\nContent-Type: image/png\r\nContent-ID: <logo@example.com>\r\nContent-Transfer-Encoding: base64\r\n\r\niVBORw==\r\n" +
+	"--rel\r\nContent-Type: image/gif\r\nContent-ID: <spacer@example.com>\r\nContent-Disposition: inline\r\n\r\nGIF89a\r\n" +
+	"--rel\r\nContent-Type: application/pdf\r\nContent-ID: <terms@example.com>\r\nContent-Disposition: attachment; filename=terms.pdf\r\n\r\n%PDF\r\n" +
+	"--rel--\r\n"
+
+func TestResolveCIDs(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(newsletterSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	r, err := msg.ResolveCIDs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(r.References) != 3 {
+		t.Fatalf("expected 3 references, got %+v", r.References)
+	}
+	logo := msg.MIME.FindByContentID("logo@example.com")
+	for _, ref := range r.References[:2] {
+		if ref.CID != "logo@example.com" || ref.Part != logo {
+			t.Errorf("expected a reference to the logo, got %+v", ref)
+		}
+	}
+	if len(r.Broken) != 1 || r.Broken[0].CID != "hero@example.com" {
+		t.Errorf("expected the hero image to be broken, got %+v", r.Broken)
+	}
+	if len(r.Orphans) != 1 || r.Orphans[0].ContentID != "spacer@example.com" {
+		t.Errorf("expected the spacer to be an orphan, got %+v", r.Orphans)
+	}
+
+	inline := r.InlineHTML()
+	if strings.Count(inline, "data:image/png;base64,iVBORw==") != 2 || !strings.Contains(inline, "url(cid:hero@example.com)") {
+		t.Errorf("unexpected inline HTML %q", inline)
+	}
+
+	linked := r.LinkedHTML("http://localhost:1080/", "7")
+	if !strings.Contains(linked, `src="http://localhost:1080/api/messages/7/parts/logo@example.com"`) {
+		t.Errorf("unexpected linked HTML %q", linked)
+	}
+}
+
+func TestResolveCIDsWithoutHTML(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource("Subject: plain\r\nContent-Type: text/plain\r\n\r\nHello", discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	if _, err := msg.ResolveCIDs(); !errors.Is(err, models.ErrNoHTMLBody) {
+		t.Errorf("expected ErrNoHTMLBody, got %v", err)
+	}
+}
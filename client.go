@@ -5,12 +5,17 @@
 package sendria
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/enthus-golang/sendria/models"
@@ -20,8 +25,25 @@ import (
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	baseClient *http.Client
+	transport  http.RoundTripper
+	timeout    *time.Duration
 	username   string
 	password   string
+	token      string
+	userAgent  string
+	headers    http.Header
+	tlsConfig  *tls.Config
+	middleware []Middleware
+	logger     *slog.Logger
+	hooks      []MessageHook
+	lenient    bool
+	keys       *models.SecurityKeys
+	maxConns   int
+	cache      *responseCache
+	smtpAddr   *string
+	infoMu     sync.Mutex
+	info       *ServerInfo
 }
 
 
@@ -39,7 +61,134 @@ func WithBasicAuth(username, password string) Option {
 // WithTimeout sets the HTTP client timeout
 func WithTimeout(timeout time.Duration) Option {
 	return func(c *Client) {
-		c.httpClient.Timeout = timeout
+		c.timeout = &timeout
+	}
+}
+
+// WithHTTPClient uses a copy of the given HTTP client instead of the default
+// one. Options that change the client, such as WithTimeout, apply to the copy
+// in any order.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.baseClient = httpClient
+	}
+}
+
+// WithTransport sets the round tripper that performs the requests, e.g. an
+// *http.Transport with a corporate proxy
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// ErrTLSConfigUnsupported is returned by every request of a client whose TLS
+// configuration cannot be applied, as its transport is not an *http.Transport
+var ErrTLSConfigUnsupported = errors.New("sendria: WithTLSConfig requires an *http.Transport")
+
+// WithTLSConfig sets the TLS configuration, e.g. for mTLS or a private CA. It
+// requires the transport to be an *http.Transport; with any other transport
+// every request fails with ErrTLSConfigUnsupported.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithHeader adds a header to every request
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = http.Header{}
+		}
+		c.headers.Add(key, value)
+	}
+}
+
+// WithBearerToken authenticates every request with the given bearer token.
+// It takes precedence over WithBasicAuth.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// MessageHook is called with the context of the call for every message that
+// ListMessages or GetMessage return. Listed messages parse their MIME source
+// lazily, so hooks read the parsed content through GetParts, GetAttachments
+// or GetMIME, or through OnPartsLoaded to leave the parse to the caller.
+type MessageHook func(ctx context.Context, msg *models.Message)
+
+// WithMessageHook adds a hook that observes every parsed message, e.g. to
+// record metrics
+func WithMessageHook(hook MessageHook) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, hook)
+	}
+}
+
+// WithLenientParsing parses malformed MIME sources as far as possible instead
+// of failing: missing or duplicate boundaries, bare LFs, 8-bit headers,
+// broken base64 padding and truncated messages are recovered from and
+// recorded in Message.Warnings
+func WithLenientParsing() Option {
+	return func(c *Client) {
+		c.lenient = true
+	}
+}
+
+// WithSecurityKeys verifies S/MIME and PGP/MIME signatures and decrypts
+// encrypted messages with the given trust roots and keys. Signed and
+// encrypted messages are detected without keys, but their signers are not
+// trusted and their content stays encrypted.
+func WithSecurityKeys(keys *models.SecurityKeys) Option {
+	return func(c *Client) {
+		c.keys = keys
+	}
+}
+
+// parseSource parses the MIME source of the message with the given ID in the
+// parsing mode of the client
+func (c *Client) parseSource(source, id string) (*models.ParsedSource, error) {
+	p := &mimeParser{logger: c.Logger().With("message_id", id), lenient: c.lenient, keys: c.keys}
+	parsed, err := p.parse(source)
+	if c.lenient {
+		return parsed, nil
+	}
+	return parsed, err
+}
+
+// runHooks calls the message hooks for msg
+func (c *Client) runHooks(ctx context.Context, msg *models.Message) {
+	for _, hook := range c.hooks {
+		hook(ctx, msg)
+	}
+}
+
+// Middleware wraps the round tripper of the client, e.g. to add request IDs,
+// log or retry requests
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware adds middleware that every request passes through. The
+// middleware added first is the outermost and sees the request first.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
 	}
 }
 
@@ -49,38 +198,116 @@ func NewClient(baseURL string, opts ...Option) *Client {
 		baseURL = "http://localhost:1080"
 	}
 
-	client := &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		},
-	}
+	client := &Client{baseURL: baseURL}
 
-	// Apply all options
+	// Apply all options, then build the HTTP client from them, so that their
+	// order does not matter
 	for _, opt := range opts {
 		opt(client)
 	}
+	client.buildHTTPClient()
+	client.buildTransport()
 
 	return client
 }
 
+// buildHTTPClient copies the configured HTTP client, or creates the default
+// one, and sets the configured transport and timeout
+func (c *Client) buildHTTPClient() {
+	c.httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	if c.baseClient != nil {
+		copied := *c.baseClient
+		c.httpClient = &copied
+	}
+	if c.transport != nil {
+		c.httpClient.Transport = c.transport
+	}
+	if c.timeout != nil {
+		c.httpClient.Timeout = *c.timeout
+	}
+}
 
-// doRequest performs an HTTP request with optional basic auth
-func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, c.baseURL+path, body)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+// buildTransport applies the TLS configuration and request logging, records
+// the connection limit and wraps the transport in the middleware chain and
+// the cache
+func (c *Client) buildTransport() {
+	transport := c.httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if c.tlsConfig != nil {
+		if t, ok := transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.TLSClientConfig = c.tlsConfig
+			transport = t
+		} else {
+			// Fail every request rather than silently skip the TLS config
+			err := fmt.Errorf("%w: transport is %T", ErrTLSConfigUnsupported, transport)
+			transport = RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+				return nil, err
+			})
+		}
+	}
+
+	// Batch calls stay within the idle connections kept per host, so that
+	// their connections are reused
+	c.maxConns = http.DefaultMaxIdleConnsPerHost
+	if t, ok := transport.(*http.Transport); ok && t.MaxIdleConnsPerHost > 0 {
+		c.maxConns = t.MaxIdleConnsPerHost
+	}
+
+	if c.logger != nil {
+		transport = &loggingTransport{next: transport, logger: c.logger}
+	}
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		transport = c.middleware[i](transport)
 	}
 
-	if c.username != "" && c.password != "" {
+	// Cache hits skip the middleware, as no request is made
+	if c.cache != nil {
+		transport = &cachingTransport{next: transport, cache: c.cache}
+	}
+	c.httpClient.Transport = transport
+}
+
+// setHeaders sets the authentication and configured headers of a request
+func (c *Client) setHeaders(req *http.Request) {
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "" && c.password != "":
 		req.SetBasicAuth(c.username, c.password)
 	}
 
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for key, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+}
+
+
+// doRequest performs an HTTP request with the configured authentication and
+// headers
+func (c *Client) doRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	c.setHeaders(req)
+
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -93,8 +320,80 @@ func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response,
 	return resp, nil
 }
 
-// ListMessages retrieves a paginated list of messages
-func (c *Client) ListMessages(page, perPage int) (*models.MessageList, error) {
+// decodeJSON reads the whole body, so that a cached response is complete, and
+// decodes it into v
+func decodeJSON(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ListOption is a functional option for listing messages
+type ListOption func(*listOptions)
+
+// listOptions collects the options of a list call
+type listOptions struct {
+	skipSources bool
+	exactTotal  bool
+}
+
+// WithoutSources drops the raw sources of listed messages, so they are
+// neither kept in memory nor parsed. Use GetMessage for the full content.
+func WithoutSources() ListOption {
+	return func(o *listOptions) {
+		o.skipSources = true
+	}
+}
+
+// WithExactTotal makes Total exact on every page. If the server only reports
+// the number of pages, this costs a request for the last page, and for the
+// first page if the page size is not known.
+func WithExactTotal() ListOption {
+	return func(o *listOptions) {
+		o.exactTotal = true
+	}
+}
+
+// ListMessages retrieves a paginated list of messages. Parts and attachments
+// are parsed from the source on first access through GetParts or
+// GetAttachments; a malformed message records its ParseError instead of
+// failing the list. See ListMessagesContext for Total.
+func (c *Client) ListMessages(page, perPage int, opts ...ListOption) (*models.MessageList, error) {
+	return c.ListMessagesContext(context.Background(), page, perPage, opts...)
+}
+
+// ListMessagesContext retrieves a paginated list of messages using the given
+// context. A page or perPage of 0 uses the server default. Total is the
+// reported message count or, if the server only reports the number of pages,
+// is computed on the last page. On other pages it is unknown, see
+// TotalKnown, unless WithExactTotal is given.
+func (c *Client) ListMessagesContext(ctx context.Context, page, perPage int, opts ...ListOption) (*models.MessageList, error) {
+	var options listOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	apiMessages, meta, err := c.fetchList(ctx, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	messageList, err := c.paginate(ctx, page, perPage, len(apiMessages), meta, options.exactTotal)
+	if err != nil {
+		return nil, err
+	}
+	messageList.Messages = c.toMessages(ctx, apiMessages, options)
+	messageList.SetPageLoader(func(ctx context.Context, page int) (*models.MessageList, error) {
+		return c.ListMessagesContext(ctx, page, messageList.PerPage, opts...)
+	})
+
+	return messageList, nil
+}
+
+// fetchList retrieves one page of the message list as returned by the API
+func (c *Client) fetchList(ctx context.Context, page, perPage int) ([]models.APIMessage, *models.APIMeta, error) {
 	params := url.Values{}
 	if page > 0 {
 		params.Set("page", strconv.Itoa(page))
@@ -108,48 +407,51 @@ func (c *Client) ListMessages(page, perPage int) (*models.MessageList, error) {
 		path += "?" + params.Encode()
 	}
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	var apiResp models.APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+	if err := decodeJSON(resp.Body, &apiResp); err != nil {
+		return nil, nil, fmt.Errorf("decoding response: %w", err)
 	}
 
 	if apiResp.Code != "OK" {
-		return nil, fmt.Errorf("API error: %s", apiResp.Code)
+		return nil, nil, fmt.Errorf("API error: %s", apiResp.Code)
 	}
 
 	// Decode the messages from the data field
 	var apiMessages []models.APIMessage
 	if err := json.Unmarshal(apiResp.Data, &apiMessages); err != nil {
-		return nil, fmt.Errorf("decoding messages: %w", err)
+		return nil, nil, fmt.Errorf("decoding messages: %w", err)
 	}
+	return apiMessages, apiResp.Meta, nil
+}
 
-	// Convert API messages to our Message format
+// toMessages converts listed API messages to our Message format
+func (c *Client) toMessages(ctx context.Context, apiMessages []models.APIMessage, options listOptions) []models.Message {
 	messages := make([]models.Message, len(apiMessages))
 	for i, apiMsg := range apiMessages {
 		// Parse created_at time
 		createdAt, _ := time.Parse("2006-01-02T15:04:05", apiMsg.CreatedAt)
-		
+
 		// Convert recipients
 		to := make([]models.Recipient, 0)
 		for _, email := range apiMsg.RecipientsMessageTo {
 			to = append(to, models.Recipient{Email: email})
 		}
-		
+
 		// Convert sender
 		from := []models.Recipient{{Email: apiMsg.SenderMessage}}
-		
+
 		messages[i] = models.Message{
 			ID:        strconv.Itoa(apiMsg.ID),
 			Subject:   apiMsg.Subject,
@@ -161,37 +463,39 @@ func (c *Client) ListMessages(page, perPage int) (*models.MessageList, error) {
 			Source:    apiMsg.Source,
 		}
 
-		// Parse MIME message to extract parts and attachments
-		if apiMsg.Source != "" {
-			parts, attachments, err := parseMIMEMessage(apiMsg.Source)
-			if err != nil {
-				return nil, fmt.Errorf("parsing MIME message for ID %d: %w", apiMsg.ID, err)
-			}
-			messages[i].Parts = parts
-			messages[i].Attachments = attachments
+		// Defer parsing the MIME message until its parts are accessed
+		if options.skipSources {
+			messages[i].Source = ""
+		} else if apiMsg.Source != "" {
+			c.deferParse(&messages[i])
 		}
+		c.runHooks(ctx, &messages[i])
 	}
+	return messages
+}
 
-	// Create message list
-	messageList := &models.MessageList{
-		Messages: messages,
-		Total:    len(messages),
-		Page:     page,
-		PerPage:  perPage,
-	}
-	
-	if apiResp.Meta != nil {
-		messageList.Total = apiResp.Meta.PagesTotal * perPage // Approximate
-	}
-
-	return messageList, nil
+// deferParse sets up lazy parsing of the parts and attachments of msg
+func (c *Client) deferParse(msg *models.Message) {
+	source, id := msg.Source, msg.ID
+	msg.SetPartsLoader(func() (*models.ParsedSource, error) {
+		parsed, err := c.parseSource(source, id)
+		if err != nil {
+			return nil, fmt.Errorf("parsing MIME message for ID %s: %w", id, err)
+		}
+		return parsed, nil
+	})
 }
 
 // GetMessage retrieves a specific message by ID
 func (c *Client) GetMessage(id string) (*models.Message, error) {
+	return c.GetMessageContext(context.Background(), id)
+}
+
+// GetMessageContext retrieves a specific message by ID using the given context
+func (c *Client) GetMessageContext(ctx context.Context, id string) (*models.Message, error) {
 	path := fmt.Sprintf("/api/messages/%s.json", id)
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -204,7 +508,7 @@ func (c *Client) GetMessage(id string) (*models.Message, error) {
 	}
 
 	var apiResp models.APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+	if err := decodeJSON(resp.Body, &apiResp); err != nil {
 		return nil, fmt.Errorf("decoding response: %w", err)
 	}
 
@@ -243,22 +547,31 @@ func (c *Client) GetMessage(id string) (*models.Message, error) {
 
 	// Parse MIME message to extract parts and attachments
 	if apiMsg.Source != "" {
-		parts, attachments, err := parseMIMEMessage(apiMsg.Source)
+		parsed, err := c.parseSource(apiMsg.Source, message.ID)
 		if err != nil {
 			return nil, fmt.Errorf("parsing MIME message for ID %d: %w", apiMsg.ID, err)
 		}
-		message.Parts = parts
-		message.Attachments = attachments
+		message.MIME = parsed.MIME
+		message.Parts = parsed.Parts
+		message.Attachments = parsed.Attachments
+		message.Warnings = parsed.Warnings
+		message.Security = parsed.Security
 	}
+	c.runHooks(ctx, message)
 
 	return message, nil
 }
 
 // GetMessagePlain retrieves the plain text part of a message
 func (c *Client) GetMessagePlain(id string) (string, error) {
+	return c.GetMessagePlainContext(context.Background(), id)
+}
+
+// GetMessagePlainContext retrieves the plain text part of a message using the given context
+func (c *Client) GetMessagePlainContext(ctx context.Context, id string) (string, error) {
 	path := fmt.Sprintf("/api/messages/%s.plain", id)
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return "", err
 	}
@@ -280,9 +593,14 @@ func (c *Client) GetMessagePlain(id string) (string, error) {
 
 // GetMessageHTML retrieves the HTML part of a message
 func (c *Client) GetMessageHTML(id string) (string, error) {
+	return c.GetMessageHTMLContext(context.Background(), id)
+}
+
+// GetMessageHTMLContext retrieves the HTML part of a message using the given context
+func (c *Client) GetMessageHTMLContext(ctx context.Context, id string) (string, error) {
 	path := fmt.Sprintf("/api/messages/%s.html", id)
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return "", err
 	}
@@ -304,21 +622,20 @@ func (c *Client) GetMessageHTML(id string) (string, error) {
 
 // GetMessageSource retrieves the raw source of a message
 func (c *Client) GetMessageSource(id string) (string, error) {
-	path := fmt.Sprintf("/api/messages/%s.source", id)
+	return c.GetMessageSourceContext(context.Background(), id)
+}
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+// GetMessageSourceContext retrieves the raw source of a message using the given context
+func (c *Client) GetMessageSourceContext(ctx context.Context, id string) (string, error) {
+	source, err := c.OpenMessageSource(ctx, id)
 	if err != nil {
 		return "", err
 	}
 	defer func() {
-		_ = resp.Body.Close()
+		_ = source.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(source)
 	if err != nil {
 		return "", fmt.Errorf("reading response body: %w", err)
 	}
@@ -328,47 +645,50 @@ func (c *Client) GetMessageSource(id string) (string, error) {
 
 // GetMessageEML retrieves the message as an EML file
 func (c *Client) GetMessageEML(id string) ([]byte, error) {
-	path := fmt.Sprintf("/api/messages/%s.eml", id)
+	return c.GetMessageEMLContext(context.Background(), id)
+}
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+// GetMessageEMLContext retrieves the message as an EML file using the given context
+func (c *Client) GetMessageEMLContext(ctx context.Context, id string) ([]byte, error) {
+	eml, err := c.OpenMessageEML(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		_ = resp.Body.Close()
+		_ = eml.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	return io.ReadAll(resp.Body)
+	return io.ReadAll(eml)
 }
 
 // GetAttachment downloads a message attachment by CID
 func (c *Client) GetAttachment(messageID, cid string) ([]byte, error) {
-	path := fmt.Sprintf("/api/messages/%s/parts/%s", messageID, cid)
+	return c.GetAttachmentContext(context.Background(), messageID, cid)
+}
 
-	resp, err := c.doRequest(http.MethodGet, path, nil)
+// GetAttachmentContext downloads a message attachment by CID using the given context
+func (c *Client) GetAttachmentContext(ctx context.Context, messageID, cid string) ([]byte, error) {
+	attachment, err := c.OpenAttachment(ctx, messageID, cid)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		_ = resp.Body.Close()
+		_ = attachment.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	return io.ReadAll(resp.Body)
+	return io.ReadAll(attachment)
 }
 
 // DeleteMessage deletes a specific message
 func (c *Client) DeleteMessage(id string) error {
+	return c.DeleteMessageContext(context.Background(), id)
+}
+
+// DeleteMessageContext deletes a specific message using the given context
+func (c *Client) DeleteMessageContext(ctx context.Context, id string) error {
 	path := fmt.Sprintf("/api/messages/%s", id)
 
-	resp, err := c.doRequest(http.MethodDelete, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodDelete, path, nil)
 	if err != nil {
 		return err
 	}
@@ -388,9 +708,14 @@ func (c *Client) DeleteMessage(id string) error {
 
 // DeleteAllMessages deletes all messages
 func (c *Client) DeleteAllMessages() error {
+	return c.DeleteAllMessagesContext(context.Background())
+}
+
+// DeleteAllMessagesContext deletes all messages using the given context
+func (c *Client) DeleteAllMessagesContext(ctx context.Context) error {
 	path := "/api/messages/"
 
-	resp, err := c.doRequest(http.MethodDelete, path, nil)
+	resp, err := c.doRequest(ctx, http.MethodDelete, path, nil)
 	if err != nil {
 		return err
 	}
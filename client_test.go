@@ -1,9 +1,14 @@
 package sendria
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -417,4 +422,260 @@ func TestBasicAuth(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestHTTPOptions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "my-tests/1.0" {
+			t.Errorf("expected user agent my-tests/1.0, got %q", got)
+		}
+		if got := r.Header.Get("X-Request-Id"); got != "abc" {
+			t.Errorf("expected X-Request-Id abc, got %q", got)
+		}
+		if got := r.Header.Get("X-Trace"); got != "outer,inner" {
+			t.Errorf("expected middleware order outer,inner, got %q", got)
+		}
+
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage("[]")}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				value := name
+				if prev := req.Header.Get("X-Trace"); prev != "" {
+					value = prev + "," + name
+				}
+				req.Header.Set("X-Trace", value)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	client := NewClient(server.URL,
+		WithHTTPClient(httpClient),
+		WithBasicAuth("user", "pass"),
+		WithBearerToken("secret"),
+		WithUserAgent("my-tests/1.0"),
+		WithHeader("X-Request-Id", "abc"),
+		WithMiddleware(trace("outer"), trace("inner")),
+	)
+	if _, err := client.ListMessages(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if client.httpClient == httpClient || httpClient.Transport != nil {
+		t.Error("expected the given HTTP client to be copied, not modified")
+	}
+	if client.httpClient.Timeout != 5*time.Second {
+		t.Errorf("expected timeout of the given client, got %v", client.httpClient.Timeout)
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage("[]")}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(server.URL).ListMessages(0, 0); err == nil {
+		t.Fatal("expected certificate error without TLS config")
+	}
+
+	tlsConfig := &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	client := NewClient(server.URL, WithTLSConfig(tlsConfig))
+	if _, err := client.ListMessages(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The order of the options does not matter
+	client = NewClient(server.URL, WithTLSConfig(tlsConfig), WithTransport(&http.Transport{}))
+	if _, err := client.ListMessages(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client = NewClient(server.URL, WithTLSConfig(tlsConfig), WithTransport(RoundTripperFunc(http.DefaultTransport.RoundTrip)))
+	if _, err := client.ListMessages(0, 0); !errors.Is(err, ErrTLSConfigUnsupported) {
+		t.Fatalf("expected ErrTLSConfigUnsupported, got %v", err)
+	}
+}
+
+func TestOptionsOrder(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("", WithTimeout(time.Second), WithHTTPClient(&http.Client{Timeout: 5 * time.Second}))
+	if client.httpClient.Timeout != time.Second {
+		t.Errorf("expected WithTimeout to apply before WithHTTPClient, got %v", client.httpClient.Timeout)
+	}
+}
+
+func TestWithMessageHook(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal([]models.APIMessage{{ID: 1}, {ID: 2}})
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	type ctxKey struct{}
+	var seen []string
+	client := NewClient(server.URL, WithMessageHook(func(ctx context.Context, msg *models.Message) {
+		if ctx.Value(ctxKey{}) != "call" {
+			t.Error("expected the hook to get the context of the call")
+		}
+		seen = append(seen, msg.ID)
+	}))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "call")
+	if _, err := client.ListMessagesContext(ctx, 1, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "1" || seen[1] != "2" {
+		t.Errorf("expected hooks for messages 1 and 2, got %v", seen)
+	}
+}
+
+func TestListMessagesLazyParsing(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal([]models.APIMessage{
+			{ID: 1, Source: "Subject: ok\r\nContent-Type: text/plain\r\n\r\nHello"},
+			{ID: 2, Source: "Subject: broken\r\nContent-Type: multipart/mixed\r\n\r\nno boundary"},
+		})
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	var hookParts []int
+	client := NewClient(server.URL, WithMessageHook(func(ctx context.Context, msg *models.Message) {
+		hookParts = append(hookParts, len(msg.GetParts()))
+	}))
+	list, err := client.ListMessages(1, 10)
+	if err != nil {
+		t.Fatalf("expected a malformed message not to fail the list, got %v", err)
+	}
+	if len(hookParts) != 2 || hookParts[0] != 1 {
+		t.Errorf("expected hooks to see the parsed parts, got %v", hookParts)
+	}
+
+	list, err = NewClient(server.URL).ListMessages(1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ok, broken := list.Messages[0], list.Messages[1]
+	if ok.Parts != nil {
+		t.Error("expected parts to be parsed lazily")
+	}
+
+	var loaded, brokenLoaded int
+	ok.OnPartsLoaded(func(parsed *models.ParsedSource) { loaded += len(parsed.Parts) })
+	broken.OnPartsLoaded(func(*models.ParsedSource) { brokenLoaded++ })
+	if loaded != 0 || ok.Parts != nil {
+		t.Error("expected OnPartsLoaded to wait for the parse")
+	}
+
+	// Copies of a message load their parts concurrently without racing
+	var wg sync.WaitGroup
+	for _, msg := range []*models.Message{&ok, &ok, &list.Messages[0]} {
+		msg := msg
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = msg.LoadParts()
+		}()
+	}
+	wg.Wait()
+	if parts := ok.GetParts(); len(parts) != 1 || parts[0].Body != "Hello" {
+		t.Errorf("unexpected parts %+v", parts)
+	}
+	if body := ok.PreferredBody("text/html"); body == nil || body.Text() != "Hello" {
+		t.Errorf("expected the lazily parsed tree, got %+v", body)
+	}
+	if err := broken.LoadParts(); err == nil || broken.ParseError != err {
+		t.Errorf("expected parse error on the message, got %v", err)
+	}
+	if broken.GetParts() != nil {
+		t.Error("expected no parts for a malformed message")
+	}
+	ok.OnPartsLoaded(func(parsed *models.ParsedSource) { loaded += len(parsed.Parts) })
+	if loaded != 2 || brokenLoaded != 0 {
+		t.Errorf("expected callbacks for each parsed message, got %d parts and %d for the malformed one", loaded, brokenLoaded)
+	}
+
+	list, err = client.ListMessages(1, 10, WithoutSources())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, msg := range list.Messages {
+		if msg.Source != "" || msg.GetParts() != nil || msg.LoadParts() != nil {
+			t.Errorf("expected message %s without source and parts", msg.ID)
+		}
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	t.Parallel()
+
+	source := "Subject: broken\r\nContent-Type: multipart/mixed\r\n\r\nno boundary"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []byte
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			data, _ = json.Marshal(models.APIMessage{ID: 2, Source: source})
+		} else {
+			data, _ = json.Marshal([]models.APIMessage{{ID: 2, Source: source}})
+		}
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithLenientParsing())
+	list, err := client.ListMessages(1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listed := list.Messages[0]
+	if parts := listed.GetParts(); listed.ParseError != nil || len(parts) != 1 || parts[0].Body != "no boundary" {
+		t.Errorf("expected the body as text, got %+v (error %v)", parts, listed.ParseError)
+	}
+	if warnings := listed.GetWarnings(); len(warnings) != 1 || warnings[0].Code != models.WarningMissingBoundary {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+
+	msg, err := client.GetMessage("2")
+	if err != nil {
+		t.Fatalf("expected lenient parsing not to fail, got %v", err)
+	}
+	if len(msg.Warnings) != 1 || msg.MIME.ContentType != "text/plain" {
+		t.Errorf("unexpected warnings %v for %s", msg.Warnings, msg.MIME.ContentType)
+	}
+
+	if _, err := NewClient(server.URL).GetMessage("2"); err == nil {
+		t.Error("expected strict parsing to fail")
+	}
+}
@@ -0,0 +1,103 @@
+package sendria
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// Headers that correlate an email with the request that caused it
+const (
+	CorrelationIDHeader = "X-Correlation-ID"
+	TraceparentHeader   = "Traceparent"
+)
+
+// HeaderSetter is implemented by header types such as textproto.MIMEHeader
+// and http.Header, and by many mailer message types
+type HeaderSetter interface {
+	Set(key, value string)
+}
+
+// StampCorrelation sets the correlation headers on an outgoing email. Empty
+// values are skipped. traceparent is a W3C trace context header value such
+// as the one returned by otelsendria.Traceparent.
+func StampCorrelation(h HeaderSetter, correlationID, traceparent string) {
+	if correlationID != "" {
+		h.Set(CorrelationIDHeader, correlationID)
+	}
+	if traceparent != "" {
+		h.Set(TraceparentHeader, traceparent)
+	}
+}
+
+// Correlation identifies the request that caused an email
+type Correlation struct {
+	// ID is the value of the X-Correlation-ID header
+	ID string
+	// TraceID is the trace ID of the traceparent header
+	TraceID string
+}
+
+// CorrelationFromHeader reads the correlation headers of an email
+func CorrelationFromHeader(h mail.Header) Correlation {
+	c := Correlation{ID: strings.TrimSpace(h.Get(CorrelationIDHeader))}
+
+	// traceparent is version-traceid-parentid-flags
+	fields := strings.Split(strings.TrimSpace(h.Get(TraceparentHeader)), "-")
+	if len(fields) >= 4 && len(fields[1]) == 32 {
+		c.TraceID = strings.ToLower(fields[1])
+	}
+	return c
+}
+
+// Matches reports whether id is the correlation ID or the trace ID
+func (c Correlation) Matches(id string) bool {
+	if id == "" {
+		return false
+	}
+	return c.ID == id || (c.TraceID != "" && strings.EqualFold(c.TraceID, id))
+}
+
+// FindByCorrelation returns the messages whose X-Correlation-ID or
+// traceparent trace ID equals id, newest first. It scans all pages of the
+// inbox and only parses the message headers, so it works on shared inboxes.
+// Messages with malformed headers are skipped; their errors are returned
+// only if no message matches.
+func (c *Client) FindByCorrelation(ctx context.Context, id string) ([]models.Message, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	var matches []models.Message
+	var malformed []error
+	err := c.eachMessage(ctx, func(msg *models.Message) error {
+		source := msg.Source
+		if source == "" {
+			var err error
+			if source, err = c.GetMessageSourceContext(ctx, msg.ID); err != nil {
+				return err
+			}
+		}
+
+		parsed, err := mail.ReadMessage(strings.NewReader(source))
+		if err != nil {
+			malformed = append(malformed, fmt.Errorf("parsing headers of message %s: %w", msg.ID, err))
+			return nil
+		}
+		if CorrelationFromHeader(parsed.Header).Matches(id) {
+			matches = append(matches, *msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, errors.Join(malformed...)
+	}
+	return matches, nil
+}
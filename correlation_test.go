@@ -0,0 +1,88 @@
+package sendria
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+func TestStampCorrelation(t *testing.T) {
+	t.Parallel()
+
+	h := textproto.MIMEHeader{}
+	StampCorrelation(h, "req-1", "")
+	if h.Get("X-Correlation-Id") != "req-1" {
+		t.Errorf("expected correlation ID header, got %v", h)
+	}
+	if _, ok := h["Traceparent"]; ok {
+		t.Error("expected empty traceparent to be skipped")
+	}
+}
+
+func TestFindByCorrelation(t *testing.T) {
+	t.Parallel()
+
+	sources := map[int]string{
+		1: "Subject: A\r\nX-Correlation-ID: req-1\r\n\r\nHi",
+		2: "Subject: B\r\nX-Correlation-ID: req-2\r\n\r\nHi",
+		3: "Subject: C\r\nTraceparent: 00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01\r\n\r\nHi",
+		4: "Subject: D\r\n\r\nHi",
+		5: "Subject: E\r\nnot a header\r\n\r\nHi",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/messages/":
+			// The list omits the source of message 1, like a trimmed listing
+			apiMessages := []models.APIMessage{{ID: 1}}
+			for id := 2; id <= 5; id++ {
+				apiMessages = append(apiMessages, models.APIMessage{ID: id, Source: sources[id]})
+			}
+			data, _ := json.Marshal(apiMessages)
+			if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data}); err != nil {
+				t.Errorf("failed to encode response: %v", err)
+			}
+		case "/api/messages/1.source":
+			_, _ = w.Write([]byte(sources[1]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	tests := []struct {
+		id       string
+		expected []string
+		wantErr  bool
+	}{
+		{"req-1", []string{"1"}, false},
+		{"req-2", []string{"2"}, false},
+		{"4bf92f3577b34da6a3ce929d0e0e4736", []string{"3"}, false},
+		// The malformed message 5 is reported only when nothing matched
+		{"unknown", nil, true},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		messages, err := client.FindByCorrelation(context.Background(), tt.id)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "message 5") {
+				t.Errorf("FindByCorrelation(%q): expected error for message 5, got %v", tt.id, err)
+			}
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var ids []string
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		if len(ids) != len(tt.expected) || (len(ids) > 0 && ids[0] != tt.expected[0]) {
+			t.Errorf("FindByCorrelation(%q) = %v, want %v", tt.id, ids, tt.expected)
+		}
+	}
+}
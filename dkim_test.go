@@ -0,0 +1,323 @@
+package sendria
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+const unsignedSource = "From: Jane <jane@example.com>\r\n" +
+	"To: joe@example.org\r\n" +
+	"Subject: Quarterly   report\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"\r\n" +
+	"Hi Joe,  \r\n" +
+	"\r\n" +
+	"the report is attached.\r\n" +
+	"\r\n\r\n"
+
+// dkimSigner signs messages independently of the verifier under test
+type dkimSigner struct {
+	selector   string
+	key        crypto.Signer
+	canon      string
+	headers    string
+	bodyLength int
+}
+
+func (s dkimSigner) sign(t *testing.T, source string) string {
+	t.Helper()
+
+	header, body, _ := strings.Cut(source, "\r\n\r\n")
+	headerCanon, bodyCanon, _ := strings.Cut(s.canon, "/")
+
+	if bodyCanon == "relaxed" {
+		lines := strings.Split(body, "\r\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(strings.Join(strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' }), " "), " ")
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				lines[i] = " " + lines[i]
+			}
+		}
+		body = strings.Join(lines, "\r\n")
+	}
+	body = strings.TrimRight(body, "\r\n") + "\r\n"
+	if s.bodyLength > 0 {
+		body = body[:s.bodyLength]
+	}
+	bodyHash := sha256.Sum256([]byte(body))
+
+	alg, length := "rsa-sha256", ""
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		alg = "ed25519-sha256"
+	}
+	if s.bodyLength > 0 {
+		length = fmt.Sprintf(" l=%d;", s.bodyLength)
+	}
+	field := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=%s; d=example.com; s=%s;%s\r\n\th=%s;\r\n\tbh=%s; b=",
+		alg, s.canon, s.selector, length, s.headers, base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	canonical := func(f string) string {
+		if headerCanon == "simple" {
+			return f
+		}
+		name, value, _ := strings.Cut(f, ":")
+		value = strings.Join(strings.Fields(strings.ReplaceAll(value, "\r\n", "")), " ")
+		return strings.ToLower(name) + ":" + value + "\r\n"
+	}
+	fields := strings.Split(header, "\r\n")
+	var signed strings.Builder
+	for _, name := range strings.Split(s.headers, ":") {
+		for _, f := range fields {
+			if strings.EqualFold(strings.SplitN(f, ":", 2)[0], name) {
+				signed.WriteString(canonical(f + "\r\n"))
+			}
+		}
+	}
+	signed.WriteString(strings.TrimSuffix(canonical(field), "\r\n"))
+	digest := sha256.Sum256([]byte(signed.String()))
+
+	var sig []byte
+	var err error
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return field + base64.StdEncoding.EncodeToString(sig) + "\r\n" + source
+}
+
+type failingResolver struct{}
+
+func (failingResolver) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys := models.DKIMKeys{}
+	for selector, key := range map[string]crypto.Signer{"rsa": rsaKey, "ed": edKey} {
+		if keys[selector+"._domainkey.example.com"], err = models.DKIMKeyRecord(key.Public()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	relaxed := dkimSigner{selector: "rsa", key: rsaKey, canon: "relaxed/relaxed", headers: "from:to:subject:date:reply-to"}
+	simple := dkimSigner{selector: "ed", key: edKey, canon: "simple/simple", headers: "From:Subject"}
+
+	tests := []struct {
+		name     string
+		source   func(t *testing.T) string
+		resolver models.DKIMResolver
+		want     []models.DKIMStatus
+		wantErr  string
+	}{
+		{
+			name:   "relaxed rsa",
+			source: func(t *testing.T) string { return relaxed.sign(t, unsignedSource) },
+			want:   []models.DKIMStatus{models.DKIMPass},
+		},
+		{
+			name: "relaxed survives whitespace changes and bare LF",
+			source: func(t *testing.T) string {
+				signed := relaxed.sign(t, unsignedSource)
+				signed = strings.Replace(signed, "Subject: Quarterly   report", "subject:  Quarterly\r\n report ", 1)
+				signed = strings.Replace(signed, "Hi Joe,  ", "Hi  Joe,", 1)
+				return strings.ReplaceAll(signed, "\r\n", "\n")
+			},
+			want: []models.DKIMStatus{models.DKIMPass},
+		},
+		{
+			name:   "simple ed25519 and relaxed rsa",
+			source: func(t *testing.T) string { return simple.sign(t, relaxed.sign(t, unsignedSource)) },
+			want:   []models.DKIMStatus{models.DKIMPass, models.DKIMPass},
+		},
+		{
+			name: "simple breaks on whitespace changes",
+			source: func(t *testing.T) string {
+				return strings.Replace(simple.sign(t, unsignedSource), "Quarterly   report", "Quarterly report", 1)
+			},
+			want:    []models.DKIMStatus{models.DKIMFail},
+			wantErr: "signature does not match",
+		},
+		{
+			name: "changed body",
+			source: func(t *testing.T) string {
+				return strings.Replace(relaxed.sign(t, unsignedSource), "attached", "missing", 1)
+			},
+			want:    []models.DKIMStatus{models.DKIMFail},
+			wantErr: "body hash does not match",
+		},
+		{
+			name: "added unsigned header is ignored, added signed header breaks",
+			source: func(t *testing.T) string {
+				signed := relaxed.sign(t, unsignedSource)
+				return simple.sign(t, strings.Replace(signed, "\r\n\r\n", "\r\nX-Footer: 1\r\nReply-To: x@example.net\r\n\r\n", 1))
+			},
+			want:    []models.DKIMStatus{models.DKIMPass, models.DKIMFail},
+			wantErr: "signature does not match",
+		},
+		{
+			name: "body length allows appended footers",
+			source: func(t *testing.T) string {
+				signed := dkimSigner{selector: "rsa", key: rsaKey, canon: "relaxed/simple", headers: "from", bodyLength: 10}.sign(t, unsignedSource)
+				return signed + "--\r\nFooter\r\n"
+			},
+			want: []models.DKIMStatus{models.DKIMPass},
+		},
+		{
+			name: "unknown selector",
+			source: func(t *testing.T) string {
+				return dkimSigner{selector: "old", key: rsaKey, canon: "relaxed/relaxed", headers: "from"}.sign(t, unsignedSource)
+			},
+			want:    []models.DKIMStatus{models.DKIMPermError},
+			wantErr: "no key record old._domainkey.example.com",
+		},
+		{
+			name:     "lookup failure",
+			source:   func(t *testing.T) string { return relaxed.sign(t, unsignedSource) },
+			resolver: failingResolver{},
+			want:     []models.DKIMStatus{models.DKIMTempError},
+			wantErr:  "i/o timeout",
+		},
+		{
+			name: "unsupported algorithm",
+			source: func(t *testing.T) string {
+				return strings.Replace(relaxed.sign(t, unsignedSource), "a=rsa-sha256", "a=rsa-sha1", 1)
+			},
+			want:    []models.DKIMStatus{models.DKIMPermError},
+			wantErr: `unsupported algorithm "rsa-sha1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resolver := tt.resolver
+			if resolver == nil {
+				resolver = keys
+			}
+			msg := models.Message{Source: tt.source(t)}
+			results, err := msg.VerifyDKIM(context.Background(), resolver)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var statuses []models.DKIMStatus
+			for _, r := range results {
+				statuses = append(statuses, r.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.want) {
+				t.Fatalf("expected %v, got %+v", tt.want, results)
+			}
+			last := results[len(results)-1]
+			if tt.wantErr == "" && last.Err != nil || tt.wantErr != "" && (last.Err == nil || !strings.Contains(last.Err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, last.Err)
+			}
+		})
+	}
+}
+
+func TestVerifyDKIMResult(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, err := models.DKIMKeyRecord(key.Public())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	signer := dkimSigner{selector: "mail", key: key, canon: "relaxed/simple", headers: "From:To:Subject:Message-ID"}
+	msg := models.Message{Source: signer.sign(t, unsignedSource)}
+	results, err := msg.VerifyDKIM(context.Background(), models.DKIMKeys{"Mail._DomainKey.example.com": record})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := results[0]
+	if !r.Pass() || r.Domain != "example.com" || r.Selector != "mail" || r.Identity != "@example.com" ||
+		r.Algorithm != "ed25519-sha256" || r.Canonicalization != "relaxed/simple" || r.BodyLength != -1 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if !reflect.DeepEqual(r.SignedHeaders, []string{"From", "To", "Subject", "Message-ID"}) || !r.Signs("subject") || r.Signs("Date") {
+		t.Errorf("unexpected signed headers %v", r.SignedHeaders)
+	}
+
+	unsigned := models.Message{Source: unsignedSource}
+	if _, err := unsigned.VerifyDKIM(context.Background(), models.DKIMKeys{}); !errors.Is(err, models.ErrNoDKIMSignature) {
+		t.Errorf("expected ErrNoDKIMSignature, got %v", err)
+	}
+}
+
+// TestVerifyDKIMRFC8463 verifies the signed example of RFC 8463, Appendix A,
+// which carries an ed25519-sha256 and an rsa-sha256 signature made by
+// another implementation
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	t.Parallel()
+
+	source, err := os.ReadFile("testdata/dkim/rfc8463.eml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	// The key records of RFC 8463, Appendix A.2
+	keys := models.DKIMKeys{
+		"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+		"test._domainkey.football.example.com": "v=DKIM1; k=rsa; " +
+			"p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+	}
+
+	msg := models.Message{Source: string(source)}
+	results, err := msg.VerifyDKIM(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for i, algorithm := range []string{"ed25519-sha256", "rsa-sha256"} {
+		if r := results[i]; !r.Pass() || r.Algorithm != algorithm || r.Domain != "football.example.com" {
+			t.Errorf("expected %s signature to pass, got %+v", algorithm, r)
+		}
+	}
+
+	tampered := models.Message{Source: strings.Replace(string(source), "hungry", "thirsty", 1)}
+	results, err = tampered.VerifyDKIM(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range results {
+		if r.Pass() {
+			t.Errorf("expected tampered body to fail %s signature", r.Algorithm)
+		}
+	}
+}
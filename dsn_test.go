@@ -0,0 +1,92 @@
+package sendria
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// bounceSource is a bounce as generated by Postfix for two recipients
+const bounceSource = "From: MAILER-DAEMON@mx.example.com (Mail Delivery System)\r\n" +
+	"To: app@example.com\r\nSubject: Undelivered Mail Returned to Sender\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"B\"\r\n\r\n" +
+	"--B\r\nContent-Description: Notification\r\nContent-Type: text/plain; charset=us-ascii\r\n\r\n" +
+	"I'm sorry to have to inform you that your message could not\r\nbe delivered to one or more recipients.\r\n\r\n" +
+	"--B\r\nContent-Description: Delivery report\r\nContent-Type: message/delivery-status\r\n\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\nX-Postfix-Queue-ID: 4F2A1\r\n" +
+	"Original-Envelope-Id: env-42\r\nArrival-Date: Mon, 02 Mar 2026 10:00:00 +0100 (CET)\r\n\r\n" +
+	"Final-Recipient: rfc822; nobody@example.org\r\nOriginal-Recipient: rfc822;Nobody@Example.org\r\n" +
+	"Action: failed\r\nStatus: 5.1.1\r\nRemote-MTA: dns; mail.example.org\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 <nobody@example.org>: Recipient address\r\n    rejected: User unknown\r\n\r\n" +
+	"Final-Recipient: rfc822; <slow@example.org>\r\nAction: delayed\r\nStatus: 4.4.1 (connection timed out)\r\n\r\n" +
+	"--B\r\nContent-Description: Undelivered Message Headers\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+	"From: app@example.com\r\nTo: nobody@example.org\r\nSubject: Welcome\r\nMessage-ID: <welcome-1@example.com>\r\n\r\n" +
+	"--B--\r\n"
+
+func TestDeliveryReport(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(bounceSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	report, err := msg.DeliveryReport()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.ReportingMTA != "mx.example.com" || report.EnvelopeID != "env-42" || report.ArrivalDate.Day() != 2 {
+		t.Errorf("unexpected per-message fields %+v", report)
+	}
+	if report.Fields.Get("X-Postfix-Queue-ID") != "4F2A1" {
+		t.Errorf("expected extension fields to be kept, got %v", report.Fields)
+	}
+	if report.Explanation == "" || report.OriginalMessageID != "<welcome-1@example.com>" || report.Original.Subject != "Welcome" {
+		t.Errorf("unexpected explanation or original %q %q %+v", report.Explanation, report.OriginalMessageID, report.Original)
+	}
+	if len(report.Recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %+v", report.Recipients)
+	}
+
+	failed, ok := report.Recipient("NOBODY@example.org")
+	if !ok {
+		t.Fatal("expected a status for nobody@example.org")
+	}
+	expected := models.RecipientStatus{
+		FinalRecipient:    "nobody@example.org",
+		OriginalRecipient: "Nobody@Example.org",
+		Action:            models.ActionFailed,
+		Status:            "5.1.1",
+		DiagnosticCode:    "550 5.1.1 <nobody@example.org>: Recipient address rejected: User unknown",
+		RemoteMTA:         "mail.example.org",
+	}
+	failed.Fields = nil
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("expected %+v, got %+v", expected, failed)
+	}
+	if !failed.Permanent() || failed.Transient() {
+		t.Error("expected a permanent failure")
+	}
+
+	delayed, ok := report.Recipient("slow@example.org")
+	if !ok || delayed.Action != models.ActionDelayed || delayed.Status != "4.4.1" || !delayed.Transient() {
+		t.Errorf("unexpected delayed status %+v", delayed)
+	}
+}
+
+func TestDeliveryReportNotAReport(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(treeSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+	if _, err := msg.DeliveryReport(); !errors.Is(err, models.ErrNoDeliveryReport) {
+		t.Errorf("expected ErrNoDeliveryReport, got %v", err)
+	}
+}
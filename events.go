@@ -0,0 +1,299 @@
+package sendria
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Event types pushed by Sendria over its WebSocket
+const (
+	EventAddMessage     = "add_message"
+	EventDeleteMessage  = "delete_message"
+	EventDeleteMessages = "delete_messages"
+)
+
+// websocketGUID is the magic value of the WebSocket handshake (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxFramePayload limits the size of a single WebSocket frame
+const maxFramePayload = 1 << 20
+
+// Event is a notification pushed by Sendria when messages change
+type Event struct {
+	// Type is one of the Event* constants, or the raw notification if
+	// the format is unknown
+	Type string
+	// MessageID is the affected message, if the event names one
+	MessageID string
+}
+
+// Subscribe connects to the Sendria WebSocket and streams events until the
+// context is cancelled or the connection breaks, at which point the channel
+// is closed. It returns an error if the server does not support WebSockets,
+// or ErrWebSocketUnsupported without connecting if ServerInfo detected so.
+func (c *Client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	if info := c.knownInfo(); info != nil && !info.WebSocket {
+		return nil, ErrWebSocketUnsupported
+	}
+	return c.subscribe(ctx)
+}
+
+// subscribe performs the WebSocket handshake and starts reading events
+func (c *Client) subscribe(ctx context.Context) (<-chan Event, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating websocket key: %w", err)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/ws", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", encodedKey)
+
+	// The connection is long-lived, so the client timeout must not apply
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("websocket not supported: unexpected status code: %d", resp.StatusCode)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, errors.New("websocket not supported: connection cannot be upgraded")
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(encodedKey) {
+		_ = conn.Close()
+		return nil, errors.New("websocket handshake failed: invalid accept key")
+	}
+
+	events := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go func() {
+		defer close(events)
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		r := bufio.NewReader(conn)
+		for {
+			payload, err := readMessage(r, conn)
+			if err != nil {
+				return
+			}
+
+			event := parseEvent(payload)
+			c.invalidateCache(event)
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// websocketAccept computes the expected Sec-WebSocket-Accept header
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readMessage reads the next data message, answering pings on the way
+func readMessage(r *bufio.Reader, w io.Writer) ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := readFrame(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := writeFrame(w, opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			_ = writeFrame(w, opClose, nil)
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			message = append(message, payload...)
+			if len(message) > maxFramePayload {
+				return nil, errors.New("websocket message too large")
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a single WebSocket frame
+func readFrame(r *bufio.Reader) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxFramePayload {
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single masked frame, as required for clients
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// parseEvent decodes a notification. Sendria versions differ in the format,
+// so JSON objects as well as "type,id" style text are accepted.
+func parseEvent(payload []byte) Event {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(payload, &obj); err == nil {
+		event := Event{}
+		for _, key := range []string{"type", "event", "action"} {
+			if v, ok := obj[key].(string); ok {
+				event.Type = v
+				break
+			}
+		}
+		for _, key := range []string{"id", "message_id"} {
+			switch v := obj[key].(type) {
+			case string:
+				event.MessageID = v
+			case float64:
+				event.MessageID = strconv.FormatInt(int64(v), 10)
+			}
+		}
+		if event.Type != "" {
+			return event
+		}
+	}
+
+	text := strings.TrimSpace(string(payload))
+	if i := strings.IndexAny(text, ",: "); i > 0 {
+		return Event{Type: text[:i], MessageID: strings.TrimSpace(text[i+1:])}
+	}
+	return Event{Type: text}
+}
+
+// invalidateCache drops cached responses of messages deleted by others
+func (c *Client) invalidateCache(event Event) {
+	if c.cache == nil {
+		return
+	}
+
+	switch event.Type {
+	case EventDeleteMessage:
+		c.cache.invalidate(event.MessageID)
+	case EventDeleteMessages:
+		c.cache.purge()
+	}
+}
@@ -0,0 +1,91 @@
+package sendria
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws" {
+			t.Errorf("expected path /ws, got %s", r.URL.Path)
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+
+		// Server frames are not masked
+		_, _ = rw.Write([]byte{0x89, 0x02, 'h', 'i'}) // ping
+		_, _ = rw.Write(append([]byte{0x81, 14}, `add_message,42`...))
+		_, _ = rw.Write(append([]byte{0x01, 10}, `{"type":"d`...)) // fragmented
+		_, _ = rw.Write(append([]byte{0x80, 27}, `elete_message","id":7}     `...))
+		_ = rw.Flush()
+
+		// Expect a masked pong answering the ping
+		br := bufio.NewReader(rw)
+		fin, opcode, payload, err := readFrame(br)
+		if err != nil || !fin || opcode != opPong || string(payload) != "hi" {
+			t.Errorf("expected pong, got %v %d %q %v", fin, opcode, payload, err)
+		}
+
+		// Block until the client closes the connection
+		for err == nil {
+			_, _, _, err = readFrame(br)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(server.URL)
+	events, err := client.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Event{
+		{Type: EventAddMessage, MessageID: "42"},
+		{Type: EventDeleteMessage, MessageID: "7"},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("expected event %+v, got %+v", want, got)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestSubscribeUnsupported(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	if _, err := client.Subscribe(context.Background()); err == nil {
+		t.Fatal("expected error for server without websocket support")
+	}
+}
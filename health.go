@@ -0,0 +1,244 @@
+package sendria
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultSMTPPort is the port Sendria accepts SMTP connections on by default
+const DefaultSMTPPort = "1025"
+
+// Bounds of the readiness polling of WaitReady
+const (
+	readyMinInterval = 100 * time.Millisecond
+	readyMaxInterval = 2 * time.Second
+)
+
+// ErrAuthRequired is returned when the server requires credentials that the
+// client does not have or that were rejected
+var ErrAuthRequired = errors.New("sendria requires authentication, configure WithBasicAuth or WithBearerToken")
+
+// ErrWebSocketUnsupported is returned by Subscribe when ServerInfo detected
+// that the server does not support WebSockets
+var ErrWebSocketUnsupported = errors.New("sendria server does not support websockets")
+
+// WithSMTPAddr sets the host:port of the Sendria SMTP server checked by Ping.
+// It defaults to the host of the base URL on DefaultSMTPPort. An empty
+// address disables the SMTP check.
+func WithSMTPAddr(addr string) Option {
+	return func(c *Client) {
+		c.smtpAddr = &addr
+	}
+}
+
+// SMTPAddr returns the host:port of the Sendria SMTP server, or an empty
+// string if the SMTP check is disabled
+func (c *Client) SMTPAddr() string {
+	if c.smtpAddr != nil {
+		return *c.smtpAddr
+	}
+	u, err := url.Parse(c.baseURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return net.JoinHostPort(u.Hostname(), DefaultSMTPPort)
+}
+
+// Ping checks that the HTTP API answers and the SMTP server greets. It fails
+// fast with ErrAuthRequired if the credentials are missing or wrong.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/messages/?per_page=1", nil)
+	if err != nil {
+		return fmt.Errorf("sendria HTTP API not reachable at %s: %w", c.baseURL, err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrAuthRequired
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("sendria HTTP API not ready: unexpected status code: %d", resp.StatusCode)
+	}
+
+	if addr := c.SMTPAddr(); addr != "" {
+		if err := pingSMTP(ctx, addr); err != nil {
+			return fmt.Errorf("sendria SMTP server not ready at %s: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// WaitReady polls Ping until the server is ready or the context ends, e.g. in
+// CI after starting the Sendria container. Authentication errors are returned
+// immediately.
+func (c *Client) WaitReady(ctx context.Context) error {
+	interval := readyMinInterval
+	for {
+		err := c.Ping(ctx)
+		if err == nil || errors.Is(err, ErrAuthRequired) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for sendria: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > readyMaxInterval {
+			interval = readyMaxInterval
+		}
+	}
+}
+
+// pingSMTP reads the SMTP greeting of the server and says goodbye
+func pingSMTP(ctx context.Context, addr string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "220") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+	_, _ = io.WriteString(conn, "QUIT\r\n")
+	return nil
+}
+
+// ServerInfo describes a Sendria server
+type ServerInfo struct {
+	// Version is the Sendria version, or empty if the server does not tell
+	Version string
+	// WebSocket reports whether Subscribe is supported
+	WebSocket bool
+	// AuthRequired reports whether the API rejects anonymous requests
+	AuthRequired bool
+}
+
+// sendriaVersion finds the version in headers and the web UI
+var sendriaVersion = regexp.MustCompile(`(?i)sendria[/ v:-]*v?(\d+\.\d+(?:\.\d+)?)`)
+
+// ServerInfo detects the version and features of the server. The result is
+// remembered, so that Subscribe fails fast on servers without WebSockets.
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info := &ServerInfo{}
+
+	// Anonymous request to detect whether authentication is required
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/messages/?per_page=1", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sendria not reachable at %s: %w", c.baseURL, err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	info.AuthRequired = resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+
+	// Authenticated request to check the credentials
+	resp, err = c.doRequest(ctx, http.MethodGet, "/api/messages/?per_page=1", nil)
+	if err != nil {
+		return nil, fmt.Errorf("sendria not reachable at %s: %w", c.baseURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, ErrAuthRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	info.Version = versionFromHeader(resp.Header)
+
+	if info.Version == "" {
+		info.Version = c.versionFromUI(ctx)
+	}
+	info.WebSocket = c.probeWebSocket(ctx)
+
+	c.infoMu.Lock()
+	c.info = info
+	c.infoMu.Unlock()
+	return info, nil
+}
+
+// versionFromHeader finds the Sendria version in response headers
+func versionFromHeader(h http.Header) string {
+	if v := h.Get("X-Sendria-Version"); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	if m := sendriaVersion.FindStringSubmatch(h.Get("Server")); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// versionFromUI finds the Sendria version in the web UI
+func (c *Client) versionFromUI(ctx context.Context) string {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	if m := sendriaVersion.FindSubmatch(page); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// probeWebSocket reports whether the WebSocket handshake succeeds
+func (c *Client) probeWebSocket(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	events, err := c.subscribe(ctx)
+	if err != nil {
+		return false
+	}
+	cancel()
+	for range events {
+	}
+	return true
+}
+
+// knownInfo returns the server info detected by ServerInfo, if any
+func (c *Client) knownInfo() *ServerInfo {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.info
+}
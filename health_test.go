@@ -0,0 +1,257 @@
+package sendria
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeSMTP accepts SMTP connections and greets them until the test ends
+func newFakeSMTP(t *testing.T, greeting string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.WriteString(conn, greeting+"\r\n")
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				if strings.TrimSpace(line) == "QUIT" {
+					_, _ = io.WriteString(conn, "221 Bye\r\n")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// closedAddr returns an address nothing listens on
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestSMTPAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		baseURL  string
+		options  []Option
+		expected string
+	}{
+		{"default", "", nil, "localhost:1025"},
+		{"from base URL", "http://sendria.example.com:8025", nil, "sendria.example.com:1025"},
+		{"explicit", "http://localhost:1080", []Option{WithSMTPAddr("mail:2525")}, "mail:2525"},
+		{"disabled", "http://localhost:1080", []Option{WithSMTPAddr("")}, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := NewClient(tt.baseURL, tt.options...).SMTPAddr(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, `{"code":"OK","data":[],"meta":{"pages_total":1}}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	smtpAddr := newFakeSMTP(t, "220 sendria ESMTP")
+
+	client := NewClient(server.URL, WithBasicAuth("user", "pass"), WithSMTPAddr(smtpAddr))
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	client = NewClient(server.URL, WithSMTPAddr(smtpAddr))
+	if err := client.Ping(ctx); !errors.Is(err, ErrAuthRequired) {
+		t.Errorf("expected ErrAuthRequired, got %v", err)
+	}
+
+	client = NewClient(server.URL, WithBasicAuth("user", "pass"), WithSMTPAddr(closedAddr(t)))
+	if err := client.Ping(ctx); err == nil || !strings.Contains(err.Error(), "SMTP") {
+		t.Errorf("expected SMTP error, got %v", err)
+	}
+
+	client = NewClient(server.URL, WithBasicAuth("user", "pass"), WithSMTPAddr(newFakeSMTP(t, "554 go away")))
+	if err := client.Ping(ctx); err == nil || !strings.Contains(err.Error(), "554 go away") {
+		t.Errorf("expected greeting error, got %v", err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"code":"OK","data":[]}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(server.URL, WithSMTPAddr(newFakeSMTP(t, "220 ready")))
+	if err := client.WaitReady(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	client = NewClient(server.URL, WithSMTPAddr(closedAddr(t)))
+	err := client.WaitReady(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "SMTP") {
+		t.Errorf("expected deadline error naming the SMTP failure, got %v", err)
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		meta      string
+		header    string
+		page      string
+		auth      bool
+		websocket bool
+		expected  ServerInfo
+	}{
+		{
+			name:      "current",
+			meta:      `{"pages_total":3}`,
+			header:    "2.2.2",
+			websocket: true,
+			expected:  ServerInfo{Version: "2.2.2", WebSocket: true},
+		},
+		{
+			name:     "version from web UI",
+			meta:     `{"total":12}`,
+			page:     `<title>Sendria</title><footer>Sendria v1.0.0</footer>`,
+			auth:     true,
+			expected: ServerInfo{Version: "1.0.0", AuthRequired: true},
+		},
+		{
+			name:     "unknown",
+			expected: ServerInfo{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, _, ok := r.BasicAuth(); tt.auth && !ok {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if tt.header != "" {
+					w.Header().Set("X-Sendria-Version", tt.header)
+				}
+
+				switch r.URL.Path {
+				case "/api/messages/":
+					body := `{"code":"OK","data":[]`
+					if tt.meta != "" {
+						body += `,"meta":` + tt.meta
+					}
+					_, _ = io.WriteString(w, body+"}")
+				case "/":
+					_, _ = io.WriteString(w, tt.page)
+				case "/ws":
+					if !tt.websocket {
+						http.NotFound(w, r)
+						return
+					}
+					conn, rw, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+						"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+						"Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+					_ = rw.Flush()
+					_, _ = io.Copy(io.Discard, rw)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(server.URL, WithBasicAuth("user", "pass"))
+			info, err := client.ServerInfo(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *info != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *info)
+			}
+
+			_, err = client.Subscribe(ctx)
+			if !tt.websocket && !errors.Is(err, ErrWebSocketUnsupported) {
+				t.Errorf("expected ErrWebSocketUnsupported, got %v", err)
+			}
+
+			if tt.auth {
+				_, err := NewClient(server.URL).ServerInfo(ctx)
+				if !errors.Is(err, ErrAuthRequired) {
+					t.Errorf("expected ErrAuthRequired without credentials, got %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package sendria
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+func TestHTMLToText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "blocks and whitespace",
+			html: "<html><head><title>Ignored</title><style>p { color: red }</style></head>" +
+				"<body><h1>Welcome,\n  Jane</h1><p>First&nbsp;line<br>second <b>bold</b> line</p><div>Next</div></body></html>",
+			want: "Welcome, Jane\n\nFirst line\nsecond bold line\n\nNext",
+		},
+		{
+			name: "links",
+			html: `<p>Please <a href="https://example.com/verify?a=1&amp;b=2">verify your email</a>, ` +
+				`<a href="https://example.com">https://example.com</a> or <a href="mailto:help@example.com">help@example.com</a>` +
+				` <a href="#top">top</a></p>`,
+			want: "Please verify your email [https://example.com/verify?a=1&b=2], https://example.com or help@example.com top",
+		},
+		{
+			name: "image links use alt text",
+			html: `<a href="https://example.com"><img src="cid:logo" alt="Example"></a><img src="spacer.gif">`,
+			want: "Example [https://example.com]",
+		},
+		{
+			name: "lists",
+			html: "<ul><li>One</li><li>Two<ol start=\"3\"><li>Three</li><li>Four</li></ol></li></ul><p>After</p>",
+			want: "* One\n* Two\n  3. Three\n  4. Four\n\nAfter",
+		},
+		{
+			name: "tables",
+			html: "<table><tr><th>Item</th><th>Price</th></tr><tr><td>Book</td><td></td><td>9.99</td></tr></table>",
+			want: "Item | Price\nBook | 9.99",
+		},
+		{
+			name: "hidden elements and scripts",
+			html: `<div style="display:none;max-height:0">Preheader <div>nested</div> text</div>` +
+				`<script>document.write("<p>x</p>")</script><p hidden>Hidden</p>` +
+				`<span style="mso-hide: all">Outlook only</span><!-- comment --><p>Visible</p>`,
+			want: "Visible",
+		},
+		{
+			name: "preformatted",
+			html: "<p>Code:</p><pre>  a := 1\n  b := 2</pre><p>Done</p>",
+			want: "Code:\n\n  a := 1\n  b := 2\n\nDone",
+		},
+		{
+			name: "malformed",
+			html: "1 < 2 <p>unclosed <b>bold <a href='https://x.example'>link",
+			want: "1 < 2\n\nunclosed bold link",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := models.HTMLToText(tt.html); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAlternatives(t *testing.T) {
+	t.Parallel()
+
+	source := func(plain, html string) string {
+		return "Subject: x\r\nContent-Type: multipart/alternative; boundary=B\r\n\r\n" +
+			"--B\r\nContent-Type: text/plain\r\n\r\n" + plain + "\r\n" +
+			"--B\r\nContent-Type: text/html\r\n\r\n" + html + "\r\n--B--\r\n"
+	}
+	html := `<h1>Hi Jane,</h1><p>Please <a href="https://example.com/verify?t=1&amp;u=2">verify your email</a>.</p>` +
+		`<p><a href="https://example.com/help">Help</a></p>`
+
+	tests := []struct {
+		name           string
+		plain          string
+		wantConsistent bool
+		wantLinks      []string
+		wantMissing    []string
+		wantExtra      []string
+	}{
+		{
+			name:           "consistent",
+			plain:          "Hi Jane,\n\nPlease verify your email: https://example.com/verify?t=1&u=2\n\nHelp: https://example.com/help",
+			wantConsistent: true,
+		},
+		{
+			name:        "missing link",
+			plain:       "Hi Jane,\n\nPlease verify your email: https://example.com/verify?t=1&u=2\n\nHelp",
+			wantLinks:   []string{"https://example.com/help"},
+			wantMissing: nil,
+		},
+		{
+			name:        "diverging content",
+			plain:       "Hello there. Click https://example.com/verify?t=1&u=2 and https://example.com/help",
+			wantMissing: []string{"hi", "jane", "please", "verify", "your", "email", "help"},
+			wantExtra:   []string{"hello", "there", "click", "and"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parsed, err := parseSource(source(tt.plain, html), discardLogger)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			msg := models.Message{MIME: parsed.MIME}
+
+			report, err := msg.CheckAlternatives(0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if report.Consistent() != tt.wantConsistent {
+				t.Errorf("expected consistent %v, got %+v", tt.wantConsistent, report)
+			}
+			if !reflect.DeepEqual(report.MissingLinks, tt.wantLinks) ||
+				!reflect.DeepEqual(report.MissingWords, tt.wantMissing) ||
+				!reflect.DeepEqual(report.ExtraWords, tt.wantExtra) {
+				t.Errorf("unexpected differences %+v", report)
+			}
+		})
+	}
+}
+
+func TestPlainTextFallsBackToHTML(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource("Subject: x\r\nContent-Type: text/html\r\n\r\n<p>Only <b>HTML</b></p>", discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := models.Message{MIME: parsed.MIME}
+
+	if text := msg.PlainText(); text != "Only HTML" {
+		t.Errorf("expected the rendered HTML, got %q", text)
+	}
+	if _, err := msg.CheckAlternatives(0); err != models.ErrNoPlainBody {
+		t.Errorf("expected ErrNoPlainBody, got %v", err)
+	}
+}
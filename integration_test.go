@@ -4,6 +4,7 @@ package sendria_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/smtp"
 	"os"
@@ -28,8 +29,13 @@ func TestSendriaIntegration(t *testing.T) {
 		smtpHost = "localhost:1025"
 	}
 
-	// Create client
-	client := sendria.NewClient(sendriaURL)
+	// Create client and wait until both HTTP and SMTP accept connections
+	client := sendria.NewClient(sendriaURL, sendria.WithSMTPAddr(smtpHost))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := client.WaitReady(ctx); err != nil {
+		t.Fatalf("Sendria is not ready: %v", err)
+	}
 
 	// Clear all messages before starting
 	t.Log("Clearing all messages...")
@@ -0,0 +1,201 @@
+// Package fakesendria is an in-memory stand-in for the Sendria HTTP API,
+// shared by the tests of the helper packages
+package fakesendria
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// Server serves captured messages like Sendria. Messages are added as raw
+// sources; their envelope fields are read from the headers.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	messages []models.APIMessage
+}
+
+// New starts a fake Sendria server that is closed when the test ends
+func New(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{nextID: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Add stores a raw email source as a captured message and returns its ID
+func (s *Server) Add(t testing.TB, source string) string {
+	t.Helper()
+
+	id, err := s.Store(source)
+	if err != nil {
+		t.Fatalf("invalid test message: %v", err)
+	}
+	return id
+}
+
+// Store stores a raw email source as a captured message. Unlike Add it is
+// safe to call from goroutines other than the test's.
+func (s *Server) Store(source string) (string, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(source))
+	if err != nil {
+		return "", err
+	}
+	to := []string{}
+	if addrs, err := msg.Header.AddressList("To"); err == nil {
+		for _, addr := range addrs {
+			to = append(to, addr.Address)
+		}
+	}
+	from := msg.Header.Get("From")
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	// Newest messages come first, like in Sendria
+	s.messages = append([]models.APIMessage{{
+		ID:                  id,
+		SenderMessage:       from,
+		RecipientsMessageTo: to,
+		Subject:             msg.Header.Get("Subject"),
+		Source:              source,
+		Size:                len(source),
+		CreatedAt:           time.Now().Format("2006-01-02T15:04:05"),
+	}}, s.messages...)
+	return strconv.Itoa(id), nil
+}
+
+// AddLater stores a message after the given delay
+func (s *Server) AddLater(t testing.TB, delay time.Duration, source string) {
+	t.Helper()
+
+	timer := time.AfterFunc(delay, func() {
+		if _, err := s.Store(source); err != nil {
+			t.Errorf("invalid test message: %v", err)
+		}
+	})
+	t.Cleanup(func() { timer.Stop() })
+}
+
+// handle serves the list, message, body, source and delete endpoints
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodDelete:
+			s.messages = nil
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s.writeJSON(w, s.messages)
+		}
+		return
+	}
+
+	id, ext, _ := strings.Cut(path, ".")
+	var msg *models.APIMessage
+	for i := range s.messages {
+		if strconv.Itoa(s.messages[i].ID) == id {
+			msg = &s.messages[i]
+		}
+	}
+	if msg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodDelete:
+		for i := range s.messages {
+			if &s.messages[i] == msg {
+				s.messages = append(s.messages[:i], s.messages[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case ext == "json":
+		s.writeJSON(w, msg)
+	case ext == "plain":
+		_, _ = io.WriteString(w, findBody(msg.Source, "text/plain"))
+	case ext == "html":
+		_, _ = io.WriteString(w, findBody(msg.Source, "text/html"))
+	case ext == "source" || ext == "eml":
+		_, _ = io.WriteString(w, msg.Source)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeJSON writes v as the data of an API response
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Code: "OK",
+		Data: data,
+		Meta: &models.APIMeta{PagesTotal: 1},
+	})
+}
+
+// findBody returns the first body of the given media type in a raw message
+func findBody(source, mediaType string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(source))
+	if err != nil {
+		return ""
+	}
+	return findPartBody(msg.Header.Get("Content-Type"), msg.Body, mediaType)
+}
+
+func findPartBody(contentType string, body io.Reader, mediaType string) string {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(mt, "multipart/") {
+		if mt != mediaType {
+			return ""
+		}
+		data, _ := io.ReadAll(body)
+		return string(data)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+		if found := findPartBody(p.Header.Get("Content-Type"), p, mediaType); found != "" {
+			return found
+		}
+	}
+}
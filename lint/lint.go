@@ -0,0 +1,195 @@
+// Package lint checks captured messages for problems that mail providers
+// penalize: missing Date and Message-ID headers, HTML without a plain text
+// alternative, overlong lines, bulk mail without unsubscribe headers, HTML
+// that Gmail clips, images without alt text and misleading or insecure
+// links.
+//
+//	findings, err := lint.Lint(msg)
+//	if err != nil {
+//		return err
+//	}
+//	for _, f := range findings.AtLeast(lint.SeverityWarning) {
+//		t.Error(f)
+//	}
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// Severity ranks how likely a finding is to hurt delivery
+type Severity int
+
+// Severities in increasing order
+const (
+	// SeverityInfo marks deviations from recommendations providers tolerate
+	SeverityInfo Severity = iota
+	// SeverityWarning marks problems that hurt spam scores or rendering
+	SeverityWarning
+	// SeverityError marks violations that providers reject or that break
+	// the message
+	SeverityError
+)
+
+// String returns the lower-cased name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the severity by its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// IDs of the built-in rules
+const (
+	RuleMissingDate         = "missing-date"
+	RuleMissingMessageID    = "missing-message-id"
+	RuleNoPlainText         = "no-plain-text"
+	RuleHeaderLineLength    = "header-line-length"
+	RuleHeaderLineFolding   = "header-line-folding"
+	RuleBodyLineLength      = "body-line-length"
+	RuleListUnsubscribe     = "list-unsubscribe"
+	RuleListUnsubscribePost = "list-unsubscribe-post"
+	RuleHTMLSize            = "html-size"
+	RuleImageAlt            = "image-alt"
+	RuleLinkText            = "link-text"
+	RuleMixedContent        = "mixed-content"
+)
+
+// Finding is a problem found by a rule
+type Finding struct {
+	// Rule is the ID of the rule, e.g. "missing-date"
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String formats the finding as "severity [rule] message"
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s", f.Severity, f.Rule, f.Message)
+}
+
+// Findings are the findings of all rules, in the order of the rules
+type Findings []Finding
+
+// AtLeast returns the findings with at least the given severity
+func (f Findings) AtLeast(severity Severity) Findings {
+	var filtered Findings
+	for _, finding := range f {
+		if finding.Severity >= severity {
+			filtered = append(filtered, finding)
+		}
+	}
+	return filtered
+}
+
+// String formats the findings one per line
+func (f Findings) String() string {
+	lines := make([]string, len(f))
+	for i, finding := range f {
+		lines[i] = finding.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Rule checks a message for one kind of problem
+type Rule struct {
+	// ID names the rule in findings
+	ID string
+	// Severity is the severity of the findings of the rule
+	Severity Severity
+	// Check returns a description of every problem found
+	Check func(msg *models.Message) []string
+}
+
+// ErrNoSource is returned by Lint for messages without a MIME source, such
+// as messages listed WithoutSources
+var ErrNoSource = errors.New("message has no source")
+
+// DefaultMaxHTMLSize is the encoded HTML body size above which Gmail clips
+// messages
+const DefaultMaxHTMLSize = 102 * 1024
+
+// config holds the settings of a lint run
+type config struct {
+	bulk        bool
+	maxHTMLSize int
+	disabled    map[string]bool
+	extra       []Rule
+}
+
+// Option configures a lint run
+type Option func(*config)
+
+// AsBulk treats the message as bulk mail, requiring unsubscribe headers
+// even if it has no Precedence or List-Id header
+func AsBulk() Option {
+	return func(c *config) {
+		c.bulk = true
+	}
+}
+
+// WithMaxHTMLSize sets the encoded HTML body size in bytes above which RuleHTMLSize
+// reports the message. It defaults to DefaultMaxHTMLSize.
+func WithMaxHTMLSize(size int) Option {
+	return func(c *config) {
+		c.maxHTMLSize = size
+	}
+}
+
+// Without disables the rules with the given IDs
+func Without(ids ...string) Option {
+	return func(c *config) {
+		for _, id := range ids {
+			c.disabled[id] = true
+		}
+	}
+}
+
+// WithRules runs additional rules after the built-in ones
+func WithRules(rules ...Rule) Option {
+	return func(c *config) {
+		c.extra = append(c.extra, rules...)
+	}
+}
+
+// Lint runs the built-in rules and any added with WithRules against the
+// message. It fails only if the message has no source or cannot be parsed.
+func Lint(msg *models.Message, opts ...Option) (Findings, error) {
+	c := &config{maxHTMLSize: DefaultMaxHTMLSize, disabled: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := msg.LoadParts(); err != nil {
+		return nil, fmt.Errorf("parsing message %s: %w", msg.ID, err)
+	}
+	if msg.MIME == nil {
+		return nil, ErrNoSource
+	}
+
+	var findings Findings
+	for _, rule := range append(c.rules(), c.extra...) {
+		if c.disabled[rule.ID] {
+			continue
+		}
+		for _, problem := range rule.Check(msg) {
+			findings = append(findings, Finding{Rule: rule.ID, Severity: rule.Severity, Message: problem})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,167 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/models"
+)
+
+const cleanHeader = "From: app@example.com\r\nTo: user@example.com\r\nSubject: Welcome\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nMessage-ID: <welcome-1@example.com>\r\n"
+
+func alternative(header, plain, html string) string {
+	return header + "Content-Type: multipart/alternative; boundary=B\r\n\r\n" +
+		"--B\r\nContent-Type: text/plain\r\n\r\n" + plain + "\r\n" +
+		"--B\r\nContent-Type: text/html\r\n\r\n" + html + "\r\n--B--\r\n"
+}
+
+// fetch serves the source as message 1 and fetches it through the client
+func fetch(t *testing.T, source string) *models.Message {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(models.APIMessage{ID: 1, Source: source, Size: len(source)})
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: json.RawMessage(data)}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	msg, err := sendria.NewClient(server.URL).GetMessage("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return msg
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	html := `<p>Hi, <a href="https://example.com/verify">verify your email</a> at ` +
+		`<a href="https://www.example.com/account">example.com/account</a>.</p><img src="cid:logo" alt="">`
+
+	tests := []struct {
+		name   string
+		source string
+		opts   []Option
+		want   []string
+	}{
+		{
+			name:   "clean",
+			source: alternative(cleanHeader, "Hi, verify your email: https://example.com/verify", html),
+		},
+		{
+			name:   "missing and invalid headers",
+			source: "Subject: x\r\nDate: yesterday\r\nContent-Type: text/plain\r\n\r\nHello\r\n",
+			want:   []string{RuleMissingDate, RuleMissingMessageID},
+		},
+		{
+			name: "html only",
+			source: cleanHeader + "Content-Type: text/html\r\n\r\n" +
+				`<img src="https://example.com/logo.png"><a href="http://example.com/a">https://paypal.com/login</a>` +
+				`<a href="https://tracking.example.net/c/1">report.pdf</a><div style="background:url('http://example.com/bg.png')"></div>`,
+			want: []string{RuleNoPlainText, RuleImageAlt, RuleLinkText, RuleMixedContent, RuleMixedContent},
+		},
+		{
+			name:   "long lines",
+			source: cleanHeader + "X-Long: " + strings.Repeat("a", 80) + "\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("b", 999) + "\r\n",
+			want:   []string{RuleHeaderLineFolding, RuleBodyLineLength},
+		},
+		{
+			name:   "bulk without unsubscribe",
+			source: cleanHeader + "Precedence: bulk\r\nContent-Type: text/plain\r\n\r\nNews\r\n",
+			want:   []string{RuleListUnsubscribe},
+		},
+		{
+			name:   "unsubscribe without one-click",
+			source: cleanHeader + "List-Unsubscribe: <mailto:unsubscribe@example.com>\r\nContent-Type: text/plain\r\n\r\nNews\r\n",
+			want:   []string{RuleListUnsubscribePost, RuleListUnsubscribePost},
+		},
+		{
+			name: "one-click unsubscribe",
+			source: cleanHeader + "List-Unsubscribe: <https://example.com/u/1>, <mailto:u@example.com>\r\n" +
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\nContent-Type: text/plain\r\n\r\nNews\r\n",
+			opts: []Option{AsBulk()},
+		},
+		{
+			name:   "html size",
+			source: alternative(cleanHeader, "Hi, verify your email: https://example.com/verify", html),
+			opts:   []Option{WithMaxHTMLSize(100)},
+			want:   []string{RuleHTMLSize},
+		},
+		{
+			name: "encoded html size",
+			source: cleanHeader + "Content-Type: multipart/alternative; boundary=B\r\n\r\n" +
+				"--B\r\nContent-Type: text/plain\r\n\r\nHi\r\n" +
+				"--B\r\nContent-Type: text/html\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"<p>" + strings.Repeat("=3D", 40) + "</p>\r\n--B--\r\n",
+			opts: []Option{WithMaxHTMLSize(100)},
+			want: []string{RuleHTMLSize},
+		},
+		{
+			name:   "disabled and custom rules",
+			source: "Subject: x\r\nContent-Type: text/plain\r\n\r\nHello\r\n",
+			opts: []Option{
+				Without(RuleMissingDate, RuleMissingMessageID),
+				WithRules(Rule{ID: "subject", Severity: SeverityInfo, Check: func(msg *models.Message) []string {
+					return []string{"subject is short"}
+				}}),
+			},
+			want: []string{"subject"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			findings, err := Lint(fetch(t, tt.source), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var rules []string
+			for _, f := range findings {
+				rules = append(rules, f.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("expected findings of %v, got\n%s", tt.want, findings)
+			}
+		})
+	}
+}
+
+func TestFindings(t *testing.T) {
+	t.Parallel()
+
+	findings := Findings{
+		{Rule: RuleHeaderLineFolding, Severity: SeverityInfo, Message: "line 1"},
+		{Rule: RuleMissingDate, Severity: SeverityError, Message: "Date header is missing"},
+	}
+	if got := findings.AtLeast(SeverityWarning).String(); got != "error [missing-date] Date header is missing" {
+		t.Errorf("unexpected findings %q", got)
+	}
+
+	data, err := json.Marshal(findings[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `{"rule":"missing-date","severity":"error","message":"Date header is missing"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
+
+func TestLintWithoutSource(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Lint(&models.Message{ID: "1"}); !errors.Is(err, ErrNoSource) {
+		t.Errorf("expected ErrNoSource, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package lint
+
+import (
+	"fmt"
+	"html"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// Line length limits of RFC 5322 section 2.1.1, excluding the CRLF
+const (
+	maxLineLength         = 998
+	recommendedLineLength = 78
+)
+
+var (
+	// messageIDPattern matches a msg-id of RFC 5322, "<left@right>"
+	messageIDPattern = regexp.MustCompile(`^<[^<>@\s]+@[^<>@\s]+>$`)
+	imgPattern       = regexp.MustCompile(`(?is)<img\b([^>]*)>`)
+	anchorPattern    = regexp.MustCompile(`(?is)<a\b([^>]*)>(.*?)</a\s*>`)
+	attrPattern      = regexp.MustCompile(`(?is)([a-z][a-z0-9-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// hostLikePattern matches link texts that read like a URL or domain
+	hostLikePattern = regexp.MustCompile(`(?i)^(?:https?://)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+([a-z]{2,})(?::\d+)?(?:[/?#]\S*)?$`)
+	// insecurePattern matches http URLs in attributes and CSS url()
+	insecurePattern = regexp.MustCompile(`(?i)(?:\b(?:href|src|background)\s*=\s*["']?|url\(\s*["']?)(http://[^\s"'<>)]+)`)
+)
+
+// fileExtensions are suffixes of link texts that name files, not domains
+var fileExtensions = map[string]bool{
+	"htm": true, "html": true, "php": true, "pdf": true, "txt": true, "csv": true, "zip": true,
+	"doc": true, "docx": true, "xls": true, "xlsx": true, "png": true, "jpg": true, "gif": true,
+}
+
+// rules returns the built-in rules in the order they run
+func (c *config) rules() []Rule {
+	return []Rule{
+		{ID: RuleMissingDate, Severity: SeverityError, Check: checkDate},
+		{ID: RuleMissingMessageID, Severity: SeverityError, Check: checkMessageID},
+		{ID: RuleNoPlainText, Severity: SeverityWarning, Check: checkPlainText},
+		{ID: RuleHeaderLineLength, Severity: SeverityError, Check: checkHeaderLines(maxLineLength)},
+		{ID: RuleHeaderLineFolding, Severity: SeverityInfo, Check: checkHeaderLines(recommendedLineLength)},
+		{ID: RuleBodyLineLength, Severity: SeverityError, Check: checkBodyLines},
+		{ID: RuleListUnsubscribe, Severity: SeverityError, Check: c.checkListUnsubscribe},
+		{ID: RuleListUnsubscribePost, Severity: SeverityWarning, Check: checkListUnsubscribePost},
+		{ID: RuleHTMLSize, Severity: SeverityWarning, Check: c.checkHTMLSize},
+		{ID: RuleImageAlt, Severity: SeverityWarning, Check: checkImageAlt},
+		{ID: RuleLinkText, Severity: SeverityWarning, Check: checkLinkText},
+		{ID: RuleMixedContent, Severity: SeverityWarning, Check: checkMixedContent},
+	}
+}
+
+func checkDate(msg *models.Message) []string {
+	date := msg.Header().Get("Date")
+	if date == "" {
+		return []string{"Date header is missing"}
+	}
+	if _, err := mail.ParseDate(date); err != nil {
+		return []string{fmt.Sprintf("Date header %q is invalid: %v", date, err)}
+	}
+	return nil
+}
+
+func checkMessageID(msg *models.Message) []string {
+	id := strings.TrimSpace(msg.Header().Get("Message-Id"))
+	if id == "" {
+		return []string{"Message-ID header is missing"}
+	}
+	if !messageIDPattern.MatchString(id) {
+		return []string{fmt.Sprintf("Message-ID header %q is not of the form <left@right>", id)}
+	}
+	return nil
+}
+
+func checkPlainText(msg *models.Message) []string {
+	if htmlBody(msg) == nil {
+		return nil
+	}
+	if plain := msg.PreferredBody("text/plain"); plain == nil || plain.ContentType != "text/plain" {
+		return []string{"html body has no text/plain alternative"}
+	}
+	return nil
+}
+
+// checkHeaderLines returns a check for header lines longer than limit
+func checkHeaderLines(limit int) func(msg *models.Message) []string {
+	return func(msg *models.Message) []string {
+		header, _ := splitSource(msg.Source)
+		var problems []string
+		field := ""
+		for i, line := range header {
+			if name, _, ok := strings.Cut(line, ":"); ok && line[0] != ' ' && line[0] != '\t' {
+				field = name
+			}
+			if len(line) > limit {
+				problems = append(problems, fmt.Sprintf("line %d (%s header) has %d characters, more than %d", i+1, field, len(line), limit))
+			}
+		}
+		return problems
+	}
+}
+
+func checkBodyLines(msg *models.Message) []string {
+	header, body := splitSource(msg.Source)
+	var problems []string
+	for i, line := range body {
+		if len(line) > maxLineLength {
+			// The header and the blank line separating it precede the body
+			problems = append(problems, fmt.Sprintf("line %d of the body has %d characters, more than %d", len(header)+2+i, len(line), maxLineLength))
+		}
+	}
+	return problems
+}
+
+// splitSource splits the source into the lines of the message header and
+// of the body, without line endings
+func splitSource(source string) (header, body []string) {
+	lines := strings.Split(source, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	for i, line := range lines {
+		if line == "" {
+			return lines[:i], lines[i+1:]
+		}
+	}
+	return lines, nil
+}
+
+// isBulk reports whether the message is marked as bulk or mailing list mail
+func (c *config) isBulk(msg *models.Message) bool {
+	switch strings.ToLower(strings.TrimSpace(msg.Header().Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		return true
+	}
+	return c.bulk || msg.Header().Get("List-Id") != ""
+}
+
+func (c *config) checkListUnsubscribe(msg *models.Message) []string {
+	if c.isBulk(msg) && msg.Header().Get("List-Unsubscribe") == "" {
+		return []string{"bulk mail has no List-Unsubscribe header"}
+	}
+	return nil
+}
+
+// checkListUnsubscribePost checks messages with a List-Unsubscribe header
+// support one-click unsubscription (RFC 8058)
+func checkListUnsubscribePost(msg *models.Message) []string {
+	unsubscribe := msg.Header().Get("List-Unsubscribe")
+	if unsubscribe == "" {
+		return nil
+	}
+
+	var problems []string
+	if !strings.Contains(strings.ToLower(unsubscribe), "<https://") {
+		problems = append(problems, "List-Unsubscribe has no https URI for one-click unsubscription")
+	}
+	switch post := msg.Header().Get("List-Unsubscribe-Post"); {
+	case post == "":
+		problems = append(problems, "List-Unsubscribe-Post header is missing")
+	case !strings.EqualFold(strings.TrimSpace(post), "List-Unsubscribe=One-Click"):
+		problems = append(problems, fmt.Sprintf("List-Unsubscribe-Post header is %q, not \"List-Unsubscribe=One-Click\"", post))
+	}
+	return problems
+}
+
+func (c *config) checkHTMLSize(msg *models.Message) []string {
+	// Gmail clips on the size as transmitted, before decoding the transfer
+	// encoding
+	body := htmlBody(msg)
+	if body == nil || body.Size <= c.maxHTMLSize {
+		return nil
+	}
+	return []string{fmt.Sprintf("html body has %d encoded bytes, Gmail clips html bodies over %d bytes", body.Size, c.maxHTMLSize)}
+}
+
+func checkImageAlt(msg *models.Message) []string {
+	body := htmlBody(msg)
+	if body == nil {
+		return nil
+	}
+	var problems []string
+	for _, match := range imgPattern.FindAllStringSubmatch(body.Text(), -1) {
+		attrs := parseAttrs(match[1])
+		if _, ok := attrs["alt"]; !ok {
+			problems = append(problems, fmt.Sprintf("image %q has no alt text", attrs["src"]))
+		}
+	}
+	return problems
+}
+
+// checkLinkText reports links whose text reads like a URL or domain other
+// than the one the link leads to, which spam filters treat as phishing
+func checkLinkText(msg *models.Message) []string {
+	body := htmlBody(msg)
+	if body == nil {
+		return nil
+	}
+	var problems []string
+	for _, match := range anchorPattern.FindAllStringSubmatch(body.Text(), -1) {
+		href := strings.TrimSpace(parseAttrs(match[1])["href"])
+		text := strings.TrimSpace(models.HTMLToText(match[2]))
+		textMatch := hostLikePattern.FindStringSubmatch(text)
+		if textMatch == nil || fileExtensions[strings.ToLower(textMatch[1])] {
+			continue
+		}
+		target, err := url.Parse(href)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			continue
+		}
+		if textHost := hostOf(text); textHost != "" && textHost != normalizeHost(target.Hostname()) {
+			problems = append(problems, fmt.Sprintf("link text %q leads to %s", text, href))
+		}
+	}
+	return problems
+}
+
+// hostOf returns the normalized host of a URL or domain
+func hostOf(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u.Hostname())
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+func checkMixedContent(msg *models.Message) []string {
+	body := htmlBody(msg)
+	if body == nil {
+		return nil
+	}
+	var problems []string
+	seen := make(map[string]bool)
+	for _, match := range insecurePattern.FindAllStringSubmatch(body.Text(), -1) {
+		u := html.UnescapeString(match[1])
+		if !seen[u] {
+			seen[u] = true
+			problems = append(problems, fmt.Sprintf("%s is not https", u))
+		}
+	}
+	return problems
+}
+
+// htmlBody returns the preferred HTML body of the message, or nil
+func htmlBody(msg *models.Message) *models.MIMENode {
+	if body := msg.PreferredBody("text/html"); body != nil && body.ContentType == "text/html" {
+		return body
+	}
+	return nil
+}
+
+// parseAttrs parses the attributes of a tag, keeping the first of repeated
+// attributes
+func parseAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attrPattern.FindAllStringSubmatch(s, -1) {
+		name := strings.ToLower(match[1])
+		if _, ok := attrs[name]; !ok {
+			attrs[name] = html.UnescapeString(match[2] + match[3] + match[4])
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,111 @@
+package sendria
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WithLogger sets the logger for structured request, parse and retry events.
+// Successful requests are logged at debug level, failures and parse warnings
+// at warn level. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// Logger returns the logger of the client. It never returns nil; without
+// WithLogger the returned logger discards all records.
+func (c *Client) Logger() *slog.Logger {
+	if c == nil || c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// discardLogger drops all records
+var discardLogger = slog.New(discardHandler{})
+
+// discardHandler is a slog.Handler that is never enabled
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// loggingTransport logs every round trip. It sits below the middleware chain,
+// so requests retried by middleware are logged once per attempt.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+// RoundTrip performs the request and logs it once the response body is closed
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logger.LogAttrs(req.Context(), slog.LevelWarn, "sendria request failed",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	resp.Body = &loggedBody{ReadCloser: resp.Body, transport: t, req: req, status: resp.StatusCode, start: start}
+	return resp, nil
+}
+
+// loggedBody counts the bytes read from a response body and logs the request
+// when the body is closed
+type loggedBody struct {
+	io.ReadCloser
+	transport *loggingTransport
+	req       *http.Request
+	status    int
+	start     time.Time
+	bytes     int64
+	logged    bool
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+// Write passes through to the body of protocol upgrades, which is writable
+func (b *loggedBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, io.ErrClosedPipe
+	}
+	return w.Write(p)
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.logged {
+		return err
+	}
+	b.logged = true
+
+	level := slog.LevelDebug
+	if b.status >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+	b.transport.logger.LogAttrs(b.req.Context(), level, "sendria request",
+		slog.String("method", b.req.Method),
+		slog.String("path", b.req.URL.Path),
+		slog.Int("status", b.status),
+		slog.Duration("duration", time.Since(b.start)),
+		slog.Int64("bytes", b.bytes),
+	)
+	return err
+}
@@ -0,0 +1,91 @@
+package sendria
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+func TestWithLogger(t *testing.T) {
+	t.Parallel()
+
+	source := "From: a@example.com\r\nTo: b@example.com\r\nSubject: Hi\r\n" +
+		"Content-Type: text/plain; charset=koi8-r\r\n\r\nHello\r\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/messages/1.json" {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := json.Marshal(models.APIMessage{ID: 1, Subject: "Hi", Source: source})
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewClient(server.URL, WithLogger(logger))
+
+	if _, err := client.GetMessage("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.GetMessageSource("2"); err == nil {
+		t.Fatal("expected error for missing message")
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	byMsg := map[string]map[string]interface{}{}
+	for _, record := range records {
+		key := record["msg"].(string)
+		if key == "sendria request" {
+			key += " " + record["path"].(string)
+		}
+		byMsg[key] = record
+	}
+
+	ok := byMsg["sendria request /api/messages/1.json"]
+	if ok == nil || ok["level"] != "DEBUG" || ok["method"] != "GET" || ok["status"] != float64(200) {
+		t.Errorf("unexpected request record %v", ok)
+	}
+	if ok != nil && (ok["bytes"] == float64(0) || ok["duration"] == nil) {
+		t.Errorf("expected bytes and duration, got %v", ok)
+	}
+
+	notFound := byMsg["sendria request /api/messages/2.source"]
+	if notFound == nil || notFound["level"] != "WARN" || notFound["status"] != float64(404) {
+		t.Errorf("unexpected failed request record %v", notFound)
+	}
+
+	charset := byMsg["unknown charset, body is not converted to UTF-8"]
+	if charset == nil || charset["charset"] != "koi8-r" || charset["message_id"] != "1" {
+		t.Errorf("unexpected charset warning %v", charset)
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("")
+	if client.Logger() == nil {
+		t.Fatal("expected a non-nil logger")
+	}
+	if _, ok := client.httpClient.Transport.(*loggingTransport); ok {
+		t.Error("expected no logging transport without WithLogger")
+	}
+}
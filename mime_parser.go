@@ -1,180 +1,739 @@
 package sendria
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime"
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/enthus-golang/sendria/models"
 )
 
-// parseMIMEMessage parses the raw email source into parts and attachments
-func parseMIMEMessage(source string) ([]models.Part, []models.Attachment, error) {
-	// Parse the email message
-	msg, err := mail.ReadMessage(strings.NewReader(source))
+// maxEmbeddedDepth limits how deep message/rfc822 entities are parsed
+const maxEmbeddedDepth = 8
+
+// parseSource parses the raw email source into its MIME tree and the flat
+// parts and attachments. It fails on sources that are not valid messages.
+func parseSource(source string, logger *slog.Logger) (*models.ParsedSource, error) {
+	return (&mimeParser{logger: logger}).parse(source)
+}
+
+// mimeParser parses MIME sources and records the problems it recovers from
+type mimeParser struct {
+	logger   *slog.Logger
+	lenient  bool
+	keys     *models.SecurityKeys
+	warnings []models.ParseWarning
+}
+
+// rawPart is an entity of a multipart body before it is parsed
+type rawPart struct {
+	// header is nil if it has not been split from the content yet
+	header  textproto.MIMEHeader
+	content []byte
+	// closed reports whether the close delimiter follows the part
+	closed bool
+}
+
+// parse parses a message source
+func (p *mimeParser) parse(source string) (*models.ParsedSource, error) {
+	if strings.Contains(strings.ReplaceAll(source, "\r\n", ""), "\n") {
+		p.warn(models.WarningBareLF, "", "lines end in bare LF instead of CRLF")
+	}
+
+	parsed, err := p.parseAt(source, "", 0)
 	if err != nil {
-		return nil, nil, fmt.Errorf("parsing email message: %w", err)
+		return nil, err
 	}
+	parsed.Warnings = p.warnings
+	return parsed, nil
+}
+
+// warn logs a recovered problem and records it as a ParseWarning
+func (p *mimeParser) warn(code models.ParseWarningCode, path, msg string, attrs ...slog.Attr) {
+	details := make([]string, 0, len(attrs))
+	args := make([]any, 0, len(attrs)+2)
+	for _, attr := range attrs {
+		details = append(details, attr.String())
+		args = append(args, attr)
+	}
+	args = append(args, slog.String("warning", string(code)))
+	if path != "" {
+		args = append(args, slog.String("part", path))
+	}
+	p.logger.Warn(msg, args...)
+
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	p.warnings = append(p.warnings, models.ParseWarning{Code: code, Path: path, Message: msg})
+}
+
+// parseAt parses a message embedded at the part path, depth levels deep
+func (p *mimeParser) parseAt(source, path string, depth int) (*models.ParsedSource, error) {
+	header, body, err := p.readMessage(source, path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &models.ParsedSource{
+		MIME: &models.MIMENode{Header: header},
+	}
+	root := parsed.MIME
 
 	// Get content type
-	contentType := msg.Header.Get("Content-Type")
+	contentType := header.Get("Content-Type")
 	if contentType == "" {
 		// Simple message with no MIME parts
-		body, err := io.ReadAll(msg.Body)
-		if err != nil {
-			return nil, nil, fmt.Errorf("reading message body: %w", err)
-		}
-
-		part := models.Part{
+		root.ContentType = "text/plain"
+		root.Size = len(body)
+		root.SetBody(body)
+		parsed.Parts = append(parsed.Parts, models.Part{
 			Type:        "text/plain",
 			ContentType: "text/plain",
 			Body:        string(body),
 			Size:        len(body),
-		}
-
-		return []models.Part{part}, nil, nil
+		})
+		return parsed, nil
 	}
 
 	// Parse the content type
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return nil, nil, fmt.Errorf("parsing content type: %w", err)
+		if !p.lenient {
+			return nil, fmt.Errorf("parsing content type: %w", err)
+		}
+		mediaType, params = p.salvageMediaType(contentType, err, path)
 	}
-
-	var parts []models.Part
-	var attachments []models.Attachment
+	root.ContentType, root.Params = mediaType, params
+	describeEntity(root, root.Header)
 
 	if strings.HasPrefix(mediaType, "multipart/") {
 		// Handle multipart messages
-		mr := multipart.NewReader(msg.Body, params["boundary"])
-		if err := parseMultipart(mr, &parts, &attachments); err != nil {
-			return nil, nil, fmt.Errorf("parsing multipart message: %w", err)
-		}
-	} else {
-		// Single part message
-		body, err := io.ReadAll(msg.Body)
+		parts, err := p.multipartParts(root, body, path)
 		if err != nil {
-			return nil, nil, fmt.Errorf("reading message body: %w", err)
+			return nil, fmt.Errorf("parsing multipart message: %w", err)
 		}
+		if parts != nil {
+			if _, err := p.parseParts(parts, root, params["boundary"], false, parsed, path, depth); err != nil {
+				return nil, fmt.Errorf("parsing multipart message: %w", err)
+			}
+			p.unwrapSecurity(parsed, body, path, depth)
+			return parsed, nil
+		}
+		mediaType, contentType = "text/plain", "text/plain"
+		root.ContentType = mediaType
+	}
 
-		// Decode if needed
-		encoding := msg.Header.Get("Content-Transfer-Encoding")
-		content := decodeContent(body, encoding)
+	// Single part message
+	content := p.decodeContent(body, header.Get("Content-Transfer-Encoding"), path)
+	p.checkCharset(params["charset"], path)
 
-		part := models.Part{
-			Type:        mediaType,
-			ContentType: contentType,
-			Body:        content,
-			Size:        len(content),
+	root.Size = len(body)
+	root.SetBody([]byte(content))
+	parsed.Parts = append(parsed.Parts, models.Part{
+		Type:        mediaType,
+		ContentType: contentType,
+		Body:        content,
+		Size:        len(content),
+	})
+	p.unwrapSecurity(parsed, body, path, depth)
+	return parsed, nil
+}
+
+// readMessage splits a message source into its header and body
+func (p *mimeParser) readMessage(source, path string) (textproto.MIMEHeader, []byte, error) {
+	if p.lenient {
+		header, body := p.readHeaderLenient([]byte(source), path)
+		return header, body, nil
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(source))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing email message: %w", err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading message body: %w", err)
+	}
+	header := textproto.MIMEHeader(msg.Header)
+	p.checkHeader(header, path)
+	return header, body, nil
+}
+
+// readHeaderLenient splits an entity into its header and body. The header
+// ends at the first blank line, or at the first line that is neither a field
+// nor a continuation line.
+func (p *mimeParser) readHeaderLenient(data []byte, path string) (textproto.MIMEHeader, []byte) {
+	header := make(textproto.MIMEHeader)
+	var key, value string
+	flush := func() {
+		if key != "" {
+			header.Add(key, value)
+		}
+		key = ""
+	}
+
+	rest := data
+	for len(rest) > 0 {
+		line, next, found := bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			rest = next
+			break
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if key == "" {
+				p.warn(models.WarningMalformedHeader, path, "continuation line without a field, skipping it")
+			} else {
+				value += " " + strings.TrimSpace(string(line))
+			}
+		} else if k, v, ok := cutField(line); ok {
+			flush()
+			key, value = textproto.CanonicalMIMEHeaderKey(k), strings.TrimSpace(v)
+		} else {
+			p.warn(models.WarningMalformedHeader, path, "header does not end in a blank line, treating the rest as body",
+				slog.String("line", truncate(string(line), 40)))
+			break
+		}
+
+		rest = next
+		if !found {
+			p.warn(models.WarningTruncated, path, "source ends within the header")
+		}
+	}
+	flush()
+
+	p.checkHeader(header, path)
+	return header, rest
+}
+
+// cutField splits a header line into its field name and value
+func cutField(line []byte) (string, string, bool) {
+	name, value, found := bytes.Cut(line, []byte(":"))
+	name = bytes.TrimRight(name, " \t")
+	if !found || len(name) == 0 {
+		return "", "", false
+	}
+	for _, c := range name {
+		if c < '!' || c > '~' {
+			return "", "", false
+		}
+	}
+	return string(name), string(value), true
+}
+
+// checkHeader warns about unencoded 8-bit characters in the header. In
+// lenient mode, values that are not valid UTF-8 are decoded as Latin-1.
+func (p *mimeParser) checkHeader(header textproto.MIMEHeader, path string) {
+	var fields []string
+	for key, values := range header {
+		for i, value := range values {
+			if !hasEightBit(value) {
+				continue
+			}
+			fields = append(fields, key)
+			if p.lenient && !utf8.ValidString(value) {
+				values[i] = latin1ToUTF8(value)
+			}
+		}
+	}
+	if len(fields) > 0 {
+		sort.Strings(fields)
+		p.warn(models.WarningEightBitHeader, path, "header contains unencoded 8-bit characters",
+			slog.String("fields", strings.Join(fields, ", ")))
+	}
+}
+
+// hasEightBit reports whether s contains bytes outside of US-ASCII
+func hasEightBit(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return true
 		}
+	}
+	return false
+}
 
-		parts = append(parts, part)
+// latin1ToUTF8 converts an ISO-8859-1 string to UTF-8
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
 	}
+	return string(runes)
+}
 
-	return parts, attachments, nil
+// salvageMediaType recovers the media type and parameters of a malformed
+// Content-Type, defaulting to text/plain
+func (p *mimeParser) salvageMediaType(contentType string, err error, path string) (string, map[string]string) {
+	mediaType, rawParams, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if !p.lenient || !strings.Contains(mediaType, "/") {
+		p.warn(models.WarningMalformedContentType, path, "malformed content type, treating it as text/plain",
+			slog.String("content_type", contentType), slog.String("error", err.Error()))
+		return "text/plain", make(map[string]string)
+	}
+
+	p.warn(models.WarningMalformedContentType, path, "malformed content type parameters, salvaging them",
+		slog.String("content_type", contentType), slog.String("error", err.Error()))
+	params := make(map[string]string)
+	for _, param := range strings.Split(rawParams, ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if key = strings.ToLower(strings.TrimSpace(key)); ok && key != "" {
+			params[key] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return mediaType, params
 }
 
-// parseMultipart recursively parses multipart messages
-func parseMultipart(mr *multipart.Reader, parts *[]models.Part, attachments *[]models.Attachment) error {
+// multipartParts splits the body of a multipart entity into its parts. In
+// lenient mode, a missing boundary parameter is guessed from the body, and
+// nil parts are returned if the body has no boundary, so that it is kept as
+// a text/plain leaf.
+func (p *mimeParser) multipartParts(node *models.MIMENode, body []byte, path string) ([]rawPart, error) {
+	boundary := node.Params["boundary"]
+	if !p.lenient {
+		return readParts(body, boundary)
+	}
+
+	if boundary == "" {
+		boundary = guessBoundary(body)
+		if boundary == "" {
+			p.warn(models.WarningMissingBoundary, path, "multipart entity has no boundary, treating it as text/plain")
+			return nil, nil
+		}
+		p.warn(models.WarningMissingBoundary, path, "multipart entity has no boundary parameter, using the first delimiter line",
+			slog.String("boundary", boundary))
+		node.Params["boundary"] = boundary
+	}
+
+	parts := p.splitParts(body, boundary, path)
+	if parts == nil {
+		p.warn(models.WarningMissingBoundary, path, "boundary does not occur in the body, treating it as text/plain",
+			slog.String("boundary", boundary))
+	}
+	return parts, nil
+}
+
+// readParts splits a multipart body with a multipart.Reader
+func readParts(body []byte, boundary string) ([]rawPart, error) {
+	var parts []rawPart
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
 	for {
-		p, err := mr.NextPart()
+		part, err := mr.NextRawPart()
 		if err == io.EOF {
-			break
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading part: %w", err)
 		}
+
+		// Read the part content
+		content, err := io.ReadAll(part)
 		if err != nil {
-			return fmt.Errorf("reading part: %w", err)
+			return nil, fmt.Errorf("reading part content: %w", err)
+		}
+		parts = append(parts, rawPart{header: part.Header, content: content})
+	}
+}
+
+// guessBoundary returns the boundary of the first line that looks like a
+// delimiter line, or an empty string
+func guessBoundary(body []byte) string {
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimRight(line, " \t\r")
+		if len(line) > 2 && bytes.HasPrefix(line, []byte("--")) && !bytes.ContainsAny(line, " \t") {
+			return string(bytes.TrimSuffix(line[2:], []byte("--")))
 		}
+	}
+	return ""
+}
+
+// splitParts splits a multipart body at its delimiter lines, which may end
+// in CRLF or bare LF. Delimiters following a close delimiter start further
+// parts, so that entities reusing the boundary of their parent are kept. It
+// returns nil if the body contains no delimiter.
+func (p *mimeParser) splitParts(body []byte, boundary, path string) []rawPart {
+	delimiter := []byte("--" + boundary)
+
+	var parts []rawPart
+	start := -1
+	for pos := 0; pos < len(body); {
+		lineEnd := len(body)
+		if i := bytes.IndexByte(body[pos:], '\n'); i >= 0 {
+			lineEnd = pos + i + 1
+		}
+		line := bytes.TrimRight(body[pos:lineEnd], " \t\r\n")
+
+		if suffix, ok := bytes.CutPrefix(line, delimiter); ok && (len(suffix) == 0 || string(suffix) == "--") {
+			closed := len(suffix) > 0
+			if start >= 0 {
+				parts = append(parts, rawPart{content: body[start:trimLineBreak(body, start, pos)], closed: closed})
+			}
+			start = lineEnd
+			if closed {
+				start = -1
+			}
+		}
+		pos = lineEnd
+	}
+
+	if start >= 0 {
+		p.warn(models.WarningTruncated, path, "multipart body ends without its close delimiter")
+		parts = append(parts, rawPart{content: body[start:], closed: true})
+	}
+	return parts
+}
 
-		contentType := p.Header.Get("Content-Type")
+// trimLineBreak returns the end of the content before a delimiter line at
+// pos, excluding the line break that belongs to the delimiter
+func trimLineBreak(body []byte, start, pos int) int {
+	if pos > start && body[pos-1] == '\n' {
+		pos--
+	}
+	if pos > start && body[pos-1] == '\r' {
+		pos--
+	}
+	return pos
+}
+
+// parseParts parses the parts of a multipart entity into the children of
+// parent, and appends the leaves to the flat parts and attachments. If
+// untilClosed is set, parsing stops after the part followed by the close
+// delimiter. It returns the number of parts consumed.
+func (p *mimeParser) parseParts(parts []rawPart, parent *models.MIMENode, boundary string, untilClosed bool, parsed *models.ParsedSource, path string, depth int) (int, error) {
+	i := 0
+	for i < len(parts) {
+		part := parts[i]
+		i++
+		partPath := childPath(path, len(parent.Children)+1)
+		if part.header == nil {
+			part.header, part.content = p.readHeaderLenient(part.content, partPath)
+		}
+
+		contentType := part.header.Get("Content-Type")
 		if contentType == "" {
 			contentType = "text/plain"
 		}
 
 		mediaType, params, err := mime.ParseMediaType(contentType)
 		if err != nil {
-			// Default to text/plain if parsing fails
-			mediaType = "text/plain"
-			params = make(map[string]string)
+			mediaType, params = p.salvageMediaType(contentType, err, partPath)
 		}
 
-		// Read the part content
-		partContent, err := io.ReadAll(p)
-		if err != nil {
-			return fmt.Errorf("reading part content: %w", err)
+		node := &models.MIMENode{
+			ContentType: mediaType,
+			Params:      params,
+			Header:      part.header,
+			Size:        len(part.content),
 		}
+		describeEntity(node, part.header)
+		parent.Children = append(parent.Children, node)
 
 		// Handle nested multipart
 		if strings.HasPrefix(mediaType, "multipart/") {
-			nestedReader := multipart.NewReader(bytes.NewReader(partContent), params["boundary"])
-			if err := parseMultipart(nestedReader, parts, attachments); err != nil {
-				return fmt.Errorf("parsing nested multipart: %w", err)
+			if p.lenient && params["boundary"] == boundary && len(bytes.TrimSpace(part.content)) == 0 {
+				// The parts of an entity reusing the boundary follow it
+				// up to the close delimiter
+				p.warn(models.WarningDuplicateBoundary, partPath, "multipart entity reuses the boundary of its parent",
+					slog.String("boundary", boundary))
+				if !part.closed {
+					n, err := p.parseParts(parts[i:], node, boundary, true, parsed, partPath, depth)
+					if err != nil {
+						return i, err
+					}
+					i += n
+				}
+			} else {
+				nested, err := p.multipartParts(node, part.content, partPath)
+				if err != nil {
+					return i, fmt.Errorf("parsing nested multipart: %w", err)
+				}
+				if nested != nil {
+					if _, err := p.parseParts(nested, node, node.Params["boundary"], false, parsed, partPath, depth); err != nil {
+						return i, fmt.Errorf("parsing nested multipart: %w", err)
+					}
+				} else {
+					mediaType, contentType = "text/plain", "text/plain"
+					node.ContentType = mediaType
+					p.parseLeaf(node, part, mediaType, contentType, parsed, partPath, depth)
+				}
 			}
-			continue
+		} else {
+			p.parseLeaf(node, part, mediaType, contentType, parsed, partPath, depth)
+		}
+
+		if untilClosed && part.closed {
+			break
 		}
+	}
+
+	return i, nil
+}
 
-		// Get content disposition
-		disposition := p.Header.Get("Content-Disposition")
-		filename := p.FileName()
-		contentID := p.Header.Get("Content-ID")
+// parseLeaf decodes the content of a leaf part and appends it to the flat
+// parts or attachments
+func (p *mimeParser) parseLeaf(node *models.MIMENode, part rawPart, mediaType, contentType string, parsed *models.ParsedSource, path string, depth int) {
+	// Decode the content
+	decodedContent := p.decodeContent(part.content, part.header.Get("Content-Transfer-Encoding"), path)
+	node.SetBody([]byte(decodedContent))
+	p.parseMessageEntity(node, path, depth)
+
+	// Check if it's an attachment. Embedded messages always are, so that
+	// forwarded emails are reachable from the attachment entry.
+	disposition := part.header.Get("Content-Disposition")
+	filename := partFileName(part.header)
+	if strings.HasPrefix(disposition, "attachment") || filename != "" || isEmbeddedMessage(mediaType) {
+		parsed.Attachments = append(parsed.Attachments, models.Attachment{
+			CID:         node.ContentID,
+			Type:        mediaType,
+			Filename:    filename,
+			ContentType: contentType,
+			Size:        len(part.content),
+			Message:     node.Message,
+		})
+		return
+	}
+
+	// It's a message part
+	p.checkCharset(node.Params["charset"], path)
+	parsed.Parts = append(parsed.Parts, models.Part{
+		Type:        mediaType,
+		ContentType: contentType,
+		Body:        decodedContent,
+		Size:        len(decodedContent),
+	})
+}
+
+// partFileName returns the filename of the Content-Disposition of a part, as
+// multipart.Part.FileName does
+func partFileName(header textproto.MIMEHeader) string {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return ""
+	}
+	return filepath.Base(params["filename"])
+}
 
-		// Clean up Content-ID (remove < and >)
-		if contentID != "" {
-			contentID = strings.Trim(contentID, "<>")
+// childPath returns the part number of the n-th child of the entity at path
+func childPath(path string, n int) string {
+	if path == "" {
+		return strconv.Itoa(n)
+	}
+	return path + "." + strconv.Itoa(n)
+}
+
+// isEmbeddedMessage reports whether entities of the media type contain a
+// complete message
+func isEmbeddedMessage(mediaType string) bool {
+	return mediaType == "message/rfc822" || mediaType == "message/global"
+}
+
+// parseMessageEntity parses the content of entities that describe another
+// message: embedded messages, their headers and delivery status reports.
+// Problems are recorded as warnings and leave the entity opaque.
+func (p *mimeParser) parseMessageEntity(node *models.MIMENode, path string, depth int) {
+	switch node.ContentType {
+	case "message/rfc822", "message/global":
+		if depth >= maxEmbeddedDepth {
+			p.warn(models.WarningUnparsedEntity, path, "embedded message nested too deeply, keeping it unparsed", slog.Int("depth", depth))
+			return
+		}
+		parsed, err := p.parseAt(string(node.Body()), path, depth+1)
+		if err != nil {
+			p.warn(models.WarningUnparsedEntity, path, "malformed embedded message, keeping it unparsed", slog.String("error", err.Error()))
+			return
 		}
+		node.Message = embeddedMessage(node.Body(), parsed)
 
-		// Check if it's an attachment
-		if strings.HasPrefix(disposition, "attachment") || filename != "" {
-			attachment := models.Attachment{
-				CID:         contentID,
-				Type:        mediaType,
-				Filename:    filename,
-				ContentType: contentType,
-				Size:        len(partContent),
-			}
-			*attachments = append(*attachments, attachment)
-		} else {
-			// It's a message part - decode content
-			encoding := p.Header.Get("Content-Transfer-Encoding")
-			decodedContent := decodeContent(partContent, encoding)
-			part := models.Part{
-				Type:        mediaType,
-				ContentType: contentType,
-				Body:        decodedContent,
-				Size:        len(decodedContent),
-			}
+	case "text/rfc822-headers", "message/global-headers":
+		header, err := readHeaderBlock(node.Body())
+		if err != nil {
+			p.warn(models.WarningUnparsedEntity, path, "malformed embedded headers, keeping them unparsed", slog.String("error", err.Error()))
+			return
+		}
+		node.Message = embeddedMessage(nil, &models.ParsedSource{MIME: &models.MIMENode{Header: header}})
 
-			*parts = append(*parts, part)
+	case "message/delivery-status", "message/global-delivery-status":
+		fields, err := parseStatusFields(node.Body())
+		if err != nil {
+			p.warn(models.WarningUnparsedEntity, path, "malformed delivery status, keeping it unparsed", slog.String("error", err.Error()))
+			return
 		}
+		node.StatusFields = fields
+	}
+}
+
+// embeddedMessage builds a message from the source and parsed content of an
+// embedded message. Its envelope fields are read from its headers.
+func embeddedMessage(source []byte, parsed *models.ParsedSource) *models.Message {
+	header := mail.Header(parsed.MIME.Header)
+	msg := &models.Message{
+		Subject:     decodeHeader(header.Get("Subject")),
+		Size:        len(source),
+		Type:        parsed.MIME.ContentType,
+		Source:      string(source),
+		Parts:       parsed.Parts,
+		Attachments: parsed.Attachments,
+		MIME:        parsed.MIME,
+		Security:    parsed.Security,
+	}
+	if date, err := header.Date(); err == nil {
+		msg.CreatedAt = date
+	}
+	msg.From = headerRecipients(header, "From")
+	msg.To = headerRecipients(header, "To")
+	return msg
+}
+
+// headerRecipients returns the addresses of an address list header
+func headerRecipients(header mail.Header, key string) []models.Recipient {
+	addrs, err := header.AddressList(key)
+	if err != nil {
+		return nil
+	}
+	recipients := make([]models.Recipient, 0, len(addrs))
+	for _, addr := range addrs {
+		recipients = append(recipients, models.Recipient{Name: addr.Name, Email: addr.Address})
+	}
+	return recipients
+}
+
+// decodeHeader decodes RFC 2047 encoded words, keeping the value as is if
+// that fails
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// readHeaderBlock parses a block of header fields that may lack the blank
+// line that ends a header
+func readHeaderBlock(block []byte) (textproto.MIMEHeader, error) {
+	block = bytes.TrimLeft(block, "\r\n")
+	r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(block), strings.NewReader("\r\n\r\n"))))
+	return r.ReadMIMEHeader()
+}
+
+// parseStatusFields splits the body of a delivery status into its field
+// groups, which are separated by blank lines (RFC 3464, section 2.1)
+func parseStatusFields(body []byte) ([]textproto.MIMEHeader, error) {
+	normalized := bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+
+	var groups []textproto.MIMEHeader
+	for _, block := range bytes.Split(normalized, []byte("\n\n")) {
+		if len(bytes.TrimSpace(block)) == 0 {
+			continue
+		}
+		header, err := readHeaderBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, header)
+	}
+	return groups, nil
+}
+
+// describeEntity fills the disposition, filename and Content-ID of a node
+// from its headers
+func describeEntity(node *models.MIMENode, header textproto.MIMEHeader) {
+	if disposition, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		node.Disposition = disposition
+		node.Filename = dispParams["filename"]
+	}
+	if node.Filename == "" {
+		node.Filename = node.Params["name"]
 	}
 
-	return nil
+	// Clean up Content-ID (remove < and >)
+	node.ContentID = strings.Trim(strings.TrimSpace(header.Get("Content-ID")), "<>")
 }
 
 // decodeContent decodes content based on transfer encoding
-func decodeContent(content []byte, encoding string) string {
-	switch strings.ToLower(encoding) {
+func (p *mimeParser) decodeContent(content []byte, encoding, path string) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
 	case "base64":
 		decoded, err := base64.StdEncoding.DecodeString(string(content))
-		if err != nil {
-			// Return original if decoding fails
-			return string(content)
+		if err == nil {
+			return string(decoded)
 		}
-		return string(decoded)
+		if p.lenient {
+			p.warn(models.WarningInvalidEncoding, path, "invalid base64 content, decoding it leniently", slog.String("error", err.Error()))
+			return string(decodeBase64Lenient(content))
+		}
+		// Return original if decoding fails
+		p.warn(models.WarningInvalidEncoding, path, "invalid base64 content, keeping it undecoded", slog.String("error", err.Error()))
+		return string(content)
 	case "quoted-printable":
 		reader := quotedprintable.NewReader(bytes.NewReader(content))
 		decoded, err := io.ReadAll(reader)
 		if err != nil {
+			if p.lenient {
+				// The reader stops at the error, keep what was decoded
+				p.warn(models.WarningInvalidEncoding, path, "invalid quoted-printable content, keeping the text decoded so far",
+					slog.String("error", err.Error()))
+				return string(decoded)
+			}
 			// Return original if decoding fails
+			p.warn(models.WarningInvalidEncoding, path, "invalid quoted-printable content, keeping it undecoded", slog.String("error", err.Error()))
 			return string(content)
 		}
 		return string(decoded)
 	default:
 		return string(content)
 	}
-}
\ No newline at end of file
+}
+
+// decodeBase64Lenient decodes base64 ignoring padding and characters outside
+// of the alphabet. A trailing incomplete quantum is dropped.
+func decodeBase64Lenient(content []byte) []byte {
+	clean := make([]byte, 0, len(content))
+	for _, c := range content {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%4 == 1 {
+		clean = clean[:len(clean)-1]
+	}
+
+	decoded, _ := base64.RawStdEncoding.DecodeString(string(clean))
+	return decoded
+}
+
+// checkCharset warns about charsets whose bodies are not converted to UTF-8
+func (p *mimeParser) checkCharset(charset, path string) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+	default:
+		p.warn(models.WarningUnknownCharset, path, "unknown charset, body is not converted to UTF-8", slog.String("charset", charset))
+	}
+}
+
+// truncate shortens s to at most n bytes for messages, without splitting a
+// UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
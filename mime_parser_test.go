@@ -1,8 +1,12 @@
 package sendria
 
 import (
+	"log/slog"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/enthus-golang/sendria/models"
 )
 
 func TestParseMIMEMessage(t *testing.T) {
@@ -128,10 +132,11 @@ Content-ID: <image123>
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			parts, attachments, err := parseMIMEMessage(tt.source)
+			parsed, err := parseSource(tt.source, discardLogger)
 			if err != nil {
-				t.Fatalf("parseMIMEMessage() error = %v", err)
+				t.Fatalf("parseSource() error = %v", err)
 			}
+			parts, attachments := parsed.Parts, parsed.Attachments
 
 			if len(parts) != tt.expectedParts {
 				t.Errorf("Expected %d parts, got %d", tt.expectedParts, len(parts))
@@ -167,7 +172,7 @@ func TestParseMIMEMessage_ErrorCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, _, err := parseMIMEMessage(tt.source)
+			_, err := parseSource(tt.source, discardLogger)
 			if err == nil {
 				t.Error("Expected error but got none")
 			}
@@ -216,10 +221,542 @@ func TestDecodeContent(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := decodeContent(tt.content, tt.encoding)
+			result := (&mimeParser{logger: discardLogger}).decodeContent(tt.content, tt.encoding, "")
 			if result != tt.expected {
 				t.Errorf("Expected %q, got %q", tt.expected, result)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+const treeSource = "From: a@example.com\r\nSubject: Tree\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n\r\n" +
+	"--mixed\r\nContent-Type: multipart/alternative; boundary=alt\r\n\r\n" +
+	"--alt\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+	"Caf=C3=A9\r\n" +
+	"--alt\r\nContent-Type: multipart/related; boundary=rel; start=\"<body@x>\"\r\n\r\n" +
+	"--rel\r\nContent-Type: image/png\r\nContent-ID: <logo@x>\r\nContent-Disposition: inline; filename=logo.png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\niVBORw==\r\n" +
+	"--rel\r\nContent-Type: text/html; charset=utf-8\r\nContent-ID: <body@x>\r\n\r\n<img src=\"cid:logo@x\">\r\n" +
+	"--rel--\r\n" +
+	"--alt--\r\n" +
+	"--mixed\r\nContent-Type: text/html\r\nContent-Disposition: attachment; filename=\"page.html\"\r\n\r\n<p>Attached</p>\r\n" +
+	"--mixed--\r\n"
+
+func TestParseSourceTree(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(treeSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := parsed.MIME
+
+	var shape []string
+	root.Walk(func(node *models.MIMENode) bool {
+		shape = append(shape, node.ContentType)
+		return true
+	})
+	expected := []string{
+		"multipart/mixed", "multipart/alternative", "text/plain",
+		"multipart/related", "image/png", "text/html", "text/html",
+	}
+	if strings.Join(shape, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected tree %v, got %v", expected, shape)
+	}
+
+	if root.Header.Get("Subject") != "Tree" {
+		t.Errorf("expected message headers on the root, got %v", root.Header)
+	}
+	if plain := root.Find("text/plain"); plain.Text() != "Café" || plain.Params["charset"] != "utf-8" {
+		t.Errorf("unexpected plain part %q %v", plain.Text(), plain.Params)
+	}
+	logo := root.FindByContentID("<logo@x>")
+	if logo == nil || string(logo.Body()) != "\x89PNG" || logo.Disposition != "inline" || logo.Filename != "logo.png" {
+		t.Errorf("unexpected logo %+v", logo)
+	}
+	if attached := root.Children[1]; !attached.IsAttachment() || attached.Filename != "page.html" {
+		t.Errorf("expected attached page, got %+v", attached)
+	}
+
+	// The flat slices are unchanged by the tree
+	if len(parsed.Parts) != 2 || len(parsed.Attachments) != 2 {
+		t.Errorf("expected 2 parts and 2 attachments, got %d and %d", len(parsed.Parts), len(parsed.Attachments))
+	}
+}
+
+func TestPreferredBody(t *testing.T) {
+	t.Parallel()
+
+	part := func(contentType, body string) string {
+		return "Content-Type: " + contentType + "\r\n\r\n" + body + "\r\n"
+	}
+	message := func(boundary, subtype string, parts ...string) string {
+		source := "Content-Type: multipart/" + subtype + "; boundary=" + boundary + "\r\n\r\n"
+		for _, p := range parts {
+			source += "--" + boundary + "\r\n" + p
+		}
+		return source + "--" + boundary + "--\r\n"
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		prefer   []string
+		expected string
+	}{
+		{
+			name:     "html alternative",
+			source:   message("b", "alternative", part("text/plain", "plain"), part("text/html", "html")),
+			prefer:   []string{"text/html"},
+			expected: "html",
+		},
+		{
+			name:     "plain alternative",
+			source:   message("b", "alternative", part("text/plain", "plain"), part("text/html", "html")),
+			prefer:   []string{"text/plain"},
+			expected: "plain",
+		},
+		{
+			name:     "last alternative is most faithful",
+			source:   message("b", "alternative", part("text/html", "simple"), part("text/html", "rich")),
+			prefer:   []string{"text/html"},
+			expected: "rich",
+		},
+		{
+			name:     "falls back to last text alternative",
+			source:   message("b", "alternative", part("text/plain", "plain"), part("text/enriched", "enriched")),
+			prefer:   []string{"text/html"},
+			expected: "enriched",
+		},
+		{
+			name:     "preference order",
+			source:   message("b", "alternative", part("text/plain", "plain"), part("text/html", "html")),
+			prefer:   []string{"text/markdown", "text/plain", "text/html"},
+			expected: "plain",
+		},
+		{
+			name:     "related root",
+			source:   message("b", "related", part("text/html", "root"), part("text/html", "resource")),
+			prefer:   []string{"text/html"},
+			expected: "root",
+		},
+		{
+			name:     "first of mixed",
+			source:   message("b", "mixed", part("text/plain", "intro"), part("text/html", "html"), part("text/html", "later")),
+			prefer:   []string{"text/html"},
+			expected: "html",
+		},
+		{
+			name: "attachments are skipped",
+			source: message("b", "mixed",
+				"Content-Type: text/html\r\nContent-Disposition: attachment; filename=a.html\r\n\r\nattached\r\n",
+				part("text/plain", "body")),
+			prefer:   []string{"text/html"},
+			expected: "body",
+		},
+		{
+			name:     "nested alternative in mixed",
+			source:   treeSource,
+			prefer:   []string{"text/html"},
+			expected: `<img src="cid:logo@x">`,
+		},
+		{
+			name:   "no text body",
+			source: message("b", "mixed", part("image/png", "png")),
+			prefer: []string{"text/html"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parsed, err := parseSource(tt.source, discardLogger)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			msg := models.Message{MIME: parsed.MIME}
+			if got := strings.TrimSpace(msg.PreferredBody(tt.prefer...).Text()); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+const forwardedSource = "From: support@example.com\r\nTo: desk@example.com\r\nSubject: Fwd: Broken invoice\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+	"--outer\r\nContent-Type: text/plain\r\n\r\nSee the customer email below.\r\n" +
+	"--outer\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"original.eml\"\r\n\r\n" +
+	"From: \"Jane Customer\" <jane@example.org>\r\nTo: billing@example.com\r\n" +
+	"Subject: =?utf-8?q?Rechnung_f=C3=BCr_M=C3=A4rz?=\r\nDate: Mon, 02 Mar 2026 10:00:00 +0100\r\n" +
+	"Content-Type: multipart/mixed; boundary=inner\r\n\r\n" +
+	"--inner\r\nContent-Type: text/plain\r\n\r\nMy invoice is wrong.\r\n" +
+	"--inner\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=invoice.pdf\r\n\r\n%PDF\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\nContent-Type: message/rfc822\r\n\r\n" +
+	"Subject: Inline forward\r\n\r\nForwarded inline.\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmbeddedMessages(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := parseSource(forwardedSource, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Parts) != 1 || len(parsed.Attachments) != 2 {
+		t.Fatalf("expected 1 part and 2 attachments, got %d and %d", len(parsed.Parts), len(parsed.Attachments))
+	}
+
+	forwarded := parsed.Attachments[0].Message
+	if forwarded == nil {
+		t.Fatal("expected the forwarded message on the attachment")
+	}
+	if forwarded.Subject != "Rechnung für März" || forwarded.Header().Get("To") != "billing@example.com" {
+		t.Errorf("unexpected forwarded headers %q %v", forwarded.Subject, forwarded.Header())
+	}
+	if len(forwarded.From) != 1 || forwarded.From[0].Name != "Jane Customer" || forwarded.From[0].Email != "jane@example.org" {
+		t.Errorf("unexpected sender %+v", forwarded.From)
+	}
+	if forwarded.CreatedAt.IsZero() || forwarded.CreatedAt.Day() != 2 {
+		t.Errorf("unexpected date %v", forwarded.CreatedAt)
+	}
+	if len(forwarded.Parts) != 1 || !strings.Contains(forwarded.Parts[0].Body, "invoice is wrong") {
+		t.Errorf("unexpected forwarded parts %+v", forwarded.Parts)
+	}
+	if len(forwarded.Attachments) != 1 || forwarded.Attachments[0].Filename != "invoice.pdf" {
+		t.Errorf("unexpected forwarded attachments %+v", forwarded.Attachments)
+	}
+	if node := parsed.MIME.Find("message/rfc822"); node == nil || node.Message != forwarded {
+		t.Error("expected the forwarded message on the MIME node")
+	}
+
+	if inline := parsed.Attachments[1].Message; inline == nil || inline.Subject != "Inline forward" {
+		t.Errorf("expected the inline forward as an attachment, got %+v", inline)
+	}
+
+	// Embedded messages are not mistaken for the body
+	if body := parsed.MIME.PreferredBody("text/plain"); !strings.Contains(body.Text(), "customer email below") {
+		t.Errorf("unexpected body %q", body.Text())
+	}
+}
+
+func TestParseDeliveryStatusEntities(t *testing.T) {
+	t.Parallel()
+
+	source := "Content-Type: multipart/report; report-type=delivery-status; boundary=r\r\n\r\n" +
+		"--r\r\nContent-Type: text/plain\r\n\r\nDelivery failed.\r\n" +
+		"--r\r\nContent-Type: message/delivery-status\r\n\r\n" +
+		"Reporting-MTA: dns; mx.example.com\r\n\r\n" +
+		"Final-Recipient: rfc822; a@example.org\r\nAction: failed\r\nStatus: 5.1.1\r\n\r\n" +
+		"Final-Recipient: rfc822; b@example.org\r\nAction: delayed\r\nStatus: 4.4.1\r\n" +
+		"--r\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+		"From: app@example.com\r\nSubject: Welcome\r\nMessage-ID: <123@example.com>\r\n" +
+		"--r--\r\n"
+
+	parsed, err := parseSource(source, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status := parsed.MIME.Find("message/delivery-status")
+	if status == nil || len(status.StatusFields) != 3 {
+		t.Fatalf("expected 3 status field groups, got %+v", status)
+	}
+	if status.StatusFields[0].Get("Reporting-MTA") != "dns; mx.example.com" ||
+		status.StatusFields[1].Get("Status") != "5.1.1" || status.StatusFields[2].Get("Action") != "delayed" {
+		t.Errorf("unexpected status fields %v", status.StatusFields)
+	}
+
+	headers := parsed.MIME.Find("text/rfc822-headers")
+	if headers == nil || headers.Message == nil || headers.Message.Subject != "Welcome" ||
+		headers.Message.Header().Get("Message-ID") != "<123@example.com>" {
+		t.Errorf("unexpected original headers %+v", headers)
+	}
+
+	if body := parsed.MIME.PreferredBody("text/html"); body.Text() != "Delivery failed." {
+		t.Errorf("unexpected body %q", body.Text())
+	}
+}
+
+func TestParseEmbeddedMessageDepth(t *testing.T) {
+	t.Parallel()
+
+	source := "Subject: innermost\r\n\r\nHello"
+	for i := 0; i < maxEmbeddedDepth+2; i++ {
+		source = "Content-Type: multipart/mixed; boundary=b" + strconv.Itoa(i) + "\r\n\r\n" +
+			"--b" + strconv.Itoa(i) + "\r\nContent-Type: message/rfc822\r\n\r\n" + source + "\r\n--b" + strconv.Itoa(i) + "--\r\n"
+	}
+
+	parsed, err := parseSource(source, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	depth := 0
+	for msg := parsed.Attachments[0].Message; msg != nil; depth++ {
+		if len(msg.Attachments) == 0 {
+			break
+		}
+		msg = msg.Attachments[0].Message
+	}
+	if depth != maxEmbeddedDepth {
+		t.Errorf("expected embedded messages to be parsed %d levels deep, got %d", maxEmbeddedDepth, depth)
+	}
+}
+
+// malformedTests are sources with the defects lenient parsing recovers from
+var malformedTests = []struct {
+	name            string
+	source          string
+	wantParts       []string
+	wantAttachments int
+	wantWarnings    []models.ParseWarningCode
+	check           func(t *testing.T, parsed *models.ParsedSource)
+}{
+	{
+		name:         "not a message",
+		source:       "This is not a valid email",
+		wantParts:    []string{"This is not a valid email"},
+		wantWarnings: []models.ParseWarningCode{models.WarningMalformedHeader},
+	},
+	{
+		name: "missing boundary parameter",
+		source: "Subject: x\r\nContent-Type: multipart/mixed\r\n\r\n" +
+			"--guess\r\nContent-Type: text/plain\r\n\r\nhello\r\n--guess--\r\n",
+		wantParts:    []string{"hello"},
+		wantWarnings: []models.ParseWarningCode{models.WarningMissingBoundary},
+	},
+	{
+		name:         "boundary not in body",
+		source:       "Subject: x\r\nContent-Type: multipart/mixed; boundary=B\r\n\r\njust text\r\n",
+		wantParts:    []string{"just text"},
+		wantWarnings: []models.ParseWarningCode{models.WarningMissingBoundary},
+		check: func(t *testing.T, parsed *models.ParsedSource) {
+			if parsed.MIME.ContentType != "text/plain" {
+				t.Errorf("expected a text/plain leaf, got %s", parsed.MIME.ContentType)
+			}
+		},
+	},
+	{
+		name: "bare LFs",
+		source: "Subject: x\nContent-Type: multipart/alternative; boundary=B\r\n\r\n" +
+			"--B\nContent-Type: text/plain\n\nplain\r\n--B\r\nContent-Type: text/html\r\n\r\n<p>html</p>\n--B--\n",
+		wantParts:    []string{"plain", "<p>html</p>"},
+		wantWarnings: []models.ParseWarningCode{models.WarningBareLF},
+	},
+	{
+		name:         "8-bit header",
+		source:       "Subject: Caf\xe9\r\nContent-Type: text/plain\r\n\r\nbody",
+		wantParts:    []string{"body"},
+		wantWarnings: []models.ParseWarningCode{models.WarningEightBitHeader},
+		check: func(t *testing.T, parsed *models.ParsedSource) {
+			if subject := parsed.MIME.Header.Get("Subject"); subject != "Café" {
+				t.Errorf("expected the Latin-1 subject as UTF-8, got %q", subject)
+			}
+		},
+	},
+	{
+		name:         "broken base64 padding",
+		source:       "Subject: x\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\nSGVs\r\nbG8",
+		wantParts:    []string{"Hello"},
+		wantWarnings: []models.ParseWarningCode{models.WarningInvalidEncoding},
+	},
+	{
+		name:         "malformed content type parameters",
+		source:       "Subject: x\r\nContent-Type: text/html; charset=\"utf-8\r\n\r\n<p>hi</p>",
+		wantParts:    []string{"<p>hi</p>"},
+		wantWarnings: []models.ParseWarningCode{models.WarningMalformedContentType},
+		check: func(t *testing.T, parsed *models.ParsedSource) {
+			if parsed.MIME.ContentType != "text/html" || parsed.MIME.Params["charset"] != "utf-8" {
+				t.Errorf("expected the salvaged type, got %s %v", parsed.MIME.ContentType, parsed.MIME.Params)
+			}
+		},
+	},
+	{
+		name: "duplicate boundaries",
+		source: "Subject: x\r\nContent-Type: multipart/mixed; boundary=B\r\n\r\n" +
+			"--B\r\nContent-Type: multipart/alternative; boundary=B\r\n\r\n" +
+			"--B\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+			"--B\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n--B--\r\n" +
+			"--B\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\n%PDF\r\n--B--\r\n",
+		wantParts:       []string{"plain", "<p>html</p>"},
+		wantAttachments: 1,
+		wantWarnings:    []models.ParseWarningCode{models.WarningDuplicateBoundary},
+		check: func(t *testing.T, parsed *models.ParsedSource) {
+			children := parsed.MIME.Children
+			if len(children) != 2 || len(children[0].Children) != 2 || children[1].Filename != "a.pdf" {
+				t.Errorf("expected the alternative and the attachment, got %d children", len(children))
+			}
+		},
+	},
+	{
+		name: "truncated message",
+		source: "Subject: x\r\nContent-Type: multipart/mixed; boundary=B\r\n\r\n" +
+			"--B\r\nContent-Type: text/plain\r\n\r\nfirst\r\n" +
+			"--B\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\nJVBERi0xLj",
+		wantParts:       []string{"first"},
+		wantAttachments: 1,
+		wantWarnings:    []models.ParseWarningCode{models.WarningTruncated, models.WarningInvalidEncoding},
+		check: func(t *testing.T, parsed *models.ParsedSource) {
+			if pdf := parsed.MIME.Find("application/pdf"); pdf == nil || pdf.Text() != "%PDF-1." {
+				t.Errorf("expected the decodable prefix of the attachment, got %+v", pdf)
+			}
+			if w := parsed.Warnings[0]; w.Path != "" || w.Code != models.WarningTruncated {
+				t.Errorf("unexpected warning %s", w)
+			}
+			if w := parsed.Warnings[1]; w.Path != "2" {
+				t.Errorf("expected the encoding warning for part 2, got %s", w)
+			}
+		},
+	},
+}
+
+func TestParseSourceLenient(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range malformedTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parsed := parseSourceLenient(tt.source, discardLogger)
+
+			bodies := make([]string, 0, len(parsed.Parts))
+			for _, part := range parsed.Parts {
+				bodies = append(bodies, strings.TrimSpace(part.Body))
+			}
+			if strings.Join(bodies, "|") != strings.Join(tt.wantParts, "|") {
+				t.Errorf("expected parts %q, got %q", tt.wantParts, bodies)
+			}
+			if len(parsed.Attachments) != tt.wantAttachments {
+				t.Errorf("expected %d attachments, got %d", tt.wantAttachments, len(parsed.Attachments))
+			}
+
+			codes := make([]models.ParseWarningCode, 0, len(parsed.Warnings))
+			for _, w := range parsed.Warnings {
+				codes = append(codes, w.Code)
+			}
+			if len(codes) != len(tt.wantWarnings) {
+				t.Fatalf("expected warnings %v, got %v", tt.wantWarnings, parsed.Warnings)
+			}
+			for i := range codes {
+				if codes[i] != tt.wantWarnings[i] {
+					t.Fatalf("expected warnings %v, got %v", tt.wantWarnings, parsed.Warnings)
+				}
+			}
+
+			if tt.check != nil {
+				tt.check(t, parsed)
+			}
+		})
+	}
+}
+
+func TestParseSourceWarnings(t *testing.T) {
+	t.Parallel()
+
+	source := "Subject: x\r\nContent-Type: multipart/mixed; boundary=B\r\n\r\n" +
+		"--B\r\nContent-Type: /html\r\n\r\nfirst\r\n" +
+		"--B\r\nContent-Type: text/plain; charset=koi8-r\r\n\r\nsecond\r\n--B--\r\n"
+
+	parsed, err := parseSource(source, discardLogger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []models.ParseWarning{
+		{Code: models.WarningMalformedContentType, Path: "1"},
+		{Code: models.WarningUnknownCharset, Path: "2", Message: `unknown charset, body is not converted to UTF-8 (charset=koi8-r)`},
+	}
+	if len(parsed.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %v", len(want), parsed.Warnings)
+	}
+	for i, w := range want {
+		got := parsed.Warnings[i]
+		if got.Code != w.Code || got.Path != w.Path || (w.Message != "" && got.Message != w.Message) {
+			t.Errorf("expected warning %s, got %s", w, got)
+		}
+	}
+
+	if _, err := parseSource(malformedTests[0].source, discardLogger); err == nil {
+		t.Error("expected strict parsing to fail for a source that is not a message")
+	}
+}
+
+func FuzzParseMIMEMessage(f *testing.F) {
+	for _, source := range []string{treeSource, forwardedSource, bounceSource, inviteSource} {
+		f.Add(source)
+	}
+	for _, tt := range malformedTests {
+		f.Add(tt.source)
+	}
+	for _, name := range []string{"smime-signed.eml", "smime-encrypted.eml", "pgp-signed.eml", "pgp-encrypted.eml"} {
+		f.Add(string(readSecurityFixture(f, name)))
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		if parsed, err := parseSource(source, discardLogger); err == nil {
+			inspectParsed(parsed)
+		}
+
+		parsed := parseSourceLenient(source, discardLogger)
+		if parsed == nil || parsed.MIME == nil {
+			t.Fatal("expected lenient parsing to return a MIME tree")
+		}
+		inspectParsed(parsed)
+	})
+}
+
+// inspectParsed calls the accessors of a parsed source, which must not panic
+func inspectParsed(parsed *models.ParsedSource) {
+	msg := models.Message{MIME: parsed.MIME}
+	_ = msg.PreferredBody()
+	_, _ = msg.DeliveryReport()
+	_, _ = msg.CalendarInvite()
+	parsed.MIME.Walk(func(node *models.MIMENode) bool {
+		if node.ContentType == "text/html" {
+			_ = models.HTMLToText(node.Text())
+		}
+		if node.Message != nil {
+			_ = node.Message.PreferredBody()
+		}
+		return true
+	})
+}
+
+// parseSourceLenient parses the raw email source like parseSource, but
+// recovers from malformed input instead of failing: missing or duplicate
+// boundaries, header lines that are not fields, broken base64 and truncated
+// messages
+func parseSourceLenient(source string, logger *slog.Logger) *models.ParsedSource {
+	parsed, _ := (&mimeParser{logger: logger, lenient: true}).parse(source)
+	return parsed
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		n        int
+		expected string
+	}{
+		{"short", "abc", 5, "abc"},
+		{"ascii", "abcdef", 3, "abc..."},
+		{"rune boundary", "aé", 2, "a..."},
+		{"multibyte", "日本語", 4, "日..."},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := truncate(tt.input, tt.n); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
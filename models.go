@@ -11,4 +11,27 @@ type (
 	Recipient   = models.Recipient
 	Part        = models.Part
 	Attachment  = models.Attachment
-)
\ No newline at end of file
+	MIMENode    = models.MIMENode
+
+	DeliveryReport  = models.DeliveryReport
+	RecipientStatus = models.RecipientStatus
+
+	CalendarInvite = models.CalendarInvite
+	Attendee       = models.Attendee
+	RecurrenceRule = models.RecurrenceRule
+
+	CIDResolution = models.CIDResolution
+	CIDReference  = models.CIDReference
+
+	ConsistencyReport = models.ConsistencyReport
+
+	DKIMResult   = models.DKIMResult
+	DKIMResolver = models.DKIMResolver
+	DKIMKeys     = models.DKIMKeys
+
+	Security        = models.Security
+	SignatureResult = models.SignatureResult
+	SecurityKeys    = models.SecurityKeys
+	SMIMEKey        = models.SMIMEKey
+	PGPKeyring      = models.PGPKeyring
+)
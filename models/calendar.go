@@ -0,0 +1,581 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCalendarInvite is returned by CalendarInvite for messages without an
+// iCalendar part
+var ErrNoCalendarInvite = errors.New("message has no calendar invite")
+
+// iTIP methods of calendar invites (RFC 5546)
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+	MethodReply   = "REPLY"
+)
+
+// CalendarInvite is the event of an iCalendar invite (RFC 5545, RFC 5546)
+type CalendarInvite struct {
+	// Method is the iTIP method, e.g. MethodRequest or MethodCancel
+	Method string `json:"method"`
+	// UID identifies the event across updates and cancellations
+	UID string `json:"uid"`
+	// Sequence is the revision of the event
+	Sequence int `json:"sequence"`
+	// Status is the event status, e.g. "CONFIRMED" or "CANCELLED"
+	Status      string `json:"status,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	// Organizer is the organizer with the mailto: prefix removed
+	Organizer Recipient `json:"organizer"`
+	// Attendees are the invited attendees
+	Attendees []Attendee `json:"attendees,omitempty"`
+	// Start and End are the event times with their TZID resolved. End is
+	// computed from DURATION if the event has no DTEND.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// AllDay reports whether the event has dates instead of times
+	AllDay bool `json:"all_day,omitempty"`
+	// TimeZone is the TZID of DTSTART, or empty for UTC and floating times
+	TimeZone string `json:"time_zone,omitempty"`
+	// RecurrenceRules are the RRULEs of a recurring event
+	RecurrenceRules []RecurrenceRule `json:"recurrence_rules,omitempty"`
+}
+
+// Attendee is an attendee of a calendar event
+type Attendee struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+	// Role is e.g. "REQ-PARTICIPANT", "OPT-PARTICIPANT" or "CHAIR"
+	Role string `json:"role"`
+	// PartStat is the participation status, e.g. "NEEDS-ACTION" or "ACCEPTED"
+	PartStat string `json:"partstat"`
+	RSVP     bool   `json:"rsvp,omitempty"`
+}
+
+// RecurrenceRule is a parsed RRULE
+type RecurrenceRule struct {
+	// Freq is e.g. "DAILY", "WEEKLY" or "MONTHLY"
+	Freq     string `json:"freq"`
+	Interval int    `json:"interval"`
+	// Count is the number of occurrences, or 0 if unbounded
+	Count int `json:"count,omitempty"`
+	// Until is the last occurrence, or zero if unbounded
+	Until time.Time `json:"until,omitempty"`
+	// ByDay holds weekdays with optional ordinals, e.g. "MO" or "-1SU"
+	ByDay      []string `json:"by_day,omitempty"`
+	ByMonthDay []int    `json:"by_month_day,omitempty"`
+	ByMonth    []int    `json:"by_month,omitempty"`
+	// Raw is the rule as written
+	Raw string `json:"raw"`
+}
+
+// IsCancellation reports whether the invite cancels the event
+func (ci *CalendarInvite) IsCancellation() bool {
+	return ci.Method == MethodCancel || ci.Status == "CANCELLED"
+}
+
+// Attendee returns the attendee with the given email address, compared
+// case-insensitively
+func (ci *CalendarInvite) Attendee(email string) (Attendee, bool) {
+	for _, a := range ci.Attendees {
+		if strings.EqualFold(a.Email, email) {
+			return a, true
+		}
+	}
+	return Attendee{}, false
+}
+
+// CalendarInvite extracts the invite from the first text/calendar or
+// application/ics entity of the message. It returns ErrNoCalendarInvite for
+// messages without one.
+func (m *Message) CalendarInvite() (*CalendarInvite, error) {
+	if err := m.LoadParts(); err != nil {
+		return nil, err
+	}
+
+	node := m.MIME.findFirst(func(node *MIMENode) bool {
+		return (node.ContentType == "text/calendar" || node.ContentType == "application/ics") && len(node.Body()) > 0
+	})
+	if node == nil {
+		return nil, ErrNoCalendarInvite
+	}
+
+	invite, err := ParseCalendarInvite(node.Body())
+	if err != nil {
+		return nil, err
+	}
+	if invite.Method == "" {
+		invite.Method = strings.ToUpper(node.Params["method"])
+	}
+	return invite, nil
+}
+
+// ParseCalendarInvite parses the event of an iCalendar object. Of events with
+// overridden occurrences, the master event is returned.
+func ParseCalendarInvite(data []byte) (*CalendarInvite, error) {
+	root, err := parseICalendar(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cal := root.child("VCALENDAR")
+	if cal == nil {
+		return nil, errors.New("parsing calendar: no VCALENDAR")
+	}
+	var event *icalComponent
+	for _, c := range cal.children {
+		if c.name == "VEVENT" && (event == nil || event.prop("RECURRENCE-ID") != nil) {
+			event = c
+		}
+	}
+	if event == nil {
+		return nil, errors.New("parsing calendar: no VEVENT")
+	}
+
+	invite := &CalendarInvite{
+		Method:      strings.ToUpper(cal.value("METHOD")),
+		UID:         event.value("UID"),
+		Status:      strings.ToUpper(event.value("STATUS")),
+		Summary:     unescapeText(event.value("SUMMARY")),
+		Description: unescapeText(event.value("DESCRIPTION")),
+		Location:    unescapeText(event.value("LOCATION")),
+	}
+	if seq := event.value("SEQUENCE"); seq != "" {
+		if invite.Sequence, err = strconv.Atoi(seq); err != nil {
+			return nil, fmt.Errorf("parsing SEQUENCE: %w", err)
+		}
+	}
+
+	if organizer := event.prop("ORGANIZER"); organizer != nil {
+		invite.Organizer = Recipient{Name: organizer.params["CN"], Email: calAddress(organizer.value)}
+	}
+	for _, p := range event.props {
+		if p.name != "ATTENDEE" {
+			continue
+		}
+		attendee := Attendee{
+			Name:     p.params["CN"],
+			Email:    calAddress(p.value),
+			Role:     strings.ToUpper(p.params["ROLE"]),
+			PartStat: strings.ToUpper(p.params["PARTSTAT"]),
+			RSVP:     strings.EqualFold(p.params["RSVP"], "TRUE"),
+		}
+		// Defaults of RFC 5545, section 3.2
+		if attendee.Role == "" {
+			attendee.Role = "REQ-PARTICIPANT"
+		}
+		if attendee.PartStat == "" {
+			attendee.PartStat = "NEEDS-ACTION"
+		}
+		invite.Attendees = append(invite.Attendees, attendee)
+	}
+
+	if start := event.prop("DTSTART"); start != nil {
+		invite.TimeZone = start.params["TZID"]
+		if invite.Start, invite.AllDay, err = cal.dateTime(start); err != nil {
+			return nil, fmt.Errorf("parsing DTSTART: %w", err)
+		}
+	}
+	if end := event.prop("DTEND"); end != nil {
+		if invite.End, _, err = cal.dateTime(end); err != nil {
+			return nil, fmt.Errorf("parsing DTEND: %w", err)
+		}
+	} else if duration := event.value("DURATION"); duration != "" {
+		d, err := parseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("parsing DURATION: %w", err)
+		}
+		invite.End = invite.Start.Add(d)
+	} else if invite.AllDay {
+		invite.End = invite.Start.AddDate(0, 0, 1)
+	}
+
+	for _, p := range event.props {
+		if p.name != "RRULE" {
+			continue
+		}
+		rule, err := parseRecurrenceRule(p.value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing RRULE: %w", err)
+		}
+		invite.RecurrenceRules = append(invite.RecurrenceRules, rule)
+	}
+
+	return invite, nil
+}
+
+// icalComponent is a component of an iCalendar object, such as VEVENT
+type icalComponent struct {
+	name     string
+	props    []*icalProperty
+	children []*icalComponent
+}
+
+// icalProperty is a content line of an iCalendar object
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICalendar parses the content lines of an iCalendar object into its
+// components. The returned root holds the top-level components.
+func parseICalendar(data string) (*icalComponent, error) {
+	// Unfold long lines (RFC 5545, section 3.1)
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	root := &icalComponent{}
+	stack := []*icalComponent{root}
+	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseContentLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		current := stack[len(stack)-1]
+		switch p.name {
+		case "BEGIN":
+			c := &icalComponent{name: strings.ToUpper(p.value)}
+			current.children = append(current.children, c)
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 1 || current.name != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("parsing calendar: unexpected END:%s", p.value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			current.props = append(current.props, p)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("parsing calendar: missing END:%s", stack[len(stack)-1].name)
+	}
+	return root, nil
+}
+
+// parseContentLine parses a line like NAME;PARAM="a:b";OTHER=c:value
+func parseContentLine(line string) (*icalProperty, error) {
+	p := &icalProperty{params: make(map[string]string)}
+
+	quoted := false
+	start, key := 0, ""
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '=' && p.name != "" && key == "":
+			key = strings.ToUpper(line[start:i])
+			start = i + 1
+		case r == ';' || r == ':':
+			token := line[start:i]
+			if p.name == "" {
+				p.name = strings.ToUpper(token)
+			} else if key != "" {
+				p.params[key] = strings.Trim(token, `"`)
+				key = ""
+			}
+			start = i + 1
+			if r == ':' {
+				p.value = line[start:]
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("parsing calendar: invalid content line %q", line)
+}
+
+// child returns the first child component with the given name
+func (c *icalComponent) child(name string) *icalComponent {
+	for _, child := range c.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// prop returns the first property with the given name
+func (c *icalComponent) prop(name string) *icalProperty {
+	for _, p := range c.props {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// value returns the value of the first property with the given name
+func (c *icalComponent) value(name string) string {
+	if p := c.prop(name); p != nil {
+		return strings.TrimSpace(p.value)
+	}
+	return ""
+}
+
+// dateTime parses a DATE or DATE-TIME property of an event in the calendar
+// c, resolving its TZID
+func (c *icalComponent) dateTime(p *icalProperty) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == len("20060102") {
+		t, err = time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	// Floating times are kept as UTC wall clock times
+	wall, err := time.Parse("20060102T150405", value)
+	if err != nil || p.params["TZID"] == "" {
+		return wall, false, err
+	}
+	loc, err := c.location(p.params["TZID"], wall)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc), false, nil
+}
+
+// location resolves a TZID to the zone of the IANA database with that name,
+// or else to the offset the calendar's VTIMEZONE defines for the wall time
+func (c *icalComponent) location(tzid string, wall time.Time) (*time.Location, error) {
+	// Globally unique TZIDs are prefixed with a solidus
+	if loc, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+		return loc, nil
+	}
+
+	var tz *icalComponent
+	for _, child := range c.children {
+		if child.name == "VTIMEZONE" && child.value("TZID") == tzid {
+			tz = child
+		}
+	}
+	if tz == nil {
+		return nil, fmt.Errorf("unknown TZID %q", tzid)
+	}
+	if loc, err := time.LoadLocation(tz.value("X-LIC-LOCATION")); err == nil && tz.value("X-LIC-LOCATION") != "" {
+		return loc, nil
+	}
+
+	// The observance with the latest onset before the wall time applies
+	var current *icalComponent
+	var currentOnset time.Time
+	for _, obs := range tz.children {
+		if obs.name != "STANDARD" && obs.name != "DAYLIGHT" {
+			continue
+		}
+		onset, ok := observanceOnset(obs, wall)
+		if ok && (current == nil || onset.After(currentOnset)) {
+			current, currentOnset = obs, onset
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no observance of TZID %q at %s", tzid, wall.Format("2006-01-02 15:04"))
+	}
+
+	offset, err := parseUTCOffset(current.value("TZOFFSETTO"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing TZOFFSETTO of %q: %w", tzid, err)
+	}
+	name := current.value("TZNAME")
+	if name == "" {
+		name = tzid
+	}
+	return time.FixedZone(name, offset), nil
+}
+
+// observanceOnset returns the latest onset of a STANDARD or DAYLIGHT
+// observance at or before the wall time, comparing wall clock times
+func observanceOnset(obs *icalComponent, wall time.Time) (time.Time, bool) {
+	first, err := time.Parse("20060102T150405", obs.value("DTSTART"))
+	if err != nil || first.After(wall) {
+		return time.Time{}, false
+	}
+
+	rrule := obs.value("RRULE")
+	if rrule == "" {
+		return first, true
+	}
+	rule, err := parseRecurrenceRule(rrule)
+	if err != nil || rule.Freq != "YEARLY" || len(rule.ByMonth) == 0 {
+		return first, true
+	}
+
+	// Yearly transitions such as BYMONTH=3;BYDAY=-1SU
+	for year := wall.Year(); year >= wall.Year()-1; year-- {
+		day := 1
+		if len(rule.ByDay) > 0 {
+			day = nthWeekday(year, time.Month(rule.ByMonth[0]), rule.ByDay[0])
+		} else if len(rule.ByMonthDay) > 0 {
+			day = rule.ByMonthDay[0]
+		}
+		onset := time.Date(year, time.Month(rule.ByMonth[0]), day, first.Hour(), first.Minute(), first.Second(), 0, time.UTC)
+		if !onset.After(wall) && !onset.Before(first) {
+			return onset, true
+		}
+	}
+	return first, true
+}
+
+// weekdays maps iCalendar weekday names
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// nthWeekday returns the day of month of a BYDAY value such as "2SU" (second
+// Sunday) or "-1SU" (last Sunday)
+func nthWeekday(year int, month time.Month, byDay string) int {
+	if len(byDay) < 2 {
+		return 1
+	}
+	weekday := weekdays[byDay[len(byDay)-2:]]
+	n, err := strconv.Atoi(byDay[:len(byDay)-2])
+	if err != nil || n == 0 {
+		n = 1
+	}
+
+	if n > 0 {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return 1 + (int(weekday)-int(first.Weekday())+7)%7 + (n-1)*7
+	}
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	return last.Day() - (int(last.Weekday())-int(weekday)+7)%7 + (n+1)*7
+}
+
+// parseUTCOffset parses offsets like +0100, -0500 or +053000
+func parseUTCOffset(value string) (int, error) {
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+	sign := 1
+	switch value[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+
+	seconds := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(value) {
+			break
+		}
+		n, err := strconv.Atoi(value[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", value)
+		}
+		seconds += n * unit
+	}
+	return sign * seconds, nil
+}
+
+// parseDuration parses durations like PT1H30M, P1D or -P1W
+func parseDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+	rest := strings.TrimPrefix(value, "+")
+	if strings.HasPrefix(rest, "-") {
+		sign, rest = -1, rest[1:]
+	}
+	if !strings.HasPrefix(rest, "P") || len(rest) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var d time.Duration
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	n := 0
+	for i := 1; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+		case c == 'T':
+		case units[c] != 0:
+			d += time.Duration(n) * units[c]
+			n = 0
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+	return sign * d, nil
+}
+
+// parseRecurrenceRule parses an RRULE value
+func parseRecurrenceRule(value string) (RecurrenceRule, error) {
+	rule := RecurrenceRule{Interval: 1, Raw: value}
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return RecurrenceRule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+		case "UNTIL":
+			if rule.Until, err = time.Parse("20060102T150405Z", val); err != nil {
+				rule.Until, err = time.Parse("20060102", val)
+			}
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(val), ",")
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(val)
+		case "BYMONTH":
+			rule.ByMonth, err = parseInts(val)
+		}
+		if err != nil {
+			return RecurrenceRule{}, fmt.Errorf("invalid rule part %q: %w", part, err)
+		}
+	}
+	if rule.Freq == "" {
+		return RecurrenceRule{}, fmt.Errorf("rule %q has no FREQ", value)
+	}
+	return rule, nil
+}
+
+// parseInts parses a comma separated list of integers
+func parseInts(value string) ([]int, error) {
+	var ints []int
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+// calAddress strips the mailto: scheme of a calendar user address
+func calAddress(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	return value
+}
+
+// unescapeText unescapes a TEXT value (RFC 5545, section 3.3.11)
+func unescapeText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrNoHTMLBody is returned by ResolveCIDs for messages without an HTML body
+var ErrNoHTMLBody = errors.New("message has no HTML body")
+
+// cidPattern matches cid: URLs (RFC 2392) in attributes and CSS url()
+var cidPattern = regexp.MustCompile(`(?i)\bcid:([^"'\s()<>]+)`)
+
+// CIDReference is a cid: URL in an HTML body
+type CIDReference struct {
+	// URL is the reference as written, e.g. "cid:logo@company"
+	URL string `json:"url"`
+	// CID is the referenced Content-ID, unescaped and without brackets
+	CID string `json:"cid"`
+	// Part is the referenced entity, or nil if the reference is broken
+	Part *MIMENode `json:"-"`
+}
+
+// CIDResolution maps the cid: references of the HTML body of a message to
+// the parts they refer to
+type CIDResolution struct {
+	// HTML is the HTML body the references were found in
+	HTML *MIMENode
+	// References are the cid: URLs of the HTML in order of appearance
+	References []CIDReference
+	// Broken are the references to Content-IDs no part has
+	Broken []CIDReference
+	// Orphans are inline parts with a Content-ID the HTML never references
+	Orphans []*MIMENode
+}
+
+// ResolveCIDs maps every cid: reference in the preferred HTML body to its
+// part, and finds inline parts that are never referenced. It returns
+// ErrNoHTMLBody for messages without an HTML body.
+func (m *Message) ResolveCIDs() (*CIDResolution, error) {
+	if err := m.LoadParts(); err != nil {
+		return nil, err
+	}
+
+	html := m.MIME.PreferredBody("text/html")
+	if html == nil || html.ContentType != "text/html" {
+		return nil, ErrNoHTMLBody
+	}
+
+	r := &CIDResolution{HTML: html}
+	referenced := make(map[*MIMENode]bool)
+	for _, match := range cidPattern.FindAllStringSubmatch(html.Text(), -1) {
+		ref := CIDReference{URL: match[0], CID: unescapeCID(match[1])}
+		ref.Part = m.MIME.FindByContentID(ref.CID)
+		if ref.Part == nil {
+			r.Broken = append(r.Broken, ref)
+		} else {
+			referenced[ref.Part] = true
+		}
+		r.References = append(r.References, ref)
+	}
+
+	m.MIME.Walk(func(node *MIMENode) bool {
+		if node.ContentID != "" && node != html && !node.IsMultipart() && node.Disposition != "attachment" && !referenced[node] {
+			r.Orphans = append(r.Orphans, node)
+		}
+		return true
+	})
+	return r, nil
+}
+
+// unescapeCID decodes the %hh escapes of a cid: URL, keeping it as is if
+// they are invalid
+func unescapeCID(cid string) string {
+	if unescaped, err := url.PathUnescape(cid); err == nil {
+		cid = unescaped
+	}
+	return strings.Trim(cid, "<>")
+}
+
+// RewriteHTML returns the HTML with every resolved reference replaced by the
+// URL that rewrite returns for it. Broken references are kept as they are.
+func (r *CIDResolution) RewriteHTML(rewrite func(ref CIDReference) string) string {
+	i := 0
+	return cidPattern.ReplaceAllStringFunc(r.HTML.Text(), func(match string) string {
+		ref := r.References[i]
+		i++
+		if ref.Part == nil {
+			return match
+		}
+		return rewrite(ref)
+	})
+}
+
+// InlineHTML returns self-contained HTML with the referenced parts embedded
+// as data: URIs
+func (r *CIDResolution) InlineHTML() string {
+	return r.RewriteHTML(func(ref CIDReference) string {
+		return "data:" + ref.Part.ContentType + ";base64," + base64.StdEncoding.EncodeToString(ref.Part.Body())
+	})
+}
+
+// LinkedHTML returns the HTML with the referenced parts linked to the part
+// URLs of the Sendria API at baseURL, /api/messages/{id}/parts/{cid}, which
+// GetAttachment downloads
+func (r *CIDResolution) LinkedHTML(baseURL, messageID string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return r.RewriteHTML(func(ref CIDReference) string {
+		return fmt.Sprintf("%s/api/messages/%s/parts/%s", baseURL, url.PathEscape(messageID), url.PathEscape(ref.CID))
+	})
+}
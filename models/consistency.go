@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrNoPlainBody is returned by CheckAlternatives for messages without a
+// text/plain body
+var ErrNoPlainBody = errors.New("message has no text/plain body")
+
+// DefaultMaxDivergence is the share of differing words up to which the plain
+// text and HTML bodies are considered consistent
+const DefaultMaxDivergence = 0.2
+
+// linkTargetPattern matches the targets of links in HTML
+var linkTargetPattern = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// urlPattern matches URLs in text, which are compared as links, not words
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?|mailto|tel):[^\s\]\[<>"']+`)
+
+// ConsistencyReport compares the text/plain body of a message with the text
+// of its HTML body
+type ConsistencyReport struct {
+	// Divergence is the share of words of both bodies the other one lacks,
+	// from 0 for the same words to 1 for no words in common
+	Divergence float64 `json:"divergence"`
+	// MaxDivergence is the divergence up to which the bodies are consistent
+	MaxDivergence float64 `json:"max_divergence"`
+	// MissingLinks are the link targets of the HTML body that do not occur
+	// in the plain text body
+	MissingLinks []string `json:"missing_links,omitempty"`
+	// MissingWords are words of the HTML body the plain text body lacks, in
+	// order of appearance
+	MissingWords []string `json:"missing_words,omitempty"`
+	// ExtraWords are words of the plain text body the HTML body lacks, in
+	// order of appearance
+	ExtraWords []string `json:"extra_words,omitempty"`
+}
+
+// Consistent reports whether the plain text body has all links of the HTML
+// body and diverges at most by MaxDivergence
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.MissingLinks) == 0 && r.Divergence <= r.MaxDivergence
+}
+
+// CheckAlternatives compares the text/plain body with the text rendered from
+// the text/html body. Words are compared case-insensitively, ignoring
+// punctuation and URLs; links are compared separately. A non-positive
+// maxDivergence uses DefaultMaxDivergence.
+func (m *Message) CheckAlternatives(maxDivergence float64) (*ConsistencyReport, error) {
+	if err := m.LoadParts(); err != nil {
+		return nil, err
+	}
+
+	htmlBody := m.MIME.PreferredBody("text/html")
+	if htmlBody == nil || htmlBody.ContentType != "text/html" {
+		return nil, ErrNoHTMLBody
+	}
+	plainBody := m.MIME.PreferredBody("text/plain")
+	if plainBody == nil || plainBody.ContentType != "text/plain" {
+		return nil, ErrNoPlainBody
+	}
+	if maxDivergence <= 0 {
+		maxDivergence = DefaultMaxDivergence
+	}
+
+	html, plain := htmlBody.Text(), plainBody.Text()
+	report := &ConsistencyReport{MaxDivergence: maxDivergence}
+
+	seen := make(map[string]bool)
+	for _, match := range linkTargetPattern.FindAllStringSubmatch(html, -1) {
+		target := strings.TrimSpace(match[1] + match[2] + match[3])
+		if !urlPattern.MatchString(target) || seen[target] {
+			continue
+		}
+		seen[target] = true
+		if !strings.Contains(plain, target) && !strings.Contains(plain, unescapeAmp(target)) {
+			report.MissingLinks = append(report.MissingLinks, unescapeAmp(target))
+		}
+	}
+
+	htmlWords, plainWords := words(HTMLToText(html)), words(plain)
+	report.MissingWords = subtractWords(htmlWords, plainWords)
+	report.ExtraWords = subtractWords(plainWords, htmlWords)
+	if total := len(htmlWords) + len(plainWords); total > 0 {
+		report.Divergence = float64(len(report.MissingWords)+len(report.ExtraWords)) / float64(total)
+	}
+	return report, nil
+}
+
+// unescapeAmp unescapes the &amp; entities of a URL taken from HTML
+func unescapeAmp(s string) string {
+	return strings.ReplaceAll(s, "&amp;", "&")
+}
+
+// words splits text into lower-cased words, dropping URLs and punctuation
+func words(text string) []string {
+	text = urlPattern.ReplaceAllString(text, " ")
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// subtractWords returns the words of a that b lacks, counting repetitions
+func subtractWords(a, b []string) []string {
+	counts := make(map[string]int, len(b))
+	for _, w := range b {
+		counts[w]++
+	}
+	var missing []string
+	for _, w := range a {
+		if counts[w] > 0 {
+			counts[w]--
+			continue
+		}
+		missing = append(missing, w)
+	}
+	return missing
+}
@@ -0,0 +1,476 @@
+package models
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoDKIMSignature is returned by VerifyDKIM for messages without a
+// DKIM-Signature header
+var ErrNoDKIMSignature = errors.New("message has no DKIM-Signature header")
+
+// DKIMStatus is the outcome of verifying a DKIM signature, as reported in
+// Authentication-Results headers (RFC 8601)
+type DKIMStatus string
+
+// Outcomes of verifying a DKIM signature
+const (
+	// DKIMPass is a signature that matches the message
+	DKIMPass DKIMStatus = "pass"
+	// DKIMFail is a signature that does not match the message, e.g. because
+	// the body or a signed header was changed, or that has expired
+	DKIMFail DKIMStatus = "fail"
+	// DKIMPermError is a malformed signature or key, or one using an
+	// unsupported algorithm
+	DKIMPermError DKIMStatus = "permerror"
+	// DKIMTempError is a signature whose key could not be looked up
+	DKIMTempError DKIMStatus = "temperror"
+)
+
+// minRSAKeyBits is the smallest RSA key verifiers must accept (RFC 8301)
+const minRSAKeyBits = 1024
+
+// DKIMResolver looks up the TXT records of DKIM public keys. *net.Resolver
+// implements it.
+type DKIMResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DKIMKeys is an in-memory DKIMResolver for tests. It maps record names,
+// e.g. "mail._domainkey.example.com", to key records, e.g.
+// "v=DKIM1; k=rsa; p=MIIBIjAN...".
+type DKIMKeys map[string]string
+
+// LookupTXT returns the key record with the name, compared
+// case-insensitively, or a not found error
+func (k DKIMKeys) LookupTXT(_ context.Context, name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	for recordName, record := range k {
+		if strings.EqualFold(recordName, name) {
+			return []string{record}, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// DKIMKeyRecord returns the TXT record publishing an *rsa.PublicKey or
+// ed25519.PublicKey for DKIM
+func DKIMKeyRecord(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	default:
+		return "", fmt.Errorf("unsupported DKIM key type %T", pub)
+	}
+}
+
+// DKIMResult is the outcome of verifying one DKIM-Signature header
+type DKIMResult struct {
+	// Domain is the signing domain (d=)
+	Domain string `json:"domain"`
+	// Selector names the key of the domain (s=)
+	Selector string `json:"selector"`
+	// Identity is the agent the signature is made for (i=), "@" followed by
+	// the domain if the tag is missing
+	Identity string `json:"identity"`
+	// Algorithm is "rsa-sha256" or "ed25519-sha256" (a=)
+	Algorithm string `json:"algorithm"`
+	// Canonicalization is the header and body canonicalization, e.g.
+	// "relaxed/simple" (c=)
+	Canonicalization string `json:"canonicalization"`
+	// SignedHeaders are the names of the signed header fields as listed in
+	// the signature (h=), including names of fields the message lacks
+	SignedHeaders []string `json:"signed_headers"`
+	// BodyLength is the number of signed body bytes (l=), or -1 if the whole
+	// body is signed
+	BodyLength int64 `json:"body_length"`
+	// Timestamp is when the signature was made (t=), if given
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	// Expiration is when the signature expires (x=), if given
+	Expiration time.Time `json:"expiration,omitempty"`
+	// Status is the outcome of the verification
+	Status DKIMStatus `json:"status"`
+	// Err explains why the signature did not pass
+	Err error `json:"-"`
+}
+
+// Pass reports whether the signature is valid
+func (r *DKIMResult) Pass() bool {
+	return r.Status == DKIMPass
+}
+
+// Signs reports whether the header field with the name is signed
+func (r *DKIMResult) Signs(name string) bool {
+	for _, signed := range r.SignedHeaders {
+		if strings.EqualFold(signed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyDKIM verifies the DKIM-Signature headers (RFC 6376) of the raw
+// source in order of appearance, looking up the public keys through the
+// resolver; a nil resolver uses net.DefaultResolver. Each signature is
+// reported with its own status, so the error is only ErrNoDKIMSignature.
+// Signatures using rsa-sha1 are reported as permanent errors (RFC 8301).
+func (m *Message) VerifyDKIM(ctx context.Context, resolver DKIMResolver) ([]DKIMResult, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	header, body := splitDKIMSource(m.Source)
+	fields := splitHeaderFields(header)
+	var results []DKIMResult
+	for i, field := range fields {
+		if strings.EqualFold(field.name, "DKIM-Signature") {
+			results = append(results, verifyDKIMSignature(ctx, resolver, fields, i, body))
+		}
+	}
+	if len(results) == 0 {
+		return nil, ErrNoDKIMSignature
+	}
+	return results, nil
+}
+
+// headerField is a header field as transmitted, including folding and the
+// final CRLF
+type headerField struct {
+	name string
+	raw  string
+}
+
+// splitDKIMSource splits the source into its header and body with bare LF
+// line endings converted to CRLF. The header keeps the CRLF ending its last
+// field.
+func splitDKIMSource(source string) (header, body string) {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\n", "\r\n")
+	if strings.HasPrefix(source, "\r\n") {
+		return "", source[2:]
+	}
+	end := strings.Index(source, "\r\n\r\n")
+	if end < 0 {
+		return source, ""
+	}
+	return source[:end+2], source[end+4:]
+}
+
+// splitHeaderFields splits a header into its fields, keeping continuation
+// lines with the field they continue
+func splitHeaderFields(header string) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].raw += line
+			continue
+		}
+		name, _, _ := strings.Cut(line, ":")
+		fields = append(fields, headerField{name: strings.TrimSpace(name), raw: line})
+	}
+	return fields
+}
+
+// verifyDKIMSignature verifies the DKIM-Signature field fields[sig] against
+// the other fields and the body
+func verifyDKIMSignature(ctx context.Context, resolver DKIMResolver, fields []headerField, sig int, body string) DKIMResult {
+	r := DKIMResult{BodyLength: -1}
+	fail := func(status DKIMStatus, err error) DKIMResult {
+		r.Status, r.Err = status, err
+		return r
+	}
+
+	_, value, _ := strings.Cut(fields[sig].raw, ":")
+	tags, err := parseDKIMTags(value)
+	if err != nil {
+		return fail(DKIMPermError, err)
+	}
+	r.Domain, r.Selector, r.Algorithm = tags["d"], tags["s"], tags["a"]
+	for _, name := range strings.Split(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			r.SignedHeaders = append(r.SignedHeaders, name)
+		}
+	}
+	r.Identity = tags["i"]
+	if r.Identity == "" {
+		r.Identity = "@" + r.Domain
+	}
+	r.Canonicalization = tags["c"]
+	if r.Canonicalization == "" {
+		r.Canonicalization = "simple/simple"
+	}
+	headerCanon, bodyCanon, _ := strings.Cut(strings.ToLower(r.Canonicalization), "/")
+	if bodyCanon == "" {
+		bodyCanon = "simple"
+	}
+
+	if tags["v"] != "1" {
+		return fail(DKIMPermError, fmt.Errorf("unsupported version %q", tags["v"]))
+	}
+	for _, tag := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[tag]; !ok {
+			return fail(DKIMPermError, fmt.Errorf("missing %s= tag", tag))
+		}
+	}
+	keyType, _, _ := strings.Cut(strings.ToLower(r.Algorithm), "-")
+	if a := strings.ToLower(r.Algorithm); a != "rsa-sha256" && a != "ed25519-sha256" {
+		return fail(DKIMPermError, fmt.Errorf("unsupported algorithm %q", r.Algorithm))
+	}
+	if !isDKIMCanonicalization(headerCanon) || !isDKIMCanonicalization(bodyCanon) {
+		return fail(DKIMPermError, fmt.Errorf("unsupported canonicalization %q", r.Canonicalization))
+	}
+	if !r.Signs("From") {
+		return fail(DKIMPermError, errors.New("From header is not signed"))
+	}
+	if _, identityDomain, _ := strings.Cut(r.Identity, "@"); !isSubdomain(identityDomain, r.Domain) {
+		return fail(DKIMPermError, fmt.Errorf("identity %q is not in domain %q", r.Identity, r.Domain))
+	}
+	if t, ok := tags["t"]; ok {
+		seconds, err := strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return fail(DKIMPermError, fmt.Errorf("invalid timestamp %q", t))
+		}
+		r.Timestamp = time.Unix(seconds, 0)
+	}
+	if x, ok := tags["x"]; ok {
+		seconds, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return fail(DKIMPermError, fmt.Errorf("invalid expiration %q", x))
+		}
+		r.Expiration = time.Unix(seconds, 0)
+	}
+	if l, ok := tags["l"]; ok {
+		r.BodyLength, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || r.BodyLength < 0 {
+			return fail(DKIMPermError, fmt.Errorf("invalid body length %q", l))
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fail(DKIMPermError, fmt.Errorf("invalid signature: %w", err))
+	}
+	bodyHash, err := base64.StdEncoding.DecodeString(tags["bh"])
+	if err != nil {
+		return fail(DKIMPermError, fmt.Errorf("invalid body hash: %w", err))
+	}
+
+	key, status, err := lookupDKIMKey(ctx, resolver, r.Selector, r.Domain, keyType)
+	if err != nil {
+		return fail(status, err)
+	}
+
+	canonical := canonicalDKIMBody(body, bodyCanon == "relaxed")
+	if r.BodyLength >= 0 {
+		if r.BodyLength > int64(len(canonical)) {
+			return fail(DKIMPermError, fmt.Errorf("body length %d exceeds the body of %d bytes", r.BodyLength, len(canonical)))
+		}
+		canonical = canonical[:r.BodyLength]
+	}
+	if sum := sha256.Sum256([]byte(canonical)); string(sum[:]) != string(bodyHash) {
+		return fail(DKIMFail, errors.New("body hash does not match"))
+	}
+
+	var signed strings.Builder
+	used := map[int]bool{sig: true}
+	for _, name := range r.SignedHeaders {
+		// Repeated names select fields from the bottom up
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				signed.WriteString(canonicalDKIMHeader(fields[i].raw, headerCanon == "relaxed"))
+				break
+			}
+		}
+	}
+	self := canonicalDKIMHeader(removeDKIMSignatureValue(fields[sig].raw), headerCanon == "relaxed")
+	signed.WriteString(strings.TrimSuffix(self, "\r\n"))
+	digest := sha256.Sum256([]byte(signed.String()))
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, digest[:], signature) {
+			err = errors.New("ed25519: verification error")
+		}
+	}
+	if err != nil {
+		return fail(DKIMFail, fmt.Errorf("signature does not match: %w", err))
+	}
+
+	if !r.Expiration.IsZero() && time.Now().After(r.Expiration) {
+		return fail(DKIMFail, fmt.Errorf("signature expired at %s", r.Expiration.UTC().Format(time.RFC3339)))
+	}
+	r.Status = DKIMPass
+	return r
+}
+
+// lookupDKIMKey looks up the public key of the selector of the domain
+func lookupDKIMKey(ctx context.Context, resolver DKIMResolver, selector, domain, keyType string) (crypto.PublicKey, DKIMStatus, error) {
+	name := selector + "._domainkey." + domain
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, DKIMPermError, fmt.Errorf("no key record %s", name)
+		}
+		return nil, DKIMTempError, fmt.Errorf("looking up key record %s: %w", name, err)
+	}
+
+	for _, record := range records {
+		tags, err := parseDKIMTags(record)
+		if err != nil || (tags["v"] != "" && tags["v"] != "DKIM1") {
+			continue
+		}
+		k := strings.ToLower(tags["k"])
+		if k == "" {
+			k = "rsa"
+		}
+		if k != keyType {
+			return nil, DKIMPermError, fmt.Errorf("key record %s is for %s keys, not %s", name, k, keyType)
+		}
+		if h, ok := tags["h"]; ok && !strings.Contains(":"+strings.ToLower(h)+":", ":sha256:") {
+			return nil, DKIMPermError, fmt.Errorf("key record %s does not allow sha256", name)
+		}
+		if tags["p"] == "" {
+			return nil, DKIMPermError, fmt.Errorf("key record %s is revoked", name)
+		}
+		der, err := base64.StdEncoding.DecodeString(tags["p"])
+		if err != nil {
+			return nil, DKIMPermError, fmt.Errorf("invalid key in record %s: %w", name, err)
+		}
+		key, err := parseDKIMKey(der, keyType)
+		if err != nil {
+			return nil, DKIMPermError, fmt.Errorf("invalid key in record %s: %w", name, err)
+		}
+		return key, "", nil
+	}
+	return nil, DKIMPermError, fmt.Errorf("no valid key record %s", name)
+}
+
+// parseDKIMKey parses the p= tag of a key record
+func parseDKIMKey(der []byte, keyType string) (crypto.PublicKey, error) {
+	if keyType == "ed25519" {
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 key has %d bytes", len(der))
+		}
+		return ed25519.PublicKey(der), nil
+	}
+
+	var key *rsa.PublicKey
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		var ok bool
+		if key, ok = pub.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%T is not an RSA key", pub)
+		}
+	} else if key, err = x509.ParsePKCS1PublicKey(der); err != nil {
+		return nil, err
+	}
+	if key.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA key has %d bits, less than %d", key.N.BitLen(), minRSAKeyBits)
+	}
+	return key, nil
+}
+
+// parseDKIMTags parses a tag list of a signature or key record (RFC 6376,
+// section 3.2), removing whitespace from the values of b=, bh= and p=
+func parseDKIMTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(list, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q", spec)
+		}
+		name = strings.TrimSpace(name)
+		if _, seen := tags[name]; seen {
+			return nil, fmt.Errorf("duplicate tag %s=", name)
+		}
+		value = strings.TrimSpace(value)
+		switch name {
+		case "b", "bh", "p":
+			value = strings.Join(strings.Fields(value), "")
+		default:
+			value = strings.Join(strings.Fields(value), " ")
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+// dkimSignatureValue matches the b= tag of a DKIM-Signature field
+var dkimSignatureValue = regexp.MustCompile(`(:|;)(\s*b\s*=)[^;]*`)
+
+// removeDKIMSignatureValue empties the b= tag of a DKIM-Signature field,
+// which is signed without it
+func removeDKIMSignatureValue(field string) string {
+	return dkimSignatureValue.ReplaceAllString(field, "$1$2")
+}
+
+// wspRun matches runs of whitespace within a line
+var wspRun = regexp.MustCompile(`[ \t]+`)
+
+// canonicalDKIMHeader canonicalizes a header field with the simple or the
+// relaxed algorithm (RFC 6376, section 3.4)
+func canonicalDKIMHeader(field string, relaxed bool) string {
+	if !relaxed {
+		return field
+	}
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = wspRun.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+// canonicalDKIMBody canonicalizes a body with the simple or the relaxed
+// algorithm (RFC 6376, section 3.4)
+func canonicalDKIMBody(body string, relaxed bool) string {
+	if relaxed {
+		lines := strings.Split(body, "\r\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(wspRun.ReplaceAllString(line, " "), " ")
+		}
+		body = strings.Join(lines, "\r\n")
+	}
+	for strings.HasSuffix(body, "\r\n") {
+		body = strings.TrimSuffix(body, "\r\n")
+	}
+	if body == "" && relaxed {
+		return ""
+	}
+	return body + "\r\n"
+}
+
+func isDKIMCanonicalization(name string) bool {
+	return name == "simple" || name == "relaxed"
+}
+
+// isSubdomain reports whether domain is parent or one of its subdomains
+func isSubdomain(domain, parent string) bool {
+	domain, parent = strings.ToLower(domain), strings.ToLower(parent)
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrNoDeliveryReport is returned by DeliveryReport for messages that are not
+// delivery status notifications
+var ErrNoDeliveryReport = errors.New("message is not a delivery status notification")
+
+// Delivery actions of a recipient (RFC 3464, section 2.3.3)
+const (
+	ActionFailed    = "failed"
+	ActionDelayed   = "delayed"
+	ActionDelivered = "delivered"
+	ActionRelayed   = "relayed"
+	ActionExpanded  = "expanded"
+)
+
+// DeliveryReport is a delivery status notification (RFC 3464), such as a
+// bounce
+type DeliveryReport struct {
+	// ReportingMTA is the MTA that generated the report, without its type
+	ReportingMTA string `json:"reporting_mta,omitempty"`
+	// EnvelopeID is the envelope ID of the original message
+	EnvelopeID string `json:"envelope_id,omitempty"`
+	// ArrivalDate is when the original message arrived at the reporting MTA
+	ArrivalDate time.Time `json:"arrival_date,omitempty"`
+	// Explanation is the human readable part of the report
+	Explanation string `json:"explanation,omitempty"`
+	// Recipients holds the status of each recipient
+	Recipients []RecipientStatus `json:"recipients"`
+	// Original is the returned message, or only its headers, if included
+	Original *Message `json:"original,omitempty"`
+	// OriginalMessageID is the Message-ID of the original message
+	OriginalMessageID string `json:"original_message_id,omitempty"`
+	// Fields are the per-message fields as reported
+	Fields textproto.MIMEHeader `json:"fields,omitempty"`
+}
+
+// RecipientStatus is the delivery status of one recipient
+type RecipientStatus struct {
+	// FinalRecipient is the address the delivery was attempted to, without
+	// its address type
+	FinalRecipient string `json:"final_recipient"`
+	// OriginalRecipient is the address as originally given, if reported
+	OriginalRecipient string `json:"original_recipient,omitempty"`
+	// Action is one of the Action* constants
+	Action string `json:"action"`
+	// Status is the enhanced status code, e.g. "5.1.1"
+	Status string `json:"status"`
+	// DiagnosticCode is the response of the remote MTA without its type,
+	// e.g. "550 5.1.1 User unknown"
+	DiagnosticCode string `json:"diagnostic_code,omitempty"`
+	// RemoteMTA is the MTA that reported the status, without its type
+	RemoteMTA string `json:"remote_mta,omitempty"`
+	// Fields are the per-recipient fields as reported
+	Fields textproto.MIMEHeader `json:"fields,omitempty"`
+}
+
+// Permanent reports whether the status is a permanent failure (5.X.X)
+func (r RecipientStatus) Permanent() bool {
+	return strings.HasPrefix(r.Status, "5.")
+}
+
+// Transient reports whether the status is a transient failure (4.X.X)
+func (r RecipientStatus) Transient() bool {
+	return strings.HasPrefix(r.Status, "4.")
+}
+
+// Recipient returns the status of the given final or original recipient,
+// compared case-insensitively
+func (d *DeliveryReport) Recipient(email string) (RecipientStatus, bool) {
+	for _, r := range d.Recipients {
+		if strings.EqualFold(r.FinalRecipient, email) || strings.EqualFold(r.OriginalRecipient, email) {
+			return r, true
+		}
+	}
+	return RecipientStatus{}, false
+}
+
+// DeliveryReport parses the message as a delivery status notification, a
+// multipart/report with report-type=delivery-status. It returns
+// ErrNoDeliveryReport for other messages.
+func (m *Message) DeliveryReport() (*DeliveryReport, error) {
+	if err := m.LoadParts(); err != nil {
+		return nil, err
+	}
+
+	report := m.MIME.findFirst(func(node *MIMENode) bool {
+		return node.ContentType == "multipart/report" &&
+			strings.HasSuffix(strings.ToLower(node.Params["report-type"]), "delivery-status")
+	})
+	if report == nil {
+		return nil, ErrNoDeliveryReport
+	}
+
+	// The parts are the explanation, the status and the original message
+	d := &DeliveryReport{}
+	for _, part := range report.Children {
+		switch part.ContentType {
+		case "message/delivery-status", "message/global-delivery-status":
+			d.readStatusFields(part.StatusFields)
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			d.Original = part.Message
+		default:
+			if d.Explanation == "" && (strings.HasPrefix(part.ContentType, "text/") || part.IsMultipart()) {
+				if body := part.PreferredBody("text/plain"); body != nil {
+					d.Explanation = strings.TrimSpace(body.Text())
+				}
+			}
+		}
+	}
+	if d.Fields == nil {
+		return nil, ErrNoDeliveryReport
+	}
+
+	if d.Original != nil {
+		d.OriginalMessageID = strings.TrimSpace(d.Original.Header().Get("Message-ID"))
+	}
+	return d, nil
+}
+
+// readStatusFields reads the per-message and per-recipient field groups
+func (d *DeliveryReport) readStatusFields(groups []textproto.MIMEHeader) {
+	if len(groups) == 0 {
+		return
+	}
+
+	d.Fields = groups[0]
+	d.ReportingMTA = typedValue(d.Fields.Get("Reporting-MTA"))
+	d.EnvelopeID = strings.TrimSpace(d.Fields.Get("Original-Envelope-Id"))
+	if date, err := mail.ParseDate(d.Fields.Get("Arrival-Date")); err == nil {
+		d.ArrivalDate = date
+	}
+
+	for _, fields := range groups[1:] {
+		d.Recipients = append(d.Recipients, RecipientStatus{
+			FinalRecipient:    typedAddress(fields.Get("Final-Recipient")),
+			OriginalRecipient: typedAddress(fields.Get("Original-Recipient")),
+			Action:            strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+			Status:            statusCode(fields.Get("Status")),
+			DiagnosticCode:    typedValue(fields.Get("Diagnostic-Code")),
+			RemoteMTA:         typedValue(fields.Get("Remote-MTA")),
+			Fields:            fields,
+		})
+	}
+}
+
+// typedValue strips the type of a typed field value such as
+// "smtp; 550 User unknown"
+func typedValue(value string) string {
+	if _, rest, found := strings.Cut(value, ";"); found {
+		value = rest
+	}
+	return strings.TrimSpace(value)
+}
+
+// typedAddress strips the type and angle brackets of an address field such
+// as "rfc822; <user@example.com>"
+func typedAddress(value string) string {
+	return strings.Trim(typedValue(value), "<>")
+}
+
+// statusCode strips comments following the status code, e.g. in
+// "5.1.1 (bad destination mailbox address)"
+func statusCode(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
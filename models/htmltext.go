@@ -0,0 +1,429 @@
+package models
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// HTMLToText renders an HTML body as readable plain text. Block elements
+// start new lines, list items are bulleted or numbered, table cells are
+// separated by " | " and links are written as "text [url]". The content of
+// script, style and head elements and of hidden elements (the hidden
+// attribute, display:none, visibility:hidden or mso-hide:all) is skipped.
+func HTMLToText(body string) string {
+	r := &textRenderer{}
+	r.render(body)
+	return r.String()
+}
+
+// PlainText returns the text/plain body a mail reader would display, or the
+// rendered HTML body if the message has no plain text body
+func (m *Message) PlainText() string {
+	body := m.PreferredBody("text/plain", "text/html")
+	switch {
+	case body == nil:
+		return ""
+	case body.ContentType == "text/html":
+		return HTMLToText(body.Text())
+	default:
+		return body.Text()
+	}
+}
+
+// hiddenStyle matches inline styles that hide an element
+var hiddenStyle = regexp.MustCompile(`(?i)(display\s*:\s*none|visibility\s*:\s*hidden|mso-hide\s*:\s*all)`)
+
+// Elements by how they are rendered
+var (
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+		"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+	}
+	rawTextElements = map[string]bool{"script": true, "style": true, "head": true, "title": true, "template": true}
+	// paragraphElements are separated from their surroundings by a blank line
+	paragraphElements = map[string]bool{
+		"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"blockquote": true, "pre": true, "table": true, "hr": true, "dl": true, "figure": true,
+	}
+	// lineElements start on a new line
+	lineElements = map[string]bool{
+		"div": true, "section": true, "article": true, "header": true, "footer": true, "main": true,
+		"nav": true, "aside": true, "address": true, "center": true, "form": true, "tr": true,
+		"li": true, "dt": true, "dd": true, "figcaption": true, "ul": true, "ol": true, "body": true,
+	}
+)
+
+// textRenderer writes the text of HTML tokens with collapsed whitespace
+type textRenderer struct {
+	b strings.Builder
+	// newlines is the number of line breaks to write before the next text
+	newlines int
+	// space reports whether a space is due before the next text
+	space bool
+	pre   int
+	lists []textList
+	links []textLink
+	// cells holds the output length at the start of the last cell of the
+	// open table rows, or -1 before the first cell
+	cells []int
+}
+
+// textList is an open ul or ol element
+type textList struct {
+	ordered bool
+	n       int
+}
+
+// textLink is an open a element
+type textLink struct {
+	href  string
+	start int
+}
+
+// String returns the rendered text
+func (r *textRenderer) String() string {
+	lines := strings.Split(r.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := strings.Join(lines, "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(text)
+}
+
+// render tokenizes the HTML and renders its tokens
+func (r *textRenderer) render(body string) {
+	for len(body) > 0 {
+		lt := strings.IndexByte(body, '<')
+		if lt < 0 {
+			r.text(body)
+			return
+		}
+		r.text(body[:lt])
+		body = body[lt:]
+
+		switch {
+		case strings.HasPrefix(body, "<!--"):
+			end := strings.Index(body, "-->")
+			if end < 0 {
+				return
+			}
+			body = body[end+3:]
+		case strings.HasPrefix(body, "<!") || strings.HasPrefix(body, "<?"):
+			end := strings.IndexByte(body, '>')
+			if end < 0 {
+				return
+			}
+			body = body[end+1:]
+		case len(body) > 1 && (isASCIILetter(body[1]) || body[1] == '/' && len(body) > 2 && isASCIILetter(body[2])):
+			tag, rest := parseTag(body)
+			body = rest
+			if tag.end {
+				r.endTag(tag.name)
+				continue
+			}
+			if rawTextElements[tag.name] || tag.hidden() {
+				body = skipElement(tag, body)
+				continue
+			}
+			r.startTag(tag)
+		default:
+			r.text("<")
+			body = body[1:]
+		}
+	}
+}
+
+// text writes a text run
+func (r *textRenderer) text(s string) {
+	if s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+	if r.pre > 0 {
+		r.write(s)
+		return
+	}
+
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		r.space = true
+		return
+	}
+	if strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+		r.space = true
+	}
+	r.write(strings.Join(words, " "))
+	r.space = strings.TrimRightFunc(s, unicode.IsSpace) != s
+}
+
+// write writes s after the pending line breaks or space
+func (r *textRenderer) write(s string) {
+	if r.b.Len() > 0 {
+		if r.newlines > 0 {
+			r.b.WriteString(strings.Repeat("\n", r.newlines))
+		} else if r.space {
+			r.b.WriteByte(' ')
+		}
+	}
+	r.newlines, r.space = 0, false
+	r.b.WriteString(s)
+}
+
+// block requests at least n line breaks before the next text
+func (r *textRenderer) block(n int) {
+	if n > r.newlines {
+		r.newlines = n
+	}
+}
+
+// startTag renders an opening tag
+func (r *textRenderer) startTag(tag htmlTag) {
+	switch {
+	case paragraphElements[tag.name]:
+		r.block(2)
+	case lineElements[tag.name]:
+		r.block(1)
+	}
+
+	switch tag.name {
+	case "br":
+		r.newlines++
+	case "pre":
+		r.pre++
+	case "ul", "ol":
+		n, _ := strconv.Atoi(tag.attrs["start"])
+		r.lists = append(r.lists, textList{ordered: tag.name == "ol", n: max(n, 1) - 1})
+	case "li":
+		indent := ""
+		if len(r.lists) > 1 {
+			indent = strings.Repeat("  ", len(r.lists)-1)
+		}
+		bullet := "* "
+		if len(r.lists) > 0 && r.lists[len(r.lists)-1].ordered {
+			r.lists[len(r.lists)-1].n++
+			bullet = strconv.Itoa(r.lists[len(r.lists)-1].n) + ". "
+		}
+		r.write(indent + bullet)
+	case "tr":
+		r.cells = append(r.cells, -1)
+	case "td", "th":
+		// Separate cells that have content on the same line
+		if n := len(r.cells); n > 0 {
+			if last := r.cells[n-1]; last >= 0 && r.b.Len() > last && r.newlines == 0 {
+				r.space = false
+				r.write(" |")
+				r.space = true
+			}
+			r.cells[n-1] = r.b.Len()
+		}
+	case "a":
+		r.links = append(r.links, textLink{href: strings.TrimSpace(tag.attrs["href"]), start: r.b.Len()})
+	case "img":
+		if alt := strings.TrimSpace(tag.attrs["alt"]); alt != "" {
+			r.text(" " + alt + " ")
+		}
+	}
+
+	if tag.selfClosing || voidElements[tag.name] {
+		r.endTag(tag.name)
+	}
+}
+
+// endTag renders a closing tag
+func (r *textRenderer) endTag(name string) {
+	switch {
+	case paragraphElements[name]:
+		r.block(2)
+	case lineElements[name]:
+		r.block(1)
+	}
+
+	switch name {
+	case "pre":
+		if r.pre > 0 {
+			r.pre--
+		}
+	case "ul", "ol":
+		if len(r.lists) > 0 {
+			r.lists = r.lists[:len(r.lists)-1]
+		}
+	case "tr":
+		if len(r.cells) > 0 {
+			r.cells = r.cells[:len(r.cells)-1]
+		}
+	case "a":
+		if len(r.links) == 0 {
+			return
+		}
+		link := r.links[len(r.links)-1]
+		r.links = r.links[:len(r.links)-1]
+		if linkWorthShowing(link.href, r.b.String()[min(link.start, r.b.Len()):]) {
+			r.space = true
+			r.write("[" + link.href + "]")
+		}
+	}
+}
+
+// linkWorthShowing reports whether the target of a link adds to its text
+func linkWorthShowing(href, text string) bool {
+	lower := strings.ToLower(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(lower, "javascript:") {
+		return false
+	}
+	text = strings.TrimSpace(text)
+	target := strings.TrimPrefix(strings.TrimPrefix(href, "mailto:"), "tel:")
+	return text != href && text != target
+}
+
+// htmlTag is a parsed start or end tag
+type htmlTag struct {
+	name        string
+	attrs       map[string]string
+	end         bool
+	selfClosing bool
+}
+
+// hidden reports whether the element is not displayed
+func (t htmlTag) hidden() bool {
+	if voidElements[t.name] {
+		return false
+	}
+	_, hidden := t.attrs["hidden"]
+	return hidden || hiddenStyle.MatchString(t.attrs["style"])
+}
+
+// parseTag parses the tag at the start of s and returns the rest of s
+func parseTag(s string) (htmlTag, string) {
+	tag := htmlTag{attrs: make(map[string]string)}
+	i := 1
+	if s[i] == '/' {
+		tag.end = true
+		i++
+	}
+	start := i
+	for i < len(s) && !isTagSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	tag.name = strings.ToLower(s[start:i])
+
+	for i < len(s) {
+		for i < len(s) && isTagSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		switch s[i] {
+		case '>':
+			return tag, s[i+1:]
+		case '/':
+			tag.selfClosing = true
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isTagSpace(s[i]) && s[i] != '>' && s[i] != '=' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		for i < len(s) && isTagSpace(s[i]) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isTagSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					end = len(s) - i - 1
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isTagSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if key != "" {
+			if _, seen := tag.attrs[key]; !seen {
+				tag.attrs[key] = html.UnescapeString(value)
+			}
+		} else {
+			i++
+		}
+	}
+	return tag, ""
+}
+
+// skipElement returns the HTML following the end tag of the element whose
+// start tag was just parsed. Nested elements of the same name are counted,
+// except in raw text elements such as script.
+func skipElement(tag htmlTag, body string) string {
+	if tag.selfClosing {
+		return body
+	}
+	closing := "</" + tag.name
+	if rawTextElements[tag.name] {
+		end := indexFold(body, closing)
+		if end < 0 {
+			return ""
+		}
+		_, rest := parseTag(body[end:])
+		return rest
+	}
+
+	depth := 1
+	for len(body) > 0 {
+		lt := strings.IndexByte(body, '<')
+		if lt < 0 {
+			return ""
+		}
+		body = body[lt:]
+		if len(body) < 2 || !(isASCIILetter(body[1]) || body[1] == '/') {
+			body = body[1:]
+			continue
+		}
+		inner, rest := parseTag(body)
+		body = rest
+		if inner.name != tag.name || inner.selfClosing {
+			continue
+		}
+		if inner.end {
+			depth--
+		} else {
+			depth++
+		}
+		if depth == 0 {
+			return body
+		}
+	}
+	return ""
+}
+
+// indexFold returns the index of the first case-insensitive occurrence of
+// the ASCII substr in s, or -1
+func indexFold(s, substr string) int {
+	return strings.Index(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isTagSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -2,7 +2,11 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net/textproto"
+	"sync"
 	"time"
 )
 
@@ -18,6 +22,149 @@ type Message struct {
 	Source      string       `json:"source,omitempty"`
 	Parts       []Part       `json:"parts,omitempty"`
 	Attachments []Attachment `json:"attachments,omitempty"`
+	// MIME is the MIME tree the parts and attachments were flattened from
+	MIME *MIMENode `json:"-"`
+
+	// ParseError records why the MIME source could not be parsed into parts
+	// and attachments. For lazily parsed messages it is set by LoadParts.
+	ParseError error `json:"-"`
+	// Warnings are the problems recovered from while parsing the MIME
+	// source. For lazily parsed messages they are set by LoadParts.
+	Warnings []ParseWarning `json:"warnings,omitempty"`
+	// Security describes the S/MIME or PGP/MIME signatures and encryption
+	// of the message, or is nil for messages that are neither signed nor
+	// encrypted. Parts and Attachments are those of the cleartext. For
+	// lazily parsed messages it is set by LoadParts.
+	Security *Security `json:"security,omitempty"`
+
+	lazy *lazyParts
+}
+
+// ParsedSource is the content parsed from the MIME source of a message
+type ParsedSource struct {
+	MIME        *MIMENode
+	Parts       []Part
+	Attachments []Attachment
+	Warnings    []ParseWarning
+	Security    *Security
+}
+
+// lazyParts defers parsing of the parts and attachments. It is shared by
+// copies of a message, so the source is parsed at most once. mu guards
+// copying the result into the fields of a message and the callbacks waiting
+// for the parse.
+type lazyParts struct {
+	once   sync.Once
+	mu     sync.Mutex
+	load   func() (*ParsedSource, error)
+	parsed *ParsedSource
+	err    error
+	done   bool
+	onLoad []func(parsed *ParsedSource)
+}
+
+// SetPartsLoader defers parsing of the MIME tree, parts and attachments
+// until they are first accessed through LoadParts, GetParts, GetAttachments
+// or GetMIME
+func (m *Message) SetPartsLoader(load func() (*ParsedSource, error)) {
+	m.lazy = &lazyParts{load: load}
+}
+
+// LoadParts parses the parts and attachments if that was deferred, and
+// returns the parse error, if any. It is safe for concurrent use; the fields
+// it sets may be read directly once it returns.
+func (m *Message) LoadParts() error {
+	if m.lazy == nil {
+		return m.ParseError
+	}
+
+	m.lazy.once.Do(func() {
+		parsed, err := m.lazy.load()
+		m.lazy.mu.Lock()
+		m.lazy.parsed, m.lazy.err, m.lazy.done = parsed, err, true
+		onLoad := m.lazy.onLoad
+		m.lazy.onLoad = nil
+		m.lazy.mu.Unlock()
+		if parsed != nil {
+			for _, fn := range onLoad {
+				fn(parsed)
+			}
+		}
+	})
+	m.lazy.mu.Lock()
+	defer m.lazy.mu.Unlock()
+	if m.Parts == nil && m.Attachments == nil && m.MIME == nil && m.ParseError == nil {
+		m.ParseError = m.lazy.err
+		if parsed := m.lazy.parsed; parsed != nil {
+			m.MIME, m.Parts, m.Attachments = parsed.MIME, parsed.Parts, parsed.Attachments
+			m.Warnings, m.Security = parsed.Warnings, parsed.Security
+		}
+	}
+	return m.ParseError
+}
+
+// OnPartsLoaded calls fn with the parsed source once the parts are parsed:
+// right away if they are, otherwise when LoadParts first parses them. It
+// does not parse the source itself, and fn is not called if parsing fails.
+func (m *Message) OnPartsLoaded(fn func(parsed *ParsedSource)) {
+	if m.lazy != nil {
+		m.lazy.mu.Lock()
+		if !m.lazy.done {
+			m.lazy.onLoad = append(m.lazy.onLoad, fn)
+			m.lazy.mu.Unlock()
+			return
+		}
+		parsed := m.lazy.parsed
+		m.lazy.mu.Unlock()
+		if parsed != nil {
+			fn(parsed)
+		}
+		return
+	}
+	if m.MIME != nil || m.Parts != nil || m.Attachments != nil {
+		fn(&ParsedSource{MIME: m.MIME, Parts: m.Parts, Attachments: m.Attachments, Warnings: m.Warnings, Security: m.Security})
+	}
+}
+
+// GetParts returns the message parts, parsing the source on first access
+func (m *Message) GetParts() []Part {
+	_ = m.LoadParts()
+	return m.Parts
+}
+
+// GetAttachments returns the attachments, parsing the source on first access
+func (m *Message) GetAttachments() []Attachment {
+	_ = m.LoadParts()
+	return m.Attachments
+}
+
+// GetWarnings returns the problems recovered from while parsing the source,
+// parsing it on first access
+func (m *Message) GetWarnings() []ParseWarning {
+	_ = m.LoadParts()
+	return m.Warnings
+}
+
+// GetMIME returns the MIME tree, parsing the source on first access. It is
+// nil if the message has no source or the source could not be parsed.
+func (m *Message) GetMIME() *MIMENode {
+	_ = m.LoadParts()
+	return m.MIME
+}
+
+// Header returns the message headers from the MIME tree, parsing the source
+// on first access
+func (m *Message) Header() textproto.MIMEHeader {
+	if root := m.GetMIME(); root != nil {
+		return root.Header
+	}
+	return nil
+}
+
+// PreferredBody returns the body a mail reader would display, preferring the
+// given media types in order, or nil. See MIMENode.PreferredBody.
+func (m *Message) PreferredBody(mediaTypes ...string) *MIMENode {
+	return m.GetMIME().PreferredBody(mediaTypes...)
 }
 
 // Recipient represents an email recipient
@@ -41,14 +188,56 @@ type Attachment struct {
 	Filename    string `json:"filename"`
 	ContentType string `json:"content_type"`
 	Size        int    `json:"size"`
+	// Message is the parsed message of a message/rfc822 attachment, e.g. a
+	// forwarded email
+	Message *Message `json:"message,omitempty"`
 }
 
+// ErrNoNextPage is returned by NextPage on the last page
+var ErrNoNextPage = errors.New("no next page")
+
 // MessageList represents a paginated list of messages
 type MessageList struct {
 	Messages []Message `json:"messages"`
-	Total    int       `json:"total"`
-	Page     int       `json:"page"`
-	PerPage  int       `json:"per_page"`
+	// Total is the number of messages on all pages, or 0 if it is not known,
+	// see TotalKnown
+	Total int `json:"total"`
+	// TotalKnown reports whether Total is exact. It is false if the server
+	// reports only the number of pages, or no count at all, and this page
+	// does not end the list, unless the list was requested with exact totals.
+	TotalKnown bool `json:"total_known"`
+	// Page is the 1-based number of this page
+	Page int `json:"page"`
+	// PerPage is the page size, or 0 if the server did not page the list
+	PerPage int `json:"per_page"`
+	// PagesTotal is the number of pages
+	PagesTotal int `json:"pages_total"`
+
+	loadPage func(ctx context.Context, page int) (*MessageList, error)
+}
+
+// SetPageLoader sets how NextPage fetches other pages of the list
+func (l *MessageList) SetPageLoader(load func(ctx context.Context, page int) (*MessageList, error)) {
+	l.loadPage = load
+}
+
+// HasNext reports whether there is a page after this one
+func (l *MessageList) HasNext() bool {
+	return l.Page < l.PagesTotal
+}
+
+// HasPrev reports whether there is a page before this one
+func (l *MessageList) HasPrev() bool {
+	return l.Page > 1
+}
+
+// NextPage fetches the page after this one with the same page size and
+// options. It returns ErrNoNextPage on the last page.
+func (l *MessageList) NextPage(ctx context.Context) (*MessageList, error) {
+	if !l.HasNext() || l.loadPage == nil {
+		return nil, ErrNoNextPage
+	}
+	return l.loadPage(ctx, l.Page+1)
 }
 
 // APIResponse represents the standard API response structure
@@ -58,9 +247,15 @@ type APIResponse struct {
 	Meta *APIMeta        `json:"meta,omitempty"`
 }
 
-// APIMeta represents metadata in API responses
+// APIMeta represents metadata in API responses. Sendria reports
+// pages_total; other versions and compatible servers report the total
+// message count and the page size instead or in addition. Fields that are
+// not reported are zero.
 type APIMeta struct {
 	PagesTotal int `json:"pages_total"`
+	Total      int `json:"total,omitempty"`
+	Page       int `json:"page,omitempty"`
+	PerPage    int `json:"per_page,omitempty"`
 }
 
 // APIMessage represents a message in the API response
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// MIMENode is an entity of the MIME tree of a message. The root node is the
+// message itself; multipart entities have children in their original order.
+type MIMENode struct {
+	// ContentType is the lower-cased media type, e.g. "text/html"
+	ContentType string `json:"content_type"`
+	// Params are the Content-Type parameters, e.g. charset and boundary
+	Params map[string]string `json:"params,omitempty"`
+	// Header holds the headers of the entity; for the root node these are
+	// the message headers
+	Header textproto.MIMEHeader `json:"header,omitempty"`
+	// Disposition is the lower-cased Content-Disposition, e.g. "inline" or
+	// "attachment", or empty if the header is missing
+	Disposition string `json:"disposition,omitempty"`
+	// Filename is the filename of the Content-Disposition or Content-Type
+	Filename string `json:"filename,omitempty"`
+	// ContentID is the Content-ID without angle brackets
+	ContentID string `json:"content_id,omitempty"`
+	// Size is the size of the content as transmitted, before decoding
+	Size int `json:"size"`
+	// Children are the entities of a multipart entity
+	Children []*MIMENode `json:"children,omitempty"`
+	// Message is the parsed message of a message/rfc822 entity, or the
+	// original headers of a text/rfc822-headers entity. Walk and the
+	// lookups do not descend into it.
+	Message *Message `json:"message,omitempty"`
+	// StatusFields are the field groups of a message/delivery-status
+	// entity: the per-message fields followed by one group per recipient
+	StatusFields []textproto.MIMEHeader `json:"status_fields,omitempty"`
+
+	body []byte
+}
+
+// SetBody sets the decoded content of the entity
+func (n *MIMENode) SetBody(body []byte) {
+	n.body = body
+}
+
+// Body returns the content with the transfer encoding decoded. It is nil for
+// multipart entities.
+func (n *MIMENode) Body() []byte {
+	if n == nil {
+		return nil
+	}
+	return n.body
+}
+
+// Text returns the decoded content as a string
+func (n *MIMENode) Text() string {
+	return string(n.Body())
+}
+
+// IsMultipart reports whether the entity is a multipart container
+func (n *MIMENode) IsMultipart() bool {
+	return strings.HasPrefix(n.ContentType, "multipart/")
+}
+
+// IsAttachment reports whether the entity is meant to be saved rather than
+// displayed
+func (n *MIMENode) IsAttachment() bool {
+	return n.Disposition == "attachment" || (n.Filename != "" && n.Disposition != "inline")
+}
+
+// Walk calls fn for the entity and its descendants in document order. Children
+// of a node are skipped if fn returns false for it.
+func (n *MIMENode) Walk(fn func(node *MIMENode) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// Find returns the first entity of the given media type in document order,
+// or nil
+func (n *MIMENode) Find(mediaType string) *MIMENode {
+	return n.findFirst(func(node *MIMENode) bool {
+		return strings.EqualFold(node.ContentType, mediaType)
+	})
+}
+
+// FindByContentID returns the entity with the given Content-ID, with or
+// without angle brackets, or nil
+func (n *MIMENode) FindByContentID(cid string) *MIMENode {
+	cid = strings.Trim(cid, "<>")
+	return n.findFirst(func(node *MIMENode) bool {
+		return cid != "" && node.ContentID == cid
+	})
+}
+
+func (n *MIMENode) findFirst(match func(node *MIMENode) bool) *MIMENode {
+	var found *MIMENode
+	n.Walk(func(node *MIMENode) bool {
+		if found == nil && match(node) {
+			found = node
+		}
+		return found == nil
+	})
+	return found
+}
+
+// PreferredBody returns the body a mail reader would display, preferring the
+// given media types in order. It follows RFC 2046:
+//
+//   - Of the parts of a multipart/alternative, later parts are more faithful
+//     to the original, so the last one of the most preferred type wins.
+//   - Of a multipart/related, only the root part (the "start" parameter or
+//     the first part) is the body; the other parts are resources it uses.
+//   - Of other multiparts, such as multipart/mixed, the first part of the
+//     most preferred type wins.
+//
+// Attachments are never returned. If no part has a preferred type, the most
+// faithful text part is returned, or nil if there is none.
+func (n *MIMENode) PreferredBody(mediaTypes ...string) *MIMENode {
+	node, _ := n.preferredBody(mediaTypes)
+	return node
+}
+
+// preferredBody returns the preferred body and its rank, the index of its
+// type in mediaTypes, or len(mediaTypes) for other text types
+func (n *MIMENode) preferredBody(mediaTypes []string) (*MIMENode, int) {
+	if n == nil {
+		return nil, 0
+	}
+
+	if !n.IsMultipart() {
+		if n.IsAttachment() {
+			return nil, 0
+		}
+		for i, mediaType := range mediaTypes {
+			if strings.EqualFold(n.ContentType, mediaType) {
+				return n, i
+			}
+		}
+		if strings.HasPrefix(n.ContentType, "text/") && n.ContentType != "text/rfc822-headers" {
+			return n, len(mediaTypes)
+		}
+		return nil, 0
+	}
+
+	switch n.ContentType {
+	case "multipart/related":
+		// The start parameter names one of the parts, never the entity
+		// itself or a nested part
+		var root *MIMENode
+		start := strings.Trim(n.Params["start"], "<>")
+		for _, child := range n.Children {
+			if start != "" && child.ContentID == start {
+				root = child
+				break
+			}
+		}
+		if root == nil && len(n.Children) > 0 {
+			root = n.Children[0]
+		}
+		return root.preferredBody(mediaTypes)
+
+	case "multipart/alternative":
+		var best *MIMENode
+		bestRank := 0
+		for _, child := range n.Children {
+			if node, rank := child.preferredBody(mediaTypes); node != nil && (best == nil || rank <= bestRank) {
+				best, bestRank = node, rank
+			}
+		}
+		return best, bestRank
+
+	default:
+		var best *MIMENode
+		bestRank := 0
+		for _, child := range n.Children {
+			if node, rank := child.preferredBody(mediaTypes); node != nil && (best == nil || rank < bestRank) {
+				best, bestRank = node, rank
+			}
+		}
+		return best, bestRank
+	}
+}
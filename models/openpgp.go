@@ -0,0 +1,1095 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// OpenPGP packet tags (RFC 4880)
+const (
+	pgpTagPKESK          = 1
+	pgpTagSignature      = 2
+	pgpTagOnePass        = 4
+	pgpTagSecretKey      = 5
+	pgpTagPublicKey      = 6
+	pgpTagSecretSubkey   = 7
+	pgpTagCompressed     = 8
+	pgpTagSymEncrypted   = 9
+	pgpTagLiteral        = 11
+	pgpTagUserID         = 13
+	pgpTagPublicSubkey   = 14
+	pgpTagSymEncryptedIP = 18
+)
+
+// OpenPGP public key algorithms
+const (
+	pgpRSA            = 1
+	pgpRSAEncryptOnly = 2
+	pgpRSASignOnly    = 3
+	pgpECDH           = 18
+	pgpECDSA          = 19
+	pgpEdDSA          = 22
+)
+
+// maxPGPLiteralSize limits the decompressed size of PGP messages
+const maxPGPLiteralSize = 64 << 20
+
+// pgpHashes are the supported hash algorithms by OpenPGP ID
+var pgpHashes = map[byte]crypto.Hash{
+	2:  crypto.SHA1,
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// PGPKeyring is a set of OpenPGP public and secret keys. Only version 4 RSA
+// and Ed25519 keys are supported. A key is only added with the user IDs its
+// self-signatures certify and the subkeys its binding signatures bind, and
+// every key in the keyring is trusted. Expiry and revocation are not
+// checked.
+type PGPKeyring struct {
+	keys []*pgpKey
+}
+
+// pgpKey is a primary key or subkey
+type pgpKey struct {
+	id          uint64
+	fingerprint []byte
+	algorithm   byte
+	// material is the public key packet body, which binding signatures hash
+	material []byte
+	public   crypto.PublicKey
+	private  *rsa.PrivateKey
+	entity   *pgpEntity
+	// canSign is set for primary keys and for subkeys whose binding carries
+	// a valid primary key binding signature
+	canSign bool
+}
+
+// pgpEntity holds the user IDs shared by a primary key and its subkeys
+type pgpEntity struct {
+	userIDs []string
+}
+
+// ReadPGPKeyring reads armored or binary OpenPGP keys, as exported by
+// gpg --export or gpg --export-secret-keys. The passphrase decrypts
+// protected secret keys.
+func ReadPGPKeyring(data []byte, passphrase string) (*PGPKeyring, error) {
+	k := &PGPKeyring{}
+	if err := k.Add(data, passphrase); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Add reads more armored or binary OpenPGP keys into the keyring. Secret
+// keys are merged into their public keys.
+func (k *PGPKeyring) Add(data []byte, passphrase string) error {
+	blocks, err := pgpDearmor(data)
+	if err != nil {
+		return fmt.Errorf("reading keyring: %w", err)
+	}
+	for _, block := range blocks {
+		packets, err := readPGPPackets(block)
+		if err != nil {
+			return fmt.Errorf("reading keyring: %w", err)
+		}
+		start := -1
+		for i, p := range packets {
+			if p.tag != pgpTagPublicKey && p.tag != pgpTagSecretKey {
+				continue
+			}
+			if start >= 0 {
+				if err := k.addTransferableKey(packets[start:i], passphrase); err != nil {
+					return fmt.Errorf("reading keyring: %w", err)
+				}
+			}
+			start = i
+		}
+		if start >= 0 {
+			if err := k.addTransferableKey(packets[start:], passphrase); err != nil {
+				return fmt.Errorf("reading keyring: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// addTransferableKey adds a primary key with the user IDs its
+// self-signatures certify and the subkeys its binding signatures bind
+// (RFC 4880, section 11.1). A key without a certified user ID is skipped.
+func (k *PGPKeyring) addTransferableKey(packets []pgpPacket, passphrase string) error {
+	primary, err := parsePGPKey(packets[0], passphrase)
+	if err != nil || primary == nil {
+		return err
+	}
+	primary.canSign = true
+	entity := &pgpEntity{}
+	primary.entity = entity
+
+	var subkeys []*pgpKey
+	var userID []byte
+	var subkey *pgpKey
+	userIDValid, subkeyValid := false, false
+	finish := func() {
+		if userID != nil && userIDValid {
+			entity.userIDs = append(entity.userIDs, string(userID))
+		}
+		if subkey != nil && subkeyValid {
+			subkeys = append(subkeys, subkey)
+		}
+		userID, subkey = nil, nil
+		userIDValid, subkeyValid = false, false
+	}
+
+	for _, p := range packets[1:] {
+		switch p.tag {
+		case pgpTagUserID:
+			finish()
+			userID = p.body
+		case pgpTagPublicSubkey, pgpTagSecretSubkey:
+			finish()
+			if subkey, err = parsePGPKey(p, passphrase); err != nil {
+				return err
+			}
+		case pgpTagSignature:
+			sig, err := parsePGPSignature(p.body)
+			if err != nil {
+				continue
+			}
+			switch {
+			case userID != nil && sig.sigType >= 0x10 && sig.sigType <= 0x13:
+				userIDValid = userIDValid || primary.verifyUserID(sig, userID) == nil
+			case subkey != nil && sig.sigType == 0x18 && !subkeyValid:
+				subkeyValid = primary.bindSubkey(sig, subkey)
+			}
+		default:
+			// User attributes and unknown packets end the current component
+			finish()
+		}
+	}
+	finish()
+
+	if len(entity.userIDs) == 0 {
+		return nil
+	}
+	k.add(primary)
+	for _, subkey := range subkeys {
+		subkey.entity = entity
+		k.add(subkey)
+	}
+	return nil
+}
+
+// verifyUserID verifies a certification of the user ID by the primary key
+func (primary *pgpKey) verifyUserID(sig *pgpSignature, userID []byte) error {
+	h := sig.hash.New()
+	primary.writeMaterial(h)
+	h.Write([]byte{0xb4})
+	_ = binary.Write(h, binary.BigEndian, uint32(len(userID)))
+	h.Write(userID)
+	return sig.check(primary, h)
+}
+
+// bindSubkey verifies a subkey binding signature by the primary key and
+// reports whether the subkey is bound. A subkey is only bound for signing
+// if the binding embeds a valid primary key binding signature by the
+// subkey, and a binding that flags a subkey for signing without one fails.
+func (primary *pgpKey) bindSubkey(sig *pgpSignature, subkey *pgpKey) bool {
+	h := sig.hash.New()
+	primary.writeMaterial(h)
+	subkey.writeMaterial(h)
+	if sig.check(primary, h) != nil {
+		return false
+	}
+
+	if back, err := parsePGPSignature(sig.embedded); err == nil && back.sigType == 0x19 {
+		h := back.hash.New()
+		primary.writeMaterial(h)
+		subkey.writeMaterial(h)
+		subkey.canSign = back.check(subkey, h) == nil
+	}
+	const flagSign = 0x02
+	return subkey.canSign || !sig.hasKeyFlags || sig.keyFlags&flagSign == 0
+}
+
+// writeMaterial hashes the public key packet as binding signatures sign it
+func (key *pgpKey) writeMaterial(h hash.Hash) {
+	h.Write([]byte{0x99, byte(len(key.material) >> 8), byte(len(key.material))})
+	h.Write(key.material)
+}
+
+// add adds a key or merges its secret part into a known key
+func (k *PGPKeyring) add(key *pgpKey) {
+	for _, known := range k.keys {
+		if bytes.Equal(known.fingerprint, key.fingerprint) {
+			if known.private == nil {
+				known.private = key.private
+			}
+			return
+		}
+	}
+	k.keys = append(k.keys, key)
+}
+
+// Len returns the number of primary keys and subkeys
+func (k *PGPKeyring) Len() int {
+	if k == nil {
+		return 0
+	}
+	return len(k.keys)
+}
+
+// find returns the key with the fingerprint, or the key ID if the
+// fingerprint is nil
+func (k *PGPKeyring) find(id uint64, fingerprint []byte) *pgpKey {
+	if k == nil {
+		return nil
+	}
+	for _, key := range k.keys {
+		if fingerprint != nil && bytes.Equal(key.fingerprint, fingerprint) || fingerprint == nil && key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// userID returns the first user ID of the key
+func (key *pgpKey) userID() string {
+	if key.entity == nil || len(key.entity.userIDs) == 0 {
+		return ""
+	}
+	return key.entity.userIDs[0]
+}
+
+// VerifyPGP verifies a detached PGP signature of the content, the signed
+// MIME entity in canonical form. Signatures by keys that are not in the
+// PGPKeyring are reported as invalid. An error is returned only for
+// malformed signatures.
+func (k *SecurityKeys) VerifyPGP(signature, content []byte) ([]SignatureResult, error) {
+	blocks, err := pgpDearmor(signature)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %w", err)
+	}
+	var results []SignatureResult
+	for _, block := range blocks {
+		packets, err := readPGPPackets(block)
+		if err != nil {
+			return nil, fmt.Errorf("reading signature: %w", err)
+		}
+		for _, p := range packets {
+			if p.tag == pgpTagSignature {
+				results = append(results, k.verifyPGPSignature(p.body, content))
+			}
+		}
+	}
+	if len(results) == 0 {
+		return nil, errors.New("reading signature: no signature packet")
+	}
+	return results, nil
+}
+
+// DecryptPGP decrypts a PGP message with a secret key of the PGPKeyring and
+// returns the literal data, i.e. the decrypted MIME entity, and the results of
+// verifying the signatures inside the encryption
+func (k *SecurityKeys) DecryptPGP(data []byte) ([]byte, []SignatureResult, error) {
+	blocks, err := pgpDearmor(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading message: %w", err)
+	}
+	if len(blocks) != 1 {
+		return nil, nil, errors.New("reading message: expected one PGP message")
+	}
+	packets, err := readPGPPackets(blocks[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading message: %w", err)
+	}
+
+	var sessionKeys [][]byte
+	for _, p := range packets {
+		switch p.tag {
+		case pgpTagPKESK:
+			if key, err := k.decryptSessionKey(p.body); err == nil {
+				sessionKeys = append(sessionKeys, key)
+			}
+		case pgpTagSymEncrypted:
+			return nil, nil, errors.New("message is encrypted without integrity protection")
+		case pgpTagSymEncryptedIP:
+			if len(sessionKeys) == 0 {
+				return nil, nil, ErrNoDecryptionKey
+			}
+			var plaintext []byte
+			for _, key := range sessionKeys {
+				if plaintext, err = decryptSEIPD(key, p.body); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			inner, err := readPGPPackets(plaintext)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading decrypted message: %w", err)
+			}
+			return k.readPGPLiteral(inner, 0)
+		}
+	}
+	return nil, nil, errors.New("reading message: no encrypted data")
+}
+
+// decryptSessionKey decrypts a version 3 public-key encrypted session key
+// packet and returns the algorithm ID followed by the session key
+func (k *SecurityKeys) decryptSessionKey(body []byte) ([]byte, error) {
+	if len(body) < 10 || body[0] != 3 {
+		return nil, errors.New("unsupported session key packet")
+	}
+	id := binary.BigEndian.Uint64(body[1:9])
+	if body[9] != pgpRSA && body[9] != pgpRSAEncryptOnly {
+		return nil, fmt.Errorf("unsupported session key algorithm %d", body[9])
+	}
+	encrypted, _, err := readMPI(body[10:])
+	if err != nil {
+		return nil, err
+	}
+	if k == nil || k.PGPKeyring == nil {
+		return nil, ErrNoDecryptionKey
+	}
+
+	for _, key := range k.PGPKeyring.keys {
+		if key.private == nil || id != 0 && key.id != id {
+			continue
+		}
+		padded := leftPad(encrypted, key.private.Size())
+		m, err := rsa.DecryptPKCS1v15(nil, key.private, padded)
+		if err != nil || len(m) < 3 {
+			continue
+		}
+		sessionKey, checksum := m[:len(m)-2], binary.BigEndian.Uint16(m[len(m)-2:])
+		var sum uint16
+		for _, c := range sessionKey[1:] {
+			sum += uint16(c)
+		}
+		if sum == checksum {
+			return sessionKey, nil
+		}
+	}
+	return nil, ErrNoDecryptionKey
+}
+
+// readPGPLiteral reads the literal data of decrypted packets, unwrapping
+// compressed data, and verifies the signatures over it
+func (k *SecurityKeys) readPGPLiteral(packets []pgpPacket, depth int) ([]byte, []SignatureResult, error) {
+	if depth > 4 {
+		return nil, nil, errors.New("compressed data nested too deeply")
+	}
+	var literal []byte
+	var signatures [][]byte
+	found := false
+	for _, p := range packets {
+		switch p.tag {
+		case pgpTagCompressed:
+			inner, err := decompressPGP(p.body)
+			if err != nil {
+				return nil, nil, err
+			}
+			innerPackets, err := readPGPPackets(inner)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading compressed data: %w", err)
+			}
+			return k.readPGPLiteral(innerPackets, depth+1)
+		case pgpTagLiteral:
+			if len(p.body) < 6 || 2+int(p.body[1])+4 > len(p.body) {
+				return nil, nil, errors.New("truncated literal data")
+			}
+			literal, found = p.body[2+int(p.body[1])+4:], true
+		case pgpTagSignature:
+			signatures = append(signatures, p.body)
+		}
+	}
+	if !found {
+		return nil, nil, errors.New("decrypted message has no literal data")
+	}
+
+	var results []SignatureResult
+	for _, sig := range signatures {
+		results = append(results, k.verifyPGPSignature(sig, literal))
+	}
+	return literal, results, nil
+}
+
+// verifyPGPSignature verifies a version 4 signature packet over binary or
+// text data
+func (k *SecurityKeys) verifyPGPSignature(body, data []byte) SignatureResult {
+	r := SignatureResult{Protocol: ProtocolPGP}
+	sig, err := parsePGPSignature(body)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.KeyID = fmt.Sprintf("%016X", sig.issuer)
+	r.SignedAt = sig.created
+
+	var keyring *PGPKeyring
+	if k != nil {
+		keyring = k.PGPKeyring
+	}
+	key := keyring.find(sig.issuer, sig.fingerprint)
+	if key == nil {
+		r.Err = fmt.Errorf("unknown signing key %s", r.KeyID)
+		return r
+	}
+	r.KeyID = fmt.Sprintf("%016X", key.id)
+	r.Signer = key.userID()
+	if !key.canSign {
+		r.Err = fmt.Errorf("key %s is not bound for signing", r.KeyID)
+		return r
+	}
+
+	switch sig.sigType {
+	case 0x00:
+	case 0x01:
+		data = canonicalText(data)
+	default:
+		r.Err = fmt.Errorf("unsupported signature type %#02x", sig.sigType)
+		return r
+	}
+	h := sig.hash.New()
+	h.Write(data)
+	if err := sig.check(key, h); err != nil {
+		r.Err = fmt.Errorf("signature does not match: %w", err)
+		return r
+	}
+	r.Valid, r.Trusted = true, true
+	return r
+}
+
+// check verifies the signature by the key over the data already written
+// to h
+func (sig *pgpSignature) check(key *pgpKey, h hash.Hash) error {
+	h.Write(sig.hashed)
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(sig.hashed)))
+	h.Write(trailer)
+	digest := h.Sum(nil)
+
+	if !bytes.Equal(digest[:2], sig.left16) {
+		return errors.New("digest prefix differs")
+	}
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if len(sig.mpis) != 1 {
+			return errors.New("malformed RSA signature")
+		}
+		return rsa.VerifyPKCS1v15(pub, sig.hash, digest, leftPad(sig.mpis[0], pub.Size()))
+	case ed25519.PublicKey:
+		if len(sig.mpis) != 2 || len(sig.mpis[0]) > 32 || len(sig.mpis[1]) > 32 {
+			return errors.New("malformed EdDSA signature")
+		}
+		if !ed25519.Verify(pub, digest, append(leftPad(sig.mpis[0], 32), leftPad(sig.mpis[1], 32)...)) {
+			return errors.New("verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key algorithm %d", key.algorithm)
+	}
+}
+
+// pgpSignature is a parsed version 4 signature packet
+type pgpSignature struct {
+	sigType     byte
+	algorithm   byte
+	hash        crypto.Hash
+	hashed      []byte
+	created     time.Time
+	issuer      uint64
+	fingerprint []byte
+	keyFlags    byte
+	hasKeyFlags bool
+	embedded    []byte
+	left16      []byte
+	mpis        [][]byte
+}
+
+// parsePGPSignature parses a version 4 signature packet
+func parsePGPSignature(body []byte) (*pgpSignature, error) {
+	if len(body) < 6 || body[0] != 4 {
+		return nil, errors.New("unsupported signature version")
+	}
+	sig := &pgpSignature{sigType: body[1], algorithm: body[2]}
+	var ok bool
+	if sig.hash, ok = pgpHashes[body[3]]; !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %d", body[3])
+	}
+
+	hashedLen := int(binary.BigEndian.Uint16(body[4:6]))
+	if 6+hashedLen+2 > len(body) {
+		return nil, errors.New("truncated signature")
+	}
+	sig.hashed = body[:6+hashedLen]
+	unhashedLen := int(binary.BigEndian.Uint16(body[6+hashedLen:]))
+	rest := body[6+hashedLen+2:]
+	if unhashedLen+2 > len(rest) {
+		return nil, errors.New("truncated signature")
+	}
+	if err := sig.readSubpackets(body[6 : 6+hashedLen]); err != nil {
+		return nil, err
+	}
+	if err := sig.readSubpackets(rest[:unhashedLen]); err != nil {
+		return nil, err
+	}
+	sig.left16, rest = rest[unhashedLen:unhashedLen+2], rest[unhashedLen+2:]
+
+	for len(rest) > 0 {
+		mpi, r, err := readMPI(rest)
+		if err != nil {
+			return nil, err
+		}
+		sig.mpis, rest = append(sig.mpis, mpi), r
+	}
+	return sig, nil
+}
+
+// readSubpackets reads the creation time, issuer, key flags and embedded
+// signature of signature subpackets
+func (sig *pgpSignature) readSubpackets(b []byte) error {
+	for len(b) > 0 {
+		var length, n int
+		switch c := int(b[0]); {
+		case c < 192:
+			length, n = c, 1
+		case c < 255 && len(b) >= 2:
+			length, n = (c-192)<<8+int(b[1])+192, 2
+		case c == 255 && len(b) >= 5:
+			length, n = int(binary.BigEndian.Uint32(b[1:5])), 5
+		default:
+			return errors.New("truncated signature subpacket")
+		}
+		if length < 1 || n+length > len(b) {
+			return errors.New("truncated signature subpacket")
+		}
+		data := b[n+1 : n+length]
+		switch b[n] & 0x7f {
+		case 2:
+			if len(data) == 4 {
+				sig.created = time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC()
+			}
+		case 16:
+			if len(data) == 8 {
+				sig.issuer = binary.BigEndian.Uint64(data)
+			}
+		case 27:
+			if len(data) > 0 {
+				sig.keyFlags, sig.hasKeyFlags = data[0], true
+			}
+		case 32:
+			sig.embedded = data
+		case 33:
+			if len(data) == 21 && data[0] == 4 {
+				sig.fingerprint = data[1:]
+				sig.issuer = binary.BigEndian.Uint64(data[13:])
+			}
+		}
+		b = b[n+length:]
+	}
+	return nil
+}
+
+// parsePGPKey parses a version 4 public or secret key packet. It returns
+// nil for keys of unsupported versions or algorithms.
+func parsePGPKey(p pgpPacket, passphrase string) (*pgpKey, error) {
+	body := p.body
+	if len(body) < 6 || body[0] != 4 {
+		return nil, nil
+	}
+	key := &pgpKey{algorithm: body[5]}
+	rest := body[6:]
+	var err error
+	switch key.algorithm {
+	case pgpRSA, pgpRSAEncryptOnly, pgpRSASignOnly:
+		var n, e []byte
+		if n, rest, err = readMPI(rest); err != nil {
+			return nil, err
+		}
+		if e, rest, err = readMPI(rest); err != nil {
+			return nil, err
+		}
+		if len(e) > 4 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case pgpEdDSA, pgpECDSA, pgpECDH:
+		if len(rest) < 1 || 1+int(rest[0]) > len(rest) {
+			return nil, errors.New("truncated key")
+		}
+		oid := rest[1 : 1+int(rest[0])]
+		var point []byte
+		if point, rest, err = readMPI(rest[1+int(rest[0]):]); err != nil {
+			return nil, err
+		}
+		if key.algorithm == pgpECDH {
+			if len(rest) < 1 || 1+int(rest[0]) > len(rest) {
+				return nil, errors.New("truncated key")
+			}
+			rest = rest[1+int(rest[0]):]
+		}
+		ed25519OID := []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
+		if key.algorithm == pgpEdDSA && bytes.Equal(oid, ed25519OID) && len(point) == 33 && point[0] == 0x40 {
+			key.public = ed25519.PublicKey(point[1:])
+		}
+	default:
+		return nil, nil
+	}
+
+	key.material = body[:len(body)-len(rest)]
+	h := sha1.New()
+	key.writeMaterial(h)
+	key.fingerprint = h.Sum(nil)
+	key.id = binary.BigEndian.Uint64(key.fingerprint[12:])
+	if key.public == nil {
+		return nil, nil
+	}
+
+	if pub, ok := key.public.(*rsa.PublicKey); ok && (p.tag == pgpTagSecretKey || p.tag == pgpTagSecretSubkey) {
+		if key.private, err = readRSASecret(pub, rest, passphrase); err != nil {
+			return nil, fmt.Errorf("reading secret key %016X: %w", key.id, err)
+		}
+	}
+	return key, nil
+}
+
+// readRSASecret reads the secret part of an RSA key packet, decrypting it
+// with the passphrase if it is protected
+func readRSASecret(pub *rsa.PublicKey, b []byte, passphrase string) (*rsa.PrivateKey, error) {
+	if len(b) < 1 {
+		return nil, errors.New("truncated secret key")
+	}
+	usage, b := b[0], b[1:]
+	var secret []byte
+	switch usage {
+	case 0:
+		if len(b) < 2 {
+			return nil, errors.New("truncated secret key")
+		}
+		secret = b[:len(b)-2]
+		var sum uint16
+		for _, c := range secret {
+			sum += uint16(c)
+		}
+		if sum != binary.BigEndian.Uint16(b[len(b)-2:]) {
+			return nil, errors.New("secret key checksum mismatch")
+		}
+	case 254, 255:
+		if len(b) < 2 {
+			return nil, errors.New("truncated secret key")
+		}
+		block, s2kLen, err := pgpS2K(b[0], b[1:], passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, nil // a gnu-dummy stub without secret
+		}
+		b = b[1+s2kLen:]
+		if len(b) < block.BlockSize() {
+			return nil, errors.New("truncated secret key")
+		}
+		iv, encrypted := b[:block.BlockSize()], b[block.BlockSize():]
+		plaintext := cfbDecrypt(block, iv, encrypted)
+		if usage == 254 {
+			if len(plaintext) < sha1.Size {
+				return nil, errors.New("truncated secret key")
+			}
+			secret = plaintext[:len(plaintext)-sha1.Size]
+			sum := sha1.Sum(secret)
+			if subtle.ConstantTimeCompare(sum[:], plaintext[len(secret):]) != 1 {
+				return nil, errors.New("wrong passphrase")
+			}
+		} else {
+			if len(plaintext) < 2 {
+				return nil, errors.New("truncated secret key")
+			}
+			secret = plaintext[:len(plaintext)-2]
+			var sum uint16
+			for _, c := range secret {
+				sum += uint16(c)
+			}
+			if sum != binary.BigEndian.Uint16(plaintext[len(secret):]) {
+				return nil, errors.New("wrong passphrase")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported secret key protection %d", usage)
+	}
+
+	var mpis [3][]byte
+	for i := range mpis {
+		var err error
+		if mpis[i], secret, err = readMPI(secret); err != nil {
+			return nil, err
+		}
+	}
+	priv := &rsa.PrivateKey{
+		PublicKey: *pub,
+		D:         new(big.Int).SetBytes(mpis[0]),
+		Primes:    []*big.Int{new(big.Int).SetBytes(mpis[1]), new(big.Int).SetBytes(mpis[2])},
+	}
+	if err := priv.Validate(); err != nil {
+		return nil, err
+	}
+	priv.Precompute()
+	return priv, nil
+}
+
+// pgpS2K derives the key of a passphrase-protected secret key with the
+// cipher algorithm and string-to-key specifier, and returns the cipher and
+// the length of the specifier. It returns a nil cipher for gnu-dummy stubs.
+func pgpS2K(algorithm byte, spec []byte, passphrase string) (cipher.Block, int, error) {
+	if len(spec) < 2 {
+		return nil, 0, errors.New("truncated string-to-key specifier")
+	}
+	var salt []byte
+	count, n := 0, 2
+	switch spec[0] {
+	case 0:
+	case 1:
+		n = 10
+	case 3:
+		n = 11
+	case 101:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported string-to-key type %d", spec[0])
+	}
+	if len(spec) < n {
+		return nil, 0, errors.New("truncated string-to-key specifier")
+	}
+	if spec[0] != 0 {
+		salt = spec[2:10]
+	}
+	if spec[0] == 3 {
+		c := int(spec[10])
+		count = (16 + c&15) << (c>>4 + 6)
+	}
+	hash, ok := pgpHashes[spec[1]]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported string-to-key hash %d", spec[1])
+	}
+	size, ok := pgpCipherKeySizes[algorithm]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported cipher %d", algorithm)
+	}
+
+	input := append(append([]byte{}, salt...), passphrase...)
+	if count < len(input) {
+		count = len(input)
+	}
+	var key []byte
+	for preload := 0; len(key) < size; preload++ {
+		h := hash.New()
+		h.Write(make([]byte, preload))
+		for written := 0; written < count; written += len(input) {
+			if count-written < len(input) {
+				h.Write(input[:count-written])
+				break
+			}
+			h.Write(input)
+		}
+		key = h.Sum(key)
+	}
+	block, err := pgpCipher(algorithm, key[:size])
+	return block, n, err
+}
+
+// pgpCipherKeySizes are the key sizes of the supported ciphers by OpenPGP ID
+var pgpCipherKeySizes = map[byte]int{2: 24, 7: 16, 8: 24, 9: 32}
+
+// pgpCipher returns the block cipher of an OpenPGP cipher ID
+func pgpCipher(algorithm byte, key []byte) (cipher.Block, error) {
+	size, ok := pgpCipherKeySizes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cipher %d", algorithm)
+	}
+	if len(key) != size {
+		return nil, errors.New("invalid session key size")
+	}
+	if algorithm == 2 {
+		return des.NewTripleDESCipher(key)
+	}
+	return aes.NewCipher(key)
+}
+
+// decryptSEIPD decrypts a version 1 symmetrically encrypted integrity
+// protected data packet with the session key, and checks its modification
+// detection code
+func decryptSEIPD(sessionKey, body []byte) ([]byte, error) {
+	if len(body) < 1 || body[0] != 1 {
+		return nil, errors.New("unsupported encrypted data version")
+	}
+	block, err := pgpCipher(sessionKey[0], sessionKey[1:])
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(body)-1 < bs+2+22 {
+		return nil, errors.New("truncated encrypted data")
+	}
+	plaintext := cfbDecrypt(block, make([]byte, bs), body[1:])
+	if plaintext[bs-2] != plaintext[bs] || plaintext[bs-1] != plaintext[bs+1] {
+		return nil, errors.New("wrong session key")
+	}
+
+	mdc := plaintext[len(plaintext)-22:]
+	if mdc[0] != 0xd3 || mdc[1] != 0x14 {
+		return nil, errors.New("missing modification detection code")
+	}
+	sum := sha1.Sum(plaintext[:len(plaintext)-20])
+	if subtle.ConstantTimeCompare(sum[:], mdc[2:]) != 1 {
+		return nil, errors.New("modification detection code mismatch")
+	}
+	return plaintext[bs+2 : len(plaintext)-22], nil
+}
+
+// decompressPGP decompresses a compressed data packet
+func decompressPGP(body []byte) ([]byte, error) {
+	if len(body) < 1 {
+		return nil, errors.New("truncated compressed data")
+	}
+	var r io.Reader
+	switch body[0] {
+	case 0:
+		return body[1:], nil
+	case 1:
+		r = flate.NewReader(bytes.NewReader(body[1:]))
+	case 2:
+		zr, err := zlib.NewReader(bytes.NewReader(body[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing data: %w", err)
+		}
+		r = zr
+	case 3:
+		r = bzip2.NewReader(bytes.NewReader(body[1:]))
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", body[0])
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxPGPLiteralSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing data: %w", err)
+	}
+	if len(data) > maxPGPLiteralSize {
+		return nil, errors.New("decompressed data too large")
+	}
+	return data, nil
+}
+
+// cfbDecrypt decrypts data in CFB mode
+func cfbDecrypt(block cipher.Block, iv, data []byte) []byte {
+	bs := block.BlockSize()
+	out := make([]byte, len(data))
+	register := append([]byte{}, iv...)
+	stream := make([]byte, bs)
+	for i := 0; i < len(data); i += bs {
+		block.Encrypt(stream, register)
+		end := i + bs
+		if end > len(data) {
+			end = len(data)
+		}
+		subtle.XORBytes(out[i:end], data[i:end], stream)
+		copy(register, data[i:end])
+	}
+	return out
+}
+
+// pgpPacket is an OpenPGP packet with its partial bodies joined
+type pgpPacket struct {
+	tag  byte
+	body []byte
+}
+
+// readPGPPackets reads a sequence of old or new format packets
+func readPGPPackets(b []byte) ([]pgpPacket, error) {
+	var packets []pgpPacket
+	for len(b) > 0 {
+		if b[0]&0x80 == 0 {
+			return nil, errors.New("invalid packet header")
+		}
+		var p pgpPacket
+		if b[0]&0x40 == 0 {
+			p.tag = b[0] >> 2 & 0x0f
+			lengthType := b[0] & 3
+			if lengthType == 3 {
+				p.body, b = b[1:], nil
+			} else {
+				n := 1 << lengthType
+				if len(b) < 1+n {
+					return nil, errors.New("truncated packet header")
+				}
+				var length int
+				for _, c := range b[1 : 1+n] {
+					length = length<<8 | int(c)
+				}
+				if length > len(b)-1-n {
+					return nil, errors.New("truncated packet")
+				}
+				p.body, b = b[1+n:1+n+length], b[1+n+length:]
+			}
+		} else {
+			p.tag = b[0] & 0x3f
+			b = b[1:]
+			for {
+				length, partial, n, err := readNewLength(b)
+				if err != nil {
+					return nil, err
+				}
+				if length > len(b)-n {
+					return nil, errors.New("truncated packet")
+				}
+				p.body = append(p.body, b[n:n+length]...)
+				b = b[n+length:]
+				if !partial {
+					break
+				}
+			}
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
+
+// readNewLength reads a new format packet length and reports whether it is
+// a partial body length
+func readNewLength(b []byte) (length int, partial bool, n int, err error) {
+	if len(b) < 1 {
+		return 0, false, 0, errors.New("truncated packet header")
+	}
+	switch c := int(b[0]); {
+	case c < 192:
+		return c, false, 1, nil
+	case c < 224:
+		if len(b) < 2 {
+			return 0, false, 0, errors.New("truncated packet header")
+		}
+		return (c-192)<<8 + int(b[1]) + 192, false, 2, nil
+	case c < 255:
+		return 1 << (c & 0x1f), true, 1, nil
+	default:
+		if len(b) < 5 {
+			return 0, false, 0, errors.New("truncated packet header")
+		}
+		return int(binary.BigEndian.Uint32(b[1:5])), false, 5, nil
+	}
+}
+
+// readMPI reads a multiprecision integer
+func readMPI(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated integer")
+	}
+	n := (int(binary.BigEndian.Uint16(b)) + 7) / 8
+	if len(b) < 2+n {
+		return nil, nil, errors.New("truncated integer")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
+
+// leftPad pads b with leading zeros to size bytes
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// canonicalText converts line endings to CRLF
+func canonicalText(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+}
+
+// pgpDearmor decodes the ASCII armored blocks of data, or returns data
+// itself if it is binary
+func pgpDearmor(data []byte) ([][]byte, error) {
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		return [][]byte{data}, nil
+	}
+
+	var blocks [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	inBlock, inBody := false, false
+	var encoded strings.Builder
+	var checksum string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case !inBlock:
+			inBlock = strings.HasPrefix(line, "-----BEGIN PGP ")
+		case strings.HasPrefix(line, "-----END PGP "):
+			decoded, err := base64.StdEncoding.DecodeString(encoded.String())
+			if err != nil {
+				return nil, fmt.Errorf("decoding armor: %w", err)
+			}
+			if checksum != "" {
+				want, err := base64.StdEncoding.DecodeString(checksum)
+				if err != nil || len(want) != 3 || crc24(decoded) != uint32(want[0])<<16|uint32(want[1])<<8|uint32(want[2]) {
+					return nil, errors.New("armor checksum mismatch")
+				}
+			}
+			blocks = append(blocks, decoded)
+			inBlock, inBody, checksum = false, false, ""
+			encoded.Reset()
+		case !inBody:
+			// Armor headers end with an empty line
+			inBody = line == ""
+		case strings.HasPrefix(line, "="):
+			checksum = line[1:]
+		default:
+			encoded.WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("decoding armor: %w", err)
+	}
+	if inBlock {
+		return nil, errors.New("armor lacks its END line")
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New("no OpenPGP data")
+	}
+	return blocks, nil
+}
+
+// crc24 computes the armor checksum (RFC 4880 section 6.1)
+func crc24(b []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, c := range b {
+		crc ^= uint32(c) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
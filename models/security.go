@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Security protocols of signed or encrypted messages
+const (
+	// ProtocolSMIME is S/MIME (RFC 8551)
+	ProtocolSMIME = "smime"
+	// ProtocolPGP is PGP/MIME (RFC 3156)
+	ProtocolPGP = "pgp"
+)
+
+// ErrNoDecryptionKey is recorded as the DecryptError of encrypted messages
+// none of the supplied keys can decrypt
+var ErrNoDecryptionKey = errors.New("no key to decrypt the message")
+
+// SecurityKeys are the trust roots, keyrings and private keys used to verify
+// and decrypt S/MIME and PGP/MIME messages. They are meant for test keys; a
+// nil *SecurityKeys verifies nothing and decrypts nothing.
+//
+// The CMS and OpenPGP support is a minimal stdlib-only implementation for
+// asserting on emails in tests. It does not check revocation or key expiry
+// and is not suitable for trust decisions on real mail.
+type SecurityKeys struct {
+	// SMIMERoots are the certificate authorities the certificates of S/MIME
+	// signers must chain to
+	SMIMERoots *x509.CertPool
+	// SMIMEKeys decrypt S/MIME messages
+	SMIMEKeys []SMIMEKey
+	// PGPKeyring holds the public keys PGP signatures are verified with and
+	// the secret keys PGP messages are decrypted with
+	PGPKeyring *PGPKeyring
+	// VerifyTime is the time S/MIME signer certificates must be valid at, the
+	// current time if zero. The signing time a signature records is chosen
+	// by the signer, so it is never used for this.
+	VerifyTime time.Time
+}
+
+// SMIMEKey is a certificate with its private key, which decrypts S/MIME
+// messages encrypted for the certificate
+type SMIMEKey struct {
+	Certificate *x509.Certificate
+	// PrivateKey is an *rsa.PrivateKey
+	PrivateKey crypto.PrivateKey
+}
+
+// LoadSMIMEKey parses a PEM encoded certificate and its private key
+func LoadSMIMEKey(certPEM, keyPEM []byte) (SMIMEKey, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return SMIMEKey{}, fmt.Errorf("loading S/MIME key: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return SMIMEKey{}, fmt.Errorf("loading S/MIME key: %w", err)
+	}
+	return SMIMEKey{Certificate: cert, PrivateKey: pair.PrivateKey}, nil
+}
+
+// Security describes the signatures and encryption of a message. Signed and
+// encrypted layers are unwrapped from the outside in, e.g. a signature
+// inside an encrypted message.
+type Security struct {
+	// Protocol is ProtocolSMIME or ProtocolPGP
+	Protocol  string `json:"protocol"`
+	Signed    bool   `json:"signed"`
+	Encrypted bool   `json:"encrypted"`
+	// Decrypted reports whether the encrypted layers were decrypted
+	Decrypted bool `json:"decrypted"`
+	// Signatures are the results of verifying the signatures of all layers
+	Signatures []SignatureResult `json:"signatures,omitempty"`
+	// DecryptError explains why an encrypted layer could not be decrypted
+	DecryptError error `json:"-"`
+	// Cleartext is the innermost message, without signatures and decrypted,
+	// or nil if it could not be decrypted
+	Cleartext *Message `json:"-"`
+}
+
+// Verified reports whether the message is signed and every signature is
+// valid and trusted
+func (s *Security) Verified() bool {
+	if s == nil || !s.Signed || len(s.Signatures) == 0 {
+		return false
+	}
+	for _, sig := range s.Signatures {
+		if !sig.Valid || !sig.Trusted {
+			return false
+		}
+	}
+	return true
+}
+
+// SignatureResult is the outcome of verifying one S/MIME or PGP signature
+type SignatureResult struct {
+	// Protocol is ProtocolSMIME or ProtocolPGP
+	Protocol string `json:"protocol"`
+	// Signer is the email address or common name of the S/MIME certificate,
+	// or the user ID of the PGP key
+	Signer string `json:"signer,omitempty"`
+	// KeyID is the ID of the PGP key in upper-case hex
+	KeyID string `json:"key_id,omitempty"`
+	// Certificate is the certificate of the S/MIME signer
+	Certificate *x509.Certificate `json:"-"`
+	// SignedAt is the signing time, if the signature records it. It is
+	// informational and not used to check the certificate.
+	SignedAt time.Time `json:"signed_at,omitempty"`
+	// Valid reports whether the signature matches the signed content
+	Valid bool `json:"valid"`
+	// Trusted reports whether the S/MIME certificate chains to the trust
+	// roots, or the PGP key is in the keyring
+	Trusted bool `json:"trusted"`
+	// Err explains why the signature is not valid or not trusted
+	Err error `json:"-"`
+}
+
+// GetSecurity returns the signatures and encryption of the message, parsing
+// the source on first access
+func (m *Message) GetSecurity() *Security {
+	_ = m.LoadParts()
+	return m.Security
+}
+
+// Cleartext returns the decrypted message without its signatures, or the
+// message itself if it is neither signed nor encrypted or could not be
+// decrypted
+func (m *Message) Cleartext() *Message {
+	if err := m.LoadParts(); err != nil || m.Security == nil || m.Security.Cleartext == nil {
+		return m
+	}
+	return m.Security.Cleartext
+}
@@ -0,0 +1,597 @@
+package models
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	_ "crypto/sha1"   // registers crypto.SHA1
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA384 and crypto.SHA512
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Object identifiers of CMS (RFC 5652) and its algorithms
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAOAEP         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// CMS structures (RFC 5652)
+type (
+	cmsContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	}
+
+	cmsSignedData struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo cmsContentInfo
+		Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+		SignerInfos      []cmsSignerInfo `asn1:"set"`
+	}
+
+	cmsSignerInfo struct {
+		Version            int
+		SID                asn1.RawValue
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+		UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+	}
+
+	cmsAttribute struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}
+
+	cmsIssuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+
+	cmsEnvelopedData struct {
+		Version              int
+		OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+		RecipientInfos       []asn1.RawValue `asn1:"set"`
+		EncryptedContentInfo cmsEncryptedContentInfo
+		UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+	}
+
+	cmsKeyTransRecipientInfo struct {
+		Version                int
+		RID                    asn1.RawValue
+		KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedKey           []byte
+	}
+
+	cmsEncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+	}
+
+	cmsOAEPParams struct {
+		Hash pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+	}
+)
+
+// VerifySMIME verifies the CMS SignedData of an S/MIME signature. For
+// detached signatures, content is the signed MIME entity in canonical form;
+// for opaque signatures it is nil and the encapsulated content is returned.
+// Signer certificates are trusted if they chain to SMIMERoots. An error is
+// returned only for malformed signatures.
+func (k *SecurityKeys) VerifySMIME(signature, content []byte) ([]SignatureResult, []byte, error) {
+	info, err := parseCMS(signature, oidSignedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, nil, fmt.Errorf("parsing signed data: %w", err)
+	}
+
+	if content == nil {
+		if len(sd.EncapContentInfo.Content.Bytes) == 0 {
+			return nil, nil, errors.New("detached signature without signed content")
+		}
+		if content, err = octets(sd.EncapContentInfo.Content.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("parsing signed content: %w", err)
+		}
+	}
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("parsing certificates: %w", err)
+		}
+	}
+
+	results := make([]SignatureResult, 0, len(sd.SignerInfos))
+	for _, signer := range sd.SignerInfos {
+		results = append(results, k.verifySMIMESigner(signer, certs, content))
+	}
+	return results, content, nil
+}
+
+// verifySMIMESigner verifies the signature of one signer
+func (k *SecurityKeys) verifySMIMESigner(signer cmsSignerInfo, certs []*x509.Certificate, content []byte) SignatureResult {
+	r := SignatureResult{Protocol: ProtocolSMIME}
+	cert := findCertificate(certs, signer.SID)
+	if cert == nil {
+		r.Err = errors.New("signer certificate is not included")
+		return r
+	}
+	r.Certificate = cert
+	r.Signer = cert.Subject.CommonName
+	if len(cert.EmailAddresses) > 0 {
+		r.Signer = cert.EmailAddresses[0]
+	}
+
+	hash, ok := cmsHashes[signer.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		r.Err = fmt.Errorf("unsupported digest algorithm %s", signer.DigestAlgorithm.Algorithm)
+		return r
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	signed := content
+	if len(signer.SignedAttrs.Bytes) > 0 {
+		attrs, err := parseCMSAttributes(signer.SignedAttrs.Bytes)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		var messageDigest []byte
+		if v, ok := attrs[oidMessageDigest.String()]; !ok {
+			r.Err = errors.New("signed attributes lack the message digest")
+			return r
+		} else if _, err := asn1.Unmarshal(v, &messageDigest); err != nil {
+			r.Err = fmt.Errorf("parsing message digest: %w", err)
+			return r
+		}
+		if v, ok := attrs[oidSigningTime.String()]; ok {
+			_, _ = asn1.Unmarshal(v, &r.SignedAt)
+		}
+		if !bytes.Equal(messageDigest, digest) {
+			r.Err = errors.New("message digest does not match the content")
+			return r
+		}
+		// The attributes are signed as a SET OF, not with their implicit tag
+		signed = append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	}
+
+	algorithm := cmsSignatureAlgorithm(signer.DigestAlgorithm.Algorithm, signer.SignatureAlgorithm.Algorithm)
+	if algorithm == x509.UnknownSignatureAlgorithm {
+		r.Err = fmt.Errorf("unsupported signature algorithm %s", signer.SignatureAlgorithm.Algorithm)
+		return r
+	}
+	if err := cert.CheckSignature(algorithm, signed, signer.Signature); err != nil {
+		r.Err = fmt.Errorf("signature does not match: %w", err)
+		return r
+	}
+	r.Valid = true
+
+	if k == nil || k.SMIMERoots == nil {
+		r.Err = errors.New("no trust roots to verify the signer certificate")
+		return r
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         k.SMIMERoots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime:   k.VerifyTime,
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		r.Err = fmt.Errorf("signer certificate is not trusted: %w", err)
+		return r
+	}
+	r.Trusted = true
+	return r
+}
+
+// DecryptSMIME decrypts the CMS EnvelopedData of an S/MIME message with the
+// first SMIMEKeys entry it is encrypted for, and returns the decrypted MIME
+// entity
+func (k *SecurityKeys) DecryptSMIME(data []byte) ([]byte, error) {
+	info, err := parseCMS(data, oidEnvelopedData)
+	if err != nil {
+		return nil, err
+	}
+	var ed cmsEnvelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("parsing enveloped data: %w", err)
+	}
+
+	var contentKey []byte
+	if k != nil {
+	recipients:
+		for _, raw := range ed.RecipientInfos {
+			var ri cmsKeyTransRecipientInfo
+			if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagSequence {
+				continue // only key transport recipients are supported
+			}
+			if _, err := asn1.Unmarshal(raw.FullBytes, &ri); err != nil {
+				return nil, fmt.Errorf("parsing recipient: %w", err)
+			}
+			for _, key := range k.SMIMEKeys {
+				if key.Certificate != nil && findCertificate([]*x509.Certificate{key.Certificate}, ri.RID) == nil {
+					continue
+				}
+				if contentKey, err = decryptContentKey(ri, key.PrivateKey); err == nil {
+					break recipients
+				}
+			}
+		}
+	}
+	if contentKey == nil {
+		return nil, ErrNoDecryptionKey
+	}
+
+	eci := ed.EncryptedContentInfo
+	ciphertext := eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// BER encodes long content as constructed OCTET STRING segments
+		if ciphertext, err = joinOctets(ciphertext); err != nil {
+			return nil, fmt.Errorf("parsing encrypted content: %w", err)
+		}
+	}
+	return decryptCBC(eci.ContentEncryptionAlgorithm, contentKey, ciphertext)
+}
+
+// SMIMEContentType returns the content type of a CMS ContentInfo, e.g.
+// "signed-data" or "enveloped-data", as named by the smime-type parameter
+func SMIMEContentType(data []byte) string {
+	der, err := berToDER(data)
+	if err != nil {
+		return ""
+	}
+	var info cmsContentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return ""
+	}
+	switch {
+	case info.ContentType.Equal(oidSignedData):
+		return "signed-data"
+	case info.ContentType.Equal(oidEnvelopedData):
+		return "enveloped-data"
+	}
+	return ""
+}
+
+// parseCMS parses a BER or DER encoded ContentInfo of the content type
+func parseCMS(data []byte, contentType asn1.ObjectIdentifier) (*cmsContentInfo, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CMS: %w", err)
+	}
+	var info cmsContentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("parsing CMS: %w", err)
+	}
+	if !info.ContentType.Equal(contentType) {
+		return nil, fmt.Errorf("CMS content type is %s, not %s", info.ContentType, contentType)
+	}
+	return &info, nil
+}
+
+// cmsHashes are the supported digest algorithms by OID
+var cmsHashes = map[string]crypto.Hash{
+	oidSHA1.String():   crypto.SHA1,
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+// cmsSignatureAlgorithm maps the digest and signature algorithm of a signer
+// to an x509.SignatureAlgorithm. Signers name either a combined algorithm or
+// the key algorithm.
+func cmsSignatureAlgorithm(digest, signature asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	switch {
+	case signature.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA
+	case signature.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA
+	case signature.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA
+	case signature.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA
+	case signature.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256
+	case signature.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384
+	case signature.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512
+	}
+
+	rsa := map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA1: x509.SHA1WithRSA, crypto.SHA256: x509.SHA256WithRSA,
+		crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA,
+	}
+	ecdsa := map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA1: x509.ECDSAWithSHA1, crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512,
+	}
+	hash := cmsHashes[digest.String()]
+	switch {
+	case signature.Equal(oidRSAEncryption):
+		return rsa[hash]
+	case signature.Equal(oidECPublicKey):
+		return ecdsa[hash]
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// parseCMSAttributes parses a SET OF Attribute into the DER of the first
+// value of each attribute by OID
+func parseCMSAttributes(set []byte) (map[string][]byte, error) {
+	attrs := make(map[string][]byte)
+	for rest := set; len(rest) > 0; {
+		var attr cmsAttribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, fmt.Errorf("parsing signed attributes: %w", err)
+		}
+		var value asn1.RawValue
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+			return nil, fmt.Errorf("parsing signed attributes: %w", err)
+		}
+		attrs[attr.Type.String()] = value.FullBytes
+	}
+	return attrs, nil
+}
+
+// findCertificate returns the certificate identified by a SignerIdentifier
+// or RecipientIdentifier: an IssuerAndSerialNumber or a [0] subject key ID
+func findCertificate(certs []*x509.Certificate, id asn1.RawValue) *x509.Certificate {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, id.Bytes) {
+				return cert
+			}
+		}
+		return nil
+	}
+
+	var ias cmsIssuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return nil
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// decryptContentKey decrypts the content encryption key of a recipient
+func decryptContentKey(ri cmsKeyTransRecipientInfo, key crypto.PrivateKey) ([]byte, error) {
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	switch alg := ri.KeyEncryptionAlgorithm; {
+	case alg.Algorithm.Equal(oidRSAEncryption):
+		return rsa.DecryptPKCS1v15(nil, priv, ri.EncryptedKey)
+	case alg.Algorithm.Equal(oidRSAOAEP):
+		hash := crypto.SHA1
+		var params cmsOAEPParams
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err == nil && params.Hash.Algorithm != nil {
+			if hash, ok = cmsHashes[params.Hash.Algorithm.String()]; !ok {
+				return nil, fmt.Errorf("unsupported OAEP hash %s", params.Hash.Algorithm)
+			}
+		}
+		return rsa.DecryptOAEP(hash.New(), nil, priv, ri.EncryptedKey, nil)
+	default:
+		return nil, fmt.Errorf("unsupported key encryption algorithm %s", alg.Algorithm)
+	}
+}
+
+// decryptCBC decrypts content encrypted with AES or 3DES in CBC mode and
+// removes its PKCS #7 padding
+func decryptCBC(alg pkix.AlgorithmIdentifier, key, ciphertext []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	switch {
+	case alg.Algorithm.Equal(oidAES128CBC), alg.Algorithm.Equal(oidAES192CBC), alg.Algorithm.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(key)
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported content encryption algorithm %s", alg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil || len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid content encryption IV")
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted content is not a multiple of the block size")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plaintext[len(plaintext)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("invalid padding of decrypted content")
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// octets parses a DER OCTET STRING
+func octets(der []byte) ([]byte, error) {
+	var b []byte
+	_, err := asn1.Unmarshal(der, &b)
+	return b, err
+}
+
+// joinOctets concatenates the content of a sequence of OCTET STRINGs
+func joinOctets(der []byte) ([]byte, error) {
+	var joined []byte
+	for len(der) > 0 {
+		var segment []byte
+		var err error
+		if der, err = asn1.Unmarshal(der, &segment); err != nil {
+			return nil, err
+		}
+		joined = append(joined, segment...)
+	}
+	return joined, nil
+}
+
+// maxBERDepth limits the nesting of BER elements
+const maxBERDepth = 64
+
+// berToDER re-encodes BER, as written by streaming S/MIME implementations,
+// with definite lengths, and joins constructed OCTET STRINGs, so that
+// encoding/asn1 can parse it
+func berToDER(ber []byte) ([]byte, error) {
+	der, _, err := berElement(ber, 0)
+	return der, err
+}
+
+// berElement re-encodes the BER element at the start of b and returns the
+// rest of b
+func berElement(b []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxBERDepth {
+		return nil, nil, errors.New("BER nested too deeply")
+	}
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated BER element")
+	}
+	i := 1
+	if b[0]&0x1f == 0x1f {
+		for i < len(b) && b[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(b) {
+		return nil, nil, errors.New("truncated BER tag")
+	}
+	tag := b[:i]
+	constructed := b[0]&0x20 != 0
+
+	var content, rest []byte
+	var children [][]byte
+	if b[i] == 0x80 {
+		if !constructed {
+			return nil, nil, errors.New("indefinite length of a primitive BER element")
+		}
+		rest = b[i+1:]
+		for {
+			if len(rest) < 2 {
+				return nil, nil, errors.New("BER element lacks its end-of-contents")
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			child, r, err := berElement(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			children, rest = append(children, child), r
+		}
+	} else {
+		length, n := int(b[i]), 1
+		if length&0x80 != 0 {
+			size := length & 0x7f
+			if size == 0 || size > 4 || i+1+size > len(b) {
+				return nil, nil, errors.New("invalid BER length")
+			}
+			length = 0
+			for _, c := range b[i+1 : i+1+size] {
+				length = length<<8 | int(c)
+			}
+			n += size
+		}
+		start := i + n
+		if length < 0 || start+length > len(b) {
+			return nil, nil, errors.New("truncated BER element")
+		}
+		content, rest = b[start:start+length], b[start+length:]
+		if constructed {
+			for inner := content; len(inner) > 0; {
+				child, r, err := berElement(inner, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				children, inner = append(children, child), r
+			}
+		}
+	}
+
+	if constructed {
+		if b[0] == 0x24 {
+			// A constructed OCTET STRING becomes a primitive one
+			joined, err := joinOctets(bytes.Join(children, nil))
+			if err != nil {
+				return nil, nil, err
+			}
+			return derElement([]byte{0x04}, joined), rest, nil
+		}
+		content = bytes.Join(children, nil)
+	}
+	return derElement(tag, content), rest, nil
+}
+
+// derElement encodes an element with a definite length
+func derElement(tag, content []byte) []byte {
+	out := append([]byte{}, tag...)
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, content...)
+}
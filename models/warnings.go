@@ -0,0 +1,55 @@
+package models
+
+// ParseWarningCode classifies a problem recovered from while parsing the MIME
+// source of a message
+type ParseWarningCode string
+
+// Problems recovered from while parsing
+const (
+	// WarningMalformedHeader is a header line that is not a field, or a
+	// header that does not end in a blank line
+	WarningMalformedHeader ParseWarningCode = "malformed_header"
+	// WarningEightBitHeader is a header with unencoded 8-bit characters
+	WarningEightBitHeader ParseWarningCode = "8bit_header"
+	// WarningBareLF is a source with lines ending in LF instead of CRLF
+	WarningBareLF ParseWarningCode = "bare_lf"
+	// WarningMalformedContentType is a Content-Type that could not be parsed
+	WarningMalformedContentType ParseWarningCode = "malformed_content_type"
+	// WarningMissingBoundary is a multipart entity without a boundary
+	// parameter, or whose boundary does not occur in its body
+	WarningMissingBoundary ParseWarningCode = "missing_boundary"
+	// WarningDuplicateBoundary is a multipart entity reusing the boundary
+	// of an enclosing entity
+	WarningDuplicateBoundary ParseWarningCode = "duplicate_boundary"
+	// WarningTruncated is a source that ends before its last multipart
+	// entity was closed
+	WarningTruncated ParseWarningCode = "truncated"
+	// WarningInvalidEncoding is a body that is not valid in its
+	// Content-Transfer-Encoding, such as base64 with broken padding
+	WarningInvalidEncoding ParseWarningCode = "invalid_encoding"
+	// WarningUnknownCharset is a body in a charset that is not converted to
+	// UTF-8
+	WarningUnknownCharset ParseWarningCode = "unknown_charset"
+	// WarningUnparsedEntity is an embedded message, header block or
+	// delivery status that was kept unparsed
+	WarningUnparsedEntity ParseWarningCode = "unparsed_entity"
+)
+
+// ParseWarning is a problem recovered from while parsing the MIME source of a
+// message
+type ParseWarning struct {
+	Code ParseWarningCode `json:"code"`
+	// Path is the part number of the affected entity as in IMAP, e.g. "1.2"
+	// for the second part of the first part, or empty for the message
+	Path string `json:"path,omitempty"`
+	// Message describes the problem
+	Message string `json:"message"`
+}
+
+// String formats the warning for logs and test failures
+func (w ParseWarning) String() string {
+	if w.Path == "" {
+		return string(w.Code) + ": " + w.Message
+	}
+	return string(w.Code) + " in part " + w.Path + ": " + w.Message
+}
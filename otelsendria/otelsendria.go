@@ -0,0 +1,301 @@
+// Package otelsendria instruments the Sendria client with OpenTelemetry. It
+// creates a client span for every API call, records latency, error and
+// message size metrics, and links captured messages back to the trace that
+// sent them through their traceparent header.
+//
+//	inst, err := otelsendria.New()
+//	if err != nil {
+//		return err
+//	}
+//	client := sendria.NewClient(url, inst.ClientOptions()...)
+package otelsendria
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/models"
+)
+
+// instrumentationName identifies the tracer and meter of this package
+const instrumentationName = "github.com/enthus-golang/sendria/otelsendria"
+
+// Attribute keys set on spans and metrics
+const (
+	AttrMessageID  = attribute.Key("sendria.message.id")
+	AttrEndpoint   = attribute.Key("sendria.endpoint")
+	AttrMethod     = attribute.Key("http.request.method")
+	AttrStatusCode = attribute.Key("http.response.status_code")
+)
+
+// Instrumentation holds the tracer and metric instruments shared by the
+// middleware and the message hook
+type Instrumentation struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	duration   metric.Float64Histogram
+	errors     metric.Int64Counter
+	size       metric.Int64Histogram
+	attachment metric.Int64Histogram
+}
+
+// config collects the options of New
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// Option is a functional option for configuring the Instrumentation
+type Option func(*config)
+
+// WithTracerProvider sets the tracer provider. It defaults to the global one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider sets the meter provider. It defaults to the global one.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// WithPropagator sets the propagator used to inject the trace context into
+// requests to Sendria. It defaults to the global one.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// New creates the instrumentation
+func New(opts ...Option) (*Instrumentation, error) {
+	cfg := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	meter := cfg.meterProvider.Meter(instrumentationName)
+	inst := &Instrumentation{
+		tracer:     cfg.tracerProvider.Tracer(instrumentationName),
+		propagator: cfg.propagator,
+	}
+
+	var err error
+	inst.duration, err = meter.Float64Histogram("sendria.client.request.duration",
+		metric.WithDescription("Duration of Sendria API requests"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("creating duration histogram: %w", err)
+	}
+	inst.errors, err = meter.Int64Counter("sendria.client.request.errors",
+		metric.WithDescription("Sendria API requests that failed or returned an error status"))
+	if err != nil {
+		return nil, fmt.Errorf("creating error counter: %w", err)
+	}
+	inst.size, err = meter.Int64Histogram("sendria.client.message.size",
+		metric.WithDescription("Size of parsed messages"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, fmt.Errorf("creating message size histogram: %w", err)
+	}
+	inst.attachment, err = meter.Int64Histogram("sendria.client.attachment.size",
+		metric.WithDescription("Size of attachments of parsed messages"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, fmt.Errorf("creating attachment size histogram: %w", err)
+	}
+
+	return inst, nil
+}
+
+// ClientOptions returns the client options that install the middleware and
+// the message hook
+func (i *Instrumentation) ClientOptions() []sendria.Option {
+	return []sendria.Option{
+		sendria.WithMiddleware(i.Middleware()),
+		sendria.WithMessageHook(i.MessageHook()),
+	}
+}
+
+// Middleware returns client middleware that traces every request and records
+// its latency and errors. The span ends and the latency is recorded once the
+// response body is read to the end or closed, so they include the transfer.
+func (i *Instrumentation) Middleware() sendria.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return sendria.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			endpoint, messageID := endpointOf(req.URL.Path)
+			attrs := []attribute.KeyValue{AttrMethod.String(req.Method), AttrEndpoint.String(endpoint)}
+
+			spanAttrs := attrs
+			if messageID != "" {
+				spanAttrs = append(spanAttrs, AttrMessageID.String(messageID))
+			}
+			ctx, span := i.tracer.Start(req.Context(), "sendria "+req.Method+" "+endpoint,
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(spanAttrs...))
+
+			req = req.Clone(ctx)
+			i.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				i.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+				i.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+				span.End()
+				return nil, err
+			}
+
+			attrs = append(attrs, AttrStatusCode.Int(resp.StatusCode))
+			span.SetAttributes(AttrStatusCode.Int(resp.StatusCode))
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, "unexpected status code: "+strconv.Itoa(resp.StatusCode))
+				i.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+			}
+
+			finish := func() {
+				i.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+				span.End()
+			}
+			// The body of an upgraded connection must stay an io.ReadWriteCloser
+			if resp.StatusCode == http.StatusSwitchingProtocols || resp.Body == nil {
+				finish()
+				return resp, nil
+			}
+			resp.Body = &tracedBody{ReadCloser: resp.Body, finish: finish}
+			return resp, nil
+		})
+	}
+}
+
+// tracedBody calls finish once the response body is read to the end or
+// closed
+type tracedBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+// Read reads from the body and finishes at its end
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.finish)
+	}
+	return n, err
+}
+
+// Close closes the body and finishes
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.finish)
+	return err
+}
+
+// MessageHook returns a message hook that records the size of messages and
+// links the span in the context of the call to the trace that sent the
+// message. Attachment sizes are recorded once the parts are parsed, so
+// listed messages are not parsed for the hook.
+func (i *Instrumentation) MessageHook() sendria.MessageHook {
+	return func(ctx context.Context, msg *models.Message) {
+		i.size.Record(ctx, int64(msg.Size))
+		attachmentCtx := context.WithoutCancel(ctx)
+		msg.OnPartsLoaded(func(parsed *models.ParsedSource) {
+			for _, att := range parsed.Attachments {
+				i.attachment.Record(attachmentCtx, int64(att.Size), metric.WithAttributes(attribute.String("content_type", att.Type)))
+			}
+		})
+
+		if sc, ok := MessageSpanContext(msg); ok {
+			trace.SpanFromContext(ctx).AddLink(trace.Link{
+				SpanContext: sc,
+				Attributes:  []attribute.KeyValue{AttrMessageID.String(msg.ID)},
+			})
+		}
+	}
+}
+
+// MessageSpanContext returns the span context of the trace that sent the
+// message, taken from its traceparent header
+func MessageSpanContext(msg *models.Message) (trace.SpanContext, bool) {
+	if msg == nil || msg.Source == "" {
+		return trace.SpanContext{}, false
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.Source))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(parsed.Header))
+	sc := trace.SpanContextFromContext(ctx)
+	return sc, sc.IsValid()
+}
+
+// Traceparent returns the W3C traceparent header value of the span in ctx, or
+// an empty string if there is none. Pass it to sendria.StampCorrelation to
+// link outgoing emails to the current trace.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// ContextWithMessage returns a context whose remote parent is the span that
+// sent the message, so that work on the message continues its trace
+func ContextWithMessage(ctx context.Context, msg *models.Message) context.Context {
+	if sc, ok := MessageSpanContext(msg); ok {
+		return trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// messagePath matches the API paths of a single message
+var messagePath = regexp.MustCompile(`^/api/messages/([^/.]+)(\.(?:json|plain|html|source|eml)|/parts/[^/]+)?$`)
+
+// staticEndpoints are the API paths without a message ID
+var staticEndpoints = map[string]bool{"/": true, "/api/messages/": true, "/ws": true}
+
+// otherEndpoint is the endpoint of paths the client does not call, which
+// keeps the cardinality of the endpoint attribute bounded
+const otherEndpoint = "other"
+
+// endpointOf returns the path template of an API path with the message ID
+// replaced, and the message ID if the path refers to one
+func endpointOf(path string) (endpoint, messageID string) {
+	m := messagePath.FindStringSubmatch(path)
+	if m == nil {
+		if staticEndpoints[path] {
+			return path, ""
+		}
+		return otherEndpoint, ""
+	}
+
+	suffix := m[2]
+	if strings.HasPrefix(suffix, "/parts/") {
+		suffix = "/parts/{cid}"
+	}
+	return "/api/messages/{id}" + suffix, m[1]
+}
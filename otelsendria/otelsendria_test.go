@@ -0,0 +1,282 @@
+package otelsendria
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/models"
+)
+
+const senderTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+const tracedSource = "From: app@example.com\r\nTo: user@example.com\r\nSubject: Welcome\r\n" +
+	"Traceparent: 00-" + senderTraceID + "-00f067aa0ba902b7-01\r\n" +
+	"Content-Type: text/plain\r\n\r\nHello\r\n"
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Traceparent") == "" {
+			t.Errorf("expected traceparent on request to %s", r.URL.Path)
+		}
+		if r.URL.Path != "/api/messages/42.json" {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := json.Marshal(models.APIMessage{ID: 42, Subject: "Welcome", Source: tracedSource, Size: len(tracedSource)})
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInstrumentation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	inst, err := New(
+		WithTracerProvider(tracerProvider),
+		WithMeterProvider(meterProvider),
+		WithPropagator(propagation.TraceContext{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server := newServer(t)
+	client := sendria.NewClient(server.URL, inst.ClientOptions()...)
+
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "test")
+	if _, err := client.GetMessageContext(ctx, "42"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.GetMessageSourceContext(ctx, "7"); err == nil {
+		t.Fatal("expected error for missing message")
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	get := spans[0]
+	if get.Name != "sendria GET /api/messages/{id}.json" {
+		t.Errorf("unexpected span name %q", get.Name)
+	}
+	if get.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the call span to be a child of the test span")
+	}
+	assertAttr(t, get.Attributes, AttrMessageID, "42")
+	assertAttr(t, get.Attributes, AttrStatusCode, "200")
+	assertAttr(t, get.Attributes, AttrEndpoint, "/api/messages/{id}.json")
+
+	failed := spans[1]
+	if failed.Status.Code != codes.Error {
+		t.Errorf("expected error status for 404, got %v", failed.Status)
+	}
+	assertAttr(t, failed.Attributes, AttrMessageID, "7")
+
+	test := spans[2]
+	if len(test.Links) != 1 || test.Links[0].SpanContext.TraceID().String() != senderTraceID {
+		t.Errorf("expected link to the sender trace, got %+v", test.Links)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collecting metrics: %v", err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	duration, ok := metrics["sendria.client.request.duration"].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 2 {
+		t.Errorf("expected duration for 2 endpoints, got %+v", metrics["sendria.client.request.duration"])
+	}
+	errors, ok := metrics["sendria.client.request.errors"].(metricdata.Sum[int64])
+	if !ok || len(errors.DataPoints) != 1 || errors.DataPoints[0].Value != 1 {
+		t.Errorf("expected one error, got %+v", metrics["sendria.client.request.errors"])
+	}
+	size, ok := metrics["sendria.client.message.size"].(metricdata.Histogram[int64])
+	if !ok || len(size.DataPoints) != 1 || size.DataPoints[0].Sum != int64(len(tracedSource)) {
+		t.Errorf("expected message size %d, got %+v", len(tracedSource), metrics["sendria.client.message.size"])
+	}
+}
+
+func TestContextWithMessage(t *testing.T) {
+	msg := &models.Message{ID: "42", Source: tracedSource}
+	sc, ok := MessageSpanContext(msg)
+	if !ok || sc.TraceID().String() != senderTraceID || !sc.IsRemote() {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider()
+	_, span := tracerProvider.Tracer("test").Start(ContextWithMessage(context.Background(), msg), "verify")
+	if span.SpanContext().TraceID().String() != senderTraceID {
+		t.Error("expected the span to continue the sender trace")
+	}
+
+	if _, ok := MessageSpanContext(&models.Message{Source: "Subject: untraced\r\n\r\nHi"}); ok {
+		t.Error("expected no span context without traceparent")
+	}
+}
+
+func TestMessageHookListedAttachments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	inst, err := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source := "Subject: Invoice\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHello\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\n%PDF\r\n--b--\r\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal([]models.APIMessage{{ID: 1, Source: source}})
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Code: "OK", Data: data}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := sendria.NewClient(server.URL, inst.ClientOptions()...)
+	list, err := client.ListMessages(1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	attachmentPoints := func() int {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatalf("collecting metrics: %v", err)
+		}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if hist, ok := m.Data.(metricdata.Histogram[int64]); ok && m.Name == "sendria.client.attachment.size" {
+					return len(hist.DataPoints)
+				}
+			}
+		}
+		return 0
+	}
+
+	msg := &list.Messages[0]
+	if msg.MIME != nil || msg.Attachments != nil {
+		t.Error("expected the hook to leave the listed message unparsed")
+	}
+	if n := attachmentPoints(); n != 0 {
+		t.Errorf("expected no attachment sizes before parsing, got %d", n)
+	}
+
+	if len(msg.GetAttachments()) != 1 {
+		t.Fatalf("expected 1 attachment, got %+v", msg.Attachments)
+	}
+	if n := attachmentPoints(); n != 1 {
+		t.Errorf("expected the attachment size once the message is parsed, got %d data points", n)
+	}
+}
+
+func TestSpanEndsWithBody(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	inst, err := New(WithTracerProvider(tracerProvider), WithPropagator(propagation.TraceContext{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, tracedSource)
+	}))
+	t.Cleanup(server.Close)
+	client := sendria.NewClient(server.URL, inst.ClientOptions()...)
+
+	body, err := client.OpenMessageSource(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("expected the span to stay open while the body is read, got %d spans", len(spans))
+	}
+	if err := body.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 {
+		t.Fatalf("expected the span to end with the body, got %d spans", len(spans))
+	}
+}
+
+func TestEndpointOf(t *testing.T) {
+	tests := []struct {
+		path, endpoint, id string
+	}{
+		{"/api/messages/", "/api/messages/", ""},
+		{"/api/messages/12", "/api/messages/{id}", "12"},
+		{"/api/messages/12.plain", "/api/messages/{id}.plain", "12"},
+		{"/api/messages/12/parts/logo@x", "/api/messages/{id}/parts/{cid}", "12"},
+		{"/ws", "/ws", ""},
+		{"/", "/", ""},
+		{"/api/messages/12.unknown", "other", ""},
+		{"/api/unknown/12", "other", ""},
+	}
+	for _, tt := range tests {
+		endpoint, id := endpointOf(tt.path)
+		if endpoint != tt.endpoint || id != tt.id {
+			t.Errorf("endpointOf(%q) = %q, %q; want %q, %q", tt.path, endpoint, id, tt.endpoint, tt.id)
+		}
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	if got := Traceparent(context.Background()); got != "" {
+		t.Errorf("expected no traceparent without a span, got %q", got)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider()
+	ctx, span := tracerProvider.Tracer("test").Start(context.Background(), "send")
+	defer span.End()
+
+	traceparent := Traceparent(ctx)
+	msg := &models.Message{Source: "Traceparent: " + traceparent + "\r\nSubject: Hi\r\n\r\nHi"}
+	sc, ok := MessageSpanContext(msg)
+	if !ok || sc.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("expected %q to round-trip the trace ID, got %+v", traceparent, sc)
+	}
+}
+
+func assertAttr(t *testing.T, attrs []attribute.KeyValue, key attribute.Key, want string) {
+	t.Helper()
+
+	for _, kv := range attrs {
+		if kv.Key == key {
+			if got := kv.Value.Emit(); got != want {
+				t.Errorf("expected %s=%s, got %s", key, want, got)
+			}
+			return
+		}
+	}
+	t.Errorf("missing attribute %s", key)
+}
@@ -0,0 +1,143 @@
+package sendria
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// paginate computes the pagination of a list page with count messages.
+// Servers report the message count, the number of pages, or nothing:
+//
+//   - meta.total is used as is.
+//   - With only meta.pages_total, the messages before the last page fill
+//     whole pages, so the total follows from the size of the last page. On
+//     other pages the total is unknown, unless exact is set: then the last
+//     page is fetched, and a page size that was neither requested nor
+//     reported is learned from the first page.
+//   - With meta but neither count, only a page that is not full ends the
+//     list. The total is known on a first page that is not full and on a
+//     last page of known size; elsewhere exact scans the following pages.
+//   - Without meta, the server does not page and returned every message.
+func (c *Client) paginate(ctx context.Context, page, perPage, count int, meta *models.APIMeta, exact bool) (*models.MessageList, error) {
+	list := &models.MessageList{Page: page, PerPage: perPage, TotalKnown: true}
+	if list.Page <= 0 {
+		list.Page = 1
+	}
+
+	if meta == nil {
+		list.Page, list.PerPage, list.Total = 1, 0, count
+		if count > 0 {
+			list.PagesTotal = 1
+		}
+		return list, nil
+	}
+
+	if meta.Page > 0 {
+		list.Page = meta.Page
+	}
+	if meta.PerPage > 0 {
+		list.PerPage = meta.PerPage
+	}
+	list.PagesTotal = meta.PagesTotal
+
+	// Pages before the last one are full
+	if list.PerPage <= 0 && count > 0 && (list.Page < meta.PagesTotal || count < meta.Total) {
+		list.PerPage = count
+	}
+
+	switch {
+	case meta.Total > 0:
+		list.Total = meta.Total
+		if list.PagesTotal == 0 {
+			list.PagesTotal = 1
+			if list.PerPage > 0 {
+				list.PagesTotal = (meta.Total + list.PerPage - 1) / list.PerPage
+			}
+		}
+
+	case meta.PagesTotal == 0:
+		return c.paginateUncounted(ctx, list, perPage, count, exact)
+
+	case list.Page == meta.PagesTotal && (list.PerPage > 0 || meta.PagesTotal == 1):
+		list.Total = (meta.PagesTotal-1)*list.PerPage + count
+
+	case !exact:
+		list.TotalKnown = false
+
+	default:
+		if list.PerPage <= 0 {
+			first, _, err := c.fetchList(ctx, 1, perPage)
+			if err != nil {
+				return nil, fmt.Errorf("fetching first page for the page size: %w", err)
+			}
+			list.PerPage = len(first)
+		}
+
+		lastCount := count
+		if list.Page != meta.PagesTotal {
+			last, _, err := c.fetchList(ctx, meta.PagesTotal, list.PerPage)
+			if err != nil {
+				return nil, fmt.Errorf("fetching last page for the total: %w", err)
+			}
+			lastCount = len(last)
+		}
+		list.Total = (meta.PagesTotal-1)*list.PerPage + lastCount
+	}
+
+	return list, nil
+}
+
+// paginateUncounted completes the pagination of a page whose meta reports
+// neither the total nor the number of pages
+func (c *Client) paginateUncounted(ctx context.Context, list *models.MessageList, perPage, count int, exact bool) (*models.MessageList, error) {
+	if exact && list.PerPage <= 0 && list.Page > 1 {
+		first, _, err := c.fetchList(ctx, 1, perPage)
+		if err != nil {
+			return nil, fmt.Errorf("fetching first page for the page size: %w", err)
+		}
+		list.PerPage = len(first)
+	}
+
+	// A full page may be followed by more
+	full := list.PerPage > 0 && count >= list.PerPage
+	list.PagesTotal = list.Page
+	if full {
+		list.PagesTotal++
+	}
+
+	switch {
+	case list.Page == 1 && !full:
+		list.Total = count
+		if count == 0 {
+			list.PagesTotal = 0
+		}
+
+	case count > 0 && !full && list.PerPage > 0:
+		list.Total = (list.Page-1)*list.PerPage + count
+
+	case !exact || list.PerPage <= 0 || count == 0:
+		// Past the end, or a later page whose size is not known
+		list.TotalKnown = false
+
+	default:
+		total := (list.Page-1)*list.PerPage + count
+		for page := list.Page + 1; ; page++ {
+			next, _, err := c.fetchList(ctx, page, list.PerPage)
+			if err != nil {
+				return nil, fmt.Errorf("scanning page %d for the total: %w", page, err)
+			}
+			total += len(next)
+			if len(next) > 0 {
+				list.PagesTotal = page
+			}
+			if len(next) < list.PerPage {
+				break
+			}
+		}
+		list.Total = total
+	}
+
+	return list, nil
+}
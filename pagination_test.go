@@ -0,0 +1,298 @@
+package sendria
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// pagedResponse encodes page of total messages with the meta fields named in
+// shape, as the Sendria versions report them
+func pagedResponse(t *testing.T, w http.ResponseWriter, r *http.Request, total, defaultPerPage int, shape []string) {
+	t.Helper()
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+
+	data := []models.APIMessage{}
+	for id := (page-1)*perPage + 1; id <= page*perPage && id <= total; id++ {
+		data = append(data, models.APIMessage{ID: id})
+	}
+
+	resp := map[string]any{"code": "OK", "data": data}
+	meta := map[string]int{}
+	for _, field := range shape {
+		switch field {
+		case "pages_total":
+			meta[field] = (total + perPage - 1) / perPage
+		case "total":
+			meta[field] = total
+		case "page":
+			meta[field] = page
+		case "per_page":
+			meta[field] = perPage
+		}
+	}
+	if len(shape) > 0 {
+		resp["meta"] = meta
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		t.Errorf("failed to encode response: %v", err)
+	}
+}
+
+func TestListMessagesPagination(t *testing.T) {
+	t.Parallel()
+
+	type expected struct {
+		total, page, perPage, pagesTotal int
+		hasNext, hasPrev                 bool
+		unknown                          bool
+		requests                         int32
+	}
+	tests := []struct {
+		name           string
+		shape          []string
+		total          int
+		defaultPerPage int
+		page, perPage  int
+		exact          bool
+		expected       expected
+	}{
+		{
+			name:     "pages_total first page leaves the total unknown",
+			shape:    []string{"pages_total"},
+			total:    23,
+			page:     1,
+			perPage:  10,
+			expected: expected{page: 1, perPage: 10, pagesTotal: 3, hasNext: true, unknown: true, requests: 1},
+		},
+		{
+			name:     "pages_total first page with exact total fetches last page",
+			shape:    []string{"pages_total"},
+			total:    23,
+			page:     1,
+			perPage:  10,
+			exact:    true,
+			expected: expected{total: 23, page: 1, perPage: 10, pagesTotal: 3, hasNext: true, requests: 2},
+		},
+		{
+			name:     "pages_total last page",
+			shape:    []string{"pages_total"},
+			total:    23,
+			page:     3,
+			perPage:  10,
+			expected: expected{total: 23, page: 3, perPage: 10, pagesTotal: 3, hasPrev: true, requests: 1},
+		},
+		{
+			name:     "pages_total single page",
+			shape:    []string{"pages_total"},
+			total:    4,
+			page:     1,
+			perPage:  10,
+			expected: expected{total: 4, page: 1, perPage: 10, pagesTotal: 1, requests: 1},
+		},
+		{
+			name:           "pages_total server default page size",
+			shape:          []string{"pages_total"},
+			total:          7,
+			defaultPerPage: 3,
+			exact:          true,
+			expected:       expected{total: 7, page: 1, perPage: 3, pagesTotal: 3, hasNext: true, requests: 2},
+		},
+		{
+			name:           "pages_total server default page size on last page",
+			shape:          []string{"pages_total"},
+			total:          7,
+			defaultPerPage: 3,
+			page:           3,
+			exact:          true,
+			expected:       expected{total: 7, page: 3, perPage: 3, pagesTotal: 3, hasPrev: true, requests: 2},
+		},
+		{
+			name:           "pages_total unknown page size on last page",
+			shape:          []string{"pages_total"},
+			total:          7,
+			defaultPerPage: 3,
+			page:           3,
+			expected:       expected{page: 3, pagesTotal: 3, hasPrev: true, unknown: true, requests: 1},
+		},
+		{
+			name:     "pages_total beyond last page",
+			shape:    []string{"pages_total"},
+			total:    23,
+			page:     5,
+			perPage:  10,
+			exact:    true,
+			expected: expected{total: 23, page: 5, perPage: 10, pagesTotal: 3, hasPrev: true, requests: 2},
+		},
+		{
+			name:     "total",
+			shape:    []string{"total"},
+			total:    23,
+			page:     2,
+			perPage:  10,
+			expected: expected{total: 23, page: 2, perPage: 10, pagesTotal: 3, hasNext: true, hasPrev: true, requests: 1},
+		},
+		{
+			name:           "all fields with server defaults",
+			shape:          []string{"pages_total", "total", "page", "per_page"},
+			total:          23,
+			defaultPerPage: 20,
+			exact:          true,
+			expected:       expected{total: 23, page: 1, perPage: 20, pagesTotal: 2, hasNext: true, requests: 1},
+		},
+		{
+			name:           "no meta",
+			total:          23,
+			defaultPerPage: 100,
+			page:           1,
+			perPage:        10,
+			expected:       expected{total: 10, page: 1, perPage: 0, pagesTotal: 1, requests: 1},
+		},
+		{
+			name:           "page only on a later page of unknown size",
+			shape:          []string{"page"},
+			total:          25,
+			defaultPerPage: 10,
+			page:           3,
+			expected:       expected{page: 3, pagesTotal: 3, hasPrev: true, unknown: true, requests: 1},
+		},
+		{
+			name:           "page only on a later page with exact total learns the page size",
+			shape:          []string{"page"},
+			total:          25,
+			defaultPerPage: 10,
+			page:           3,
+			exact:          true,
+			expected:       expected{total: 25, page: 3, perPage: 10, pagesTotal: 3, hasPrev: true, requests: 2},
+		},
+		{
+			name:     "page only on the last page",
+			shape:    []string{"page"},
+			total:    25,
+			page:     3,
+			perPage:  10,
+			expected: expected{total: 25, page: 3, perPage: 10, pagesTotal: 3, hasPrev: true, requests: 1},
+		},
+		{
+			name:     "page only on a full first page",
+			shape:    []string{"page"},
+			total:    25,
+			page:     1,
+			perPage:  10,
+			expected: expected{page: 1, perPage: 10, pagesTotal: 2, hasNext: true, unknown: true, requests: 1},
+		},
+		{
+			name:     "page only on a full first page with exact total scans the pages",
+			shape:    []string{"page"},
+			total:    25,
+			page:     1,
+			perPage:  10,
+			exact:    true,
+			expected: expected{total: 25, page: 1, perPage: 10, pagesTotal: 3, hasNext: true, requests: 3},
+		},
+		{
+			name:     "page only on a short first page",
+			shape:    []string{"page"},
+			total:    4,
+			page:     1,
+			perPage:  10,
+			expected: expected{total: 4, page: 1, perPage: 10, pagesTotal: 1, requests: 1},
+		},
+		{
+			name:     "empty inbox",
+			shape:    []string{"pages_total"},
+			page:     1,
+			perPage:  10,
+			expected: expected{page: 1, perPage: 10, requests: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				pagedResponse(t, w, r, tt.total, tt.defaultPerPage, tt.shape)
+			}))
+			defer server.Close()
+
+			var opts []ListOption
+			if tt.exact {
+				opts = append(opts, WithExactTotal())
+			}
+			list, err := NewClient(server.URL).ListMessages(tt.page, tt.perPage, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := expected{
+				total:      list.Total,
+				page:       list.Page,
+				perPage:    list.PerPage,
+				pagesTotal: list.PagesTotal,
+				hasNext:    list.HasNext(),
+				hasPrev:    list.HasPrev(),
+				unknown:    !list.TotalKnown,
+				requests:   requests.Load(),
+			}
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMessageListNextPage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pagedResponse(t, w, r, 7, 0, []string{"pages_total"})
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	list, err := NewClient(server.URL).ListMessagesContext(ctx, 1, 3, WithoutSources(), WithExactTotal())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ids []string
+	for {
+		for _, msg := range list.Messages {
+			ids = append(ids, msg.ID)
+		}
+		next, err := list.NextPage(ctx)
+		if errors.Is(err, models.ErrNoNextPage) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if next.Page != list.Page+1 || next.PerPage != 3 || next.Total != 7 {
+			t.Errorf("unexpected page %d/%d of %d", next.Page, next.PerPage, next.Total)
+		}
+		list = next
+	}
+
+	if len(ids) != 7 || ids[0] != "1" || ids[6] != "7" {
+		t.Errorf("expected messages 1 to 7, got %v", ids)
+	}
+}
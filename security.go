@@ -0,0 +1,166 @@
+package sendria
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// unwrapSecurity detects S/MIME and PGP/MIME signed or encrypted entities at
+// the root of a message, verifies and decrypts them with the keys of the
+// parser, and replaces the flat parts and attachments with those of the
+// cleartext. The MIME tree keeps the entities as transmitted.
+func (p *mimeParser) unwrapSecurity(parsed *models.ParsedSource, body []byte, path string, depth int) {
+	root := parsed.MIME
+	protocol := strings.ToLower(root.Params["protocol"])
+
+	var sec *models.Security
+	var content []byte
+	switch {
+	case root.ContentType == "multipart/signed" && len(root.Children) == 2:
+		sec = &models.Security{Signed: true}
+		content = canonicalLineEndings(firstRawPart(body, root.Params["boundary"]))
+		signature := root.Children[1].Body()
+
+		var results []models.SignatureResult
+		var err error
+		switch protocol {
+		case "application/pkcs7-signature", "application/x-pkcs7-signature":
+			sec.Protocol = models.ProtocolSMIME
+			results, _, err = p.keys.VerifySMIME(signature, content)
+		case "application/pgp-signature":
+			sec.Protocol = models.ProtocolPGP
+			results, err = p.keys.VerifyPGP(signature, content)
+		default:
+			return
+		}
+		if err != nil {
+			results = []models.SignatureResult{{Protocol: sec.Protocol, Err: err}}
+		}
+		sec.Signatures = results
+
+	case root.ContentType == "multipart/encrypted" && protocol == "application/pgp-encrypted" && len(root.Children) == 2:
+		sec = &models.Security{Protocol: models.ProtocolPGP, Encrypted: true}
+		var results []models.SignatureResult
+		var err error
+		if content, results, err = p.keys.DecryptPGP(root.Children[1].Body()); err != nil {
+			sec.DecryptError = err
+			break
+		}
+		sec.Decrypted, sec.Signed, sec.Signatures = true, len(results) > 0, results
+
+	case root.ContentType == "application/pkcs7-mime" || root.ContentType == "application/x-pkcs7-mime":
+		data := root.Body()
+		smimeType := strings.ToLower(root.Params["smime-type"])
+		if smimeType != "enveloped-data" && smimeType != "signed-data" {
+			smimeType = models.SMIMEContentType(data)
+		}
+		switch smimeType {
+		case "enveloped-data":
+			sec = &models.Security{Protocol: models.ProtocolSMIME, Encrypted: true}
+			var err error
+			if content, err = p.keys.DecryptSMIME(data); err != nil {
+				sec.DecryptError = err
+				break
+			}
+			sec.Decrypted = true
+		case "signed-data":
+			sec = &models.Security{Protocol: models.ProtocolSMIME, Signed: true}
+			results, signed, err := p.keys.VerifySMIME(data, nil)
+			if err != nil {
+				results = []models.SignatureResult{{Protocol: sec.Protocol, Err: err}}
+			}
+			sec.Signatures, content = results, signed
+		default:
+			return
+		}
+
+	default:
+		return
+	}
+	parsed.Security = sec
+	if content == nil {
+		return
+	}
+
+	if depth >= maxEmbeddedDepth {
+		p.warn(models.WarningUnparsedEntity, path, "cleartext nested too deeply, keeping it unparsed", slog.Int("depth", depth))
+		return
+	}
+	inner, err := p.parseAt(string(content), path, depth+1)
+	if err != nil {
+		p.warn(models.WarningUnparsedEntity, path, "malformed cleartext, keeping it unparsed", slog.String("error", err.Error()))
+		return
+	}
+	parsed.Parts, parsed.Attachments = inner.Parts, inner.Attachments
+	sec.Cleartext = cleartextMessage(root, content, inner)
+
+	// Merge the layers inside, e.g. a signature inside an encrypted message
+	if in := inner.Security; in != nil {
+		decrypted := (!sec.Encrypted || sec.Decrypted) && (!in.Encrypted || in.Decrypted)
+		sec.Signed = sec.Signed || in.Signed
+		sec.Encrypted = sec.Encrypted || in.Encrypted
+		sec.Decrypted = sec.Encrypted && decrypted
+		sec.Signatures = append(sec.Signatures, in.Signatures...)
+		if in.DecryptError != nil {
+			sec.DecryptError = in.DecryptError
+		}
+		if in.Cleartext != nil {
+			sec.Cleartext = in.Cleartext
+		}
+	}
+}
+
+// cleartextMessage builds the message of signed or decrypted content. Its
+// envelope fields are read from the headers of the content, if it protects
+// them, or else from the outer message.
+func cleartextMessage(outer *models.MIMENode, content []byte, inner *models.ParsedSource) *models.Message {
+	msg := embeddedMessage(content, inner)
+	envelope := embeddedMessage(nil, &models.ParsedSource{MIME: outer})
+	if msg.Subject == "" {
+		msg.Subject = envelope.Subject
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = envelope.CreatedAt
+	}
+	if len(msg.From) == 0 {
+		msg.From = envelope.From
+	}
+	if len(msg.To) == 0 {
+		msg.To = envelope.To
+	}
+	return msg
+}
+
+// firstRawPart returns the first part of a multipart body as transmitted,
+// including its header, which is the content multipart/signed signatures
+// cover
+func firstRawPart(body []byte, boundary string) []byte {
+	delimiter := []byte("--" + boundary)
+	start := -1
+	for pos := 0; pos < len(body); {
+		lineEnd := len(body)
+		if i := bytes.IndexByte(body[pos:], '\n'); i >= 0 {
+			lineEnd = pos + i + 1
+		}
+		line := bytes.TrimRight(body[pos:lineEnd], " \t\r\n")
+
+		if suffix, ok := bytes.CutPrefix(line, delimiter); ok && (len(suffix) == 0 || string(suffix) == "--") {
+			if start >= 0 {
+				return body[start:trimLineBreak(body, start, pos)]
+			}
+			start = lineEnd
+		}
+		pos = lineEnd
+	}
+	return nil
+}
+
+// canonicalLineEndings converts line endings to CRLF, the canonical form
+// signatures are computed over
+func canonicalLineEndings(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+}
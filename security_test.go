@@ -0,0 +1,442 @@
+package sendria
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria/models"
+)
+
+// readSecurityFixture reads a file generated by testdata/security/generate.sh
+func readSecurityFixture(t testing.TB, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "security", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return data
+}
+
+// testSecurityKeys returns the trust root and keys of the fixtures. The
+// keyring lacks the public key of carol unless withCarol is set.
+func testSecurityKeys(t *testing.T, withCarol bool) *models.SecurityKeys {
+	t.Helper()
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(readSecurityFixture(t, "ca.pem")) {
+		t.Fatal("failed to load the test CA")
+	}
+	key, err := models.LoadSMIMEKey(readSecurityFixture(t, "alice.pem"), readSecurityFixture(t, "alice.key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keyring, err := models.ReadPGPKeyring(readSecurityFixture(t, "pgp-alice-secret.asc"), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := keyring.Add(readSecurityFixture(t, "pgp-bob-secret.asc"), "secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if withCarol {
+		if err := keyring.Add(readSecurityFixture(t, "pgp-public.asc"), ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return &models.SecurityKeys{SMIMERoots: roots, SMIMEKeys: []models.SMIMEKey{key}, PGPKeyring: keyring}
+}
+
+// pgpFixturePackets dearmors a PGP fixture and splits it into its packets,
+// headers included
+func pgpFixturePackets(t *testing.T, name string) [][]byte {
+	t.Helper()
+
+	var encoded strings.Builder
+	inBody := false
+	for _, line := range strings.Split(string(readSecurityFixture(t, name)), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case !inBody:
+			inBody = line == ""
+		case strings.HasPrefix(line, "=") || strings.HasPrefix(line, "-----"):
+			inBody = false
+		default:
+			encoded.WriteString(line)
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+
+	var packets [][]byte
+	for len(b) > 0 {
+		header, length := 0, 0
+		switch {
+		case b[0]&0x40 != 0 && b[1] < 192:
+			header, length = 2, int(b[1])
+		case b[0]&0x40 != 0 && b[1] < 224:
+			header, length = 3, (int(b[1])-192)<<8+int(b[2])+192
+		case b[0]&0x40 != 0:
+			header, length = 6, int(b[2])<<24|int(b[3])<<16|int(b[4])<<8|int(b[5])
+		case b[0]&3 == 0:
+			header, length = 2, int(b[1])
+		case b[0]&3 == 1:
+			header, length = 3, int(b[1])<<8|int(b[2])
+		default:
+			header, length = 5, int(b[1])<<24|int(b[2])<<16|int(b[3])<<8|int(b[4])
+		}
+		packets, b = append(packets, b[:header+length]), b[header+length:]
+	}
+	return packets
+}
+
+// pgpPacketTag returns the tag of a packet in new or old format
+func pgpPacketTag(packet []byte) byte {
+	if packet[0]&0x40 != 0 {
+		return packet[0] & 0x3f
+	}
+	return packet[0] >> 2 & 0x0f
+}
+
+func TestPGPKeyringBindings(t *testing.T) {
+	t.Parallel()
+
+	// The public keys of alice, a certified user ID and an encryption subkey,
+	// followed by those of carol
+	packets := pgpFixturePackets(t, "pgp-public.asc")
+	var alice [][]byte
+	for i, p := range packets {
+		if i > 0 && pgpPacketTag(p) == 6 {
+			break
+		}
+		alice = append(alice, p)
+	}
+	const (
+		primary, userID, certification, subkey = 0, 1, 2, 3
+	)
+	if len(alice) < 5 || pgpPacketTag(alice[userID]) != 13 || pgpPacketTag(alice[subkey]) != 14 {
+		t.Fatalf("unexpected fixture layout of %d packets", len(alice))
+	}
+	replace := func(i int, packet []byte) [][]byte {
+		modified := append([][]byte{}, alice...)
+		modified[i] = packet
+		return modified
+	}
+
+	mallory := "Mallory <mallory@example.com>"
+	forgedUserID := append([]byte{0xc0 | 13, byte(len(mallory))}, mallory...)
+	tamperedSubkey := bytes.Clone(alice[subkey])
+	tamperedSubkey[len(tamperedSubkey)-10] ^= 0xff
+
+	tests := []struct {
+		name       string
+		packets    [][]byte
+		wantKeys   int
+		wantSigner string
+	}{
+		{
+			name:       "self-signed key",
+			packets:    alice,
+			wantKeys:   2,
+			wantSigner: "Alice <alice@example.com>",
+		},
+		{
+			name:    "user ID changed after certification",
+			packets: replace(userID, bytes.Replace(alice[userID], []byte("example.com"), []byte("example.org"), 1)),
+		},
+		{
+			name: "forged user ID with a copied certification",
+			packets: append([][]byte{alice[primary], forgedUserID, alice[certification]},
+				alice[userID:]...),
+			wantKeys:   2,
+			wantSigner: "Alice <alice@example.com>",
+		},
+		{
+			name:       "subkey changed after binding",
+			packets:    replace(subkey, tamperedSubkey),
+			wantKeys:   1,
+			wantSigner: "Alice <alice@example.com>",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keyring, err := models.ReadPGPKeyring(bytes.Join(tt.packets, nil), "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if keyring.Len() != tt.wantKeys {
+				t.Errorf("expected %d keys, got %d", tt.wantKeys, keyring.Len())
+			}
+
+			keys := &models.SecurityKeys{PGPKeyring: keyring}
+			parsed, err := (&mimeParser{logger: discardLogger, keys: keys}).parse(string(readSecurityFixture(t, "pgp-signed.eml")))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sig := parsed.Security.Signatures[0]
+			if sig.Signer != tt.wantSigner || sig.Trusted != (tt.wantSigner != "") {
+				t.Errorf("expected signer %q, got %q trusted %v: %v", tt.wantSigner, sig.Signer, sig.Trusted, sig.Err)
+			}
+		})
+	}
+}
+
+func TestUnwrapSecurity(t *testing.T) {
+	t.Parallel()
+
+	keys := testSecurityKeys(t, true)
+	expired := *keys
+	expired.VerifyTime = time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)
+	tamper := func(source string) string {
+		return strings.Replace(source, "STMT-42", "STMT-43", 1)
+	}
+
+	tests := []struct {
+		name          string
+		fixture       string
+		modify        func(string) string
+		keys          *models.SecurityKeys
+		wantProtocol  string
+		wantEncrypted bool
+		wantDecrypted bool
+		wantSigners   []string
+		wantVerified  bool
+		wantErr       string
+	}{
+		{
+			name:         "detached S/MIME signature",
+			fixture:      "smime-signed.eml",
+			keys:         keys,
+			wantProtocol: models.ProtocolSMIME,
+			wantSigners:  []string{"alice@example.com"},
+			wantVerified: true,
+		},
+		{
+			name:         "opaque S/MIME signature",
+			fixture:      "smime-opaque.eml",
+			keys:         keys,
+			wantProtocol: models.ProtocolSMIME,
+			wantSigners:  []string{"alice@example.com"},
+			wantVerified: true,
+		},
+		{
+			name:          "S/MIME encryption",
+			fixture:       "smime-encrypted.eml",
+			keys:          keys,
+			wantProtocol:  models.ProtocolSMIME,
+			wantEncrypted: true,
+			wantDecrypted: true,
+		},
+		{
+			name:         "PGP RSA signature",
+			fixture:      "pgp-signed.eml",
+			keys:         keys,
+			wantProtocol: models.ProtocolPGP,
+			wantSigners:  []string{"Alice <alice@example.com>"},
+			wantVerified: true,
+		},
+		{
+			name:         "PGP Ed25519 signature",
+			fixture:      "pgp-signed-ed25519.eml",
+			keys:         keys,
+			wantProtocol: models.ProtocolPGP,
+			wantSigners:  []string{"Carol <carol@example.com>"},
+			wantVerified: true,
+		},
+		{
+			name:          "PGP encryption",
+			fixture:       "pgp-encrypted.eml",
+			keys:          keys,
+			wantProtocol:  models.ProtocolPGP,
+			wantEncrypted: true,
+			wantDecrypted: true,
+		},
+		{
+			name:          "PGP signature inside encryption with a protected key",
+			fixture:       "pgp-signed-encrypted.eml",
+			keys:          keys,
+			wantProtocol:  models.ProtocolPGP,
+			wantEncrypted: true,
+			wantDecrypted: true,
+			wantSigners:   []string{"Carol <carol@example.com>"},
+			wantVerified:  true,
+		},
+		{
+			name:         "tampered S/MIME content",
+			fixture:      "smime-signed.eml",
+			modify:       tamper,
+			keys:         keys,
+			wantProtocol: models.ProtocolSMIME,
+			wantSigners:  []string{"alice@example.com"},
+			wantErr:      "message digest does not match",
+		},
+		{
+			name:         "tampered PGP content",
+			fixture:      "pgp-signed.eml",
+			modify:       tamper,
+			keys:         keys,
+			wantProtocol: models.ProtocolPGP,
+			wantSigners:  []string{"Alice <alice@example.com>"},
+			wantErr:      "signature does not match",
+		},
+		{
+			name:         "S/MIME signer without trust roots",
+			fixture:      "smime-signed.eml",
+			wantProtocol: models.ProtocolSMIME,
+			wantSigners:  []string{"alice@example.com"},
+			wantErr:      "no trust roots",
+		},
+		{
+			name:         "S/MIME certificate expired at the verification time",
+			fixture:      "smime-signed.eml",
+			keys:         &expired,
+			wantProtocol: models.ProtocolSMIME,
+			wantSigners:  []string{"alice@example.com"},
+			wantErr:      "signer certificate is not trusted",
+		},
+		{
+			name:         "PGP signer missing from the keyring",
+			fixture:      "pgp-signed-ed25519.eml",
+			keys:         testSecurityKeys(t, false),
+			wantProtocol: models.ProtocolPGP,
+			wantSigners:  []string{""},
+			wantErr:      "unknown signing key",
+		},
+		{
+			name:          "S/MIME encryption without keys",
+			fixture:       "smime-encrypted.eml",
+			wantProtocol:  models.ProtocolSMIME,
+			wantEncrypted: true,
+			wantErr:       models.ErrNoDecryptionKey.Error(),
+		},
+		{
+			name:          "PGP encryption without keys",
+			fixture:       "pgp-encrypted.eml",
+			wantProtocol:  models.ProtocolPGP,
+			wantEncrypted: true,
+			wantErr:       models.ErrNoDecryptionKey.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			source := string(readSecurityFixture(t, tt.fixture))
+			if tt.modify != nil {
+				source = tt.modify(source)
+			}
+			parsed, err := (&mimeParser{logger: discardLogger, keys: tt.keys}).parse(source)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sec := parsed.Security
+			if sec == nil {
+				t.Fatal("expected the message to be detected as signed or encrypted")
+			}
+			if sec.Protocol != tt.wantProtocol || sec.Encrypted != tt.wantEncrypted || sec.Decrypted != tt.wantDecrypted ||
+				sec.Signed != (len(tt.wantSigners) > 0) || sec.Verified() != tt.wantVerified {
+				t.Errorf("unexpected security %+v", sec)
+			}
+
+			signers := make([]string, 0, len(sec.Signatures))
+			var errs []string
+			for _, sig := range sec.Signatures {
+				signers = append(signers, sig.Signer)
+				if sig.Err != nil {
+					errs = append(errs, sig.Err.Error())
+				}
+			}
+			if len(tt.wantSigners) > 0 && !reflect.DeepEqual(signers, tt.wantSigners) {
+				t.Errorf("expected signers %q, got %q", tt.wantSigners, signers)
+			}
+			if sec.DecryptError != nil {
+				errs = append(errs, sec.DecryptError.Error())
+			}
+			if got := strings.Join(errs, "; "); tt.wantErr == "" && got != "" || !strings.Contains(got, tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, got)
+			}
+
+			if tt.wantEncrypted && !tt.wantDecrypted {
+				if sec.Cleartext != nil || !errors.Is(sec.DecryptError, models.ErrNoDecryptionKey) {
+					t.Errorf("expected no cleartext, got %+v", sec.Cleartext)
+				}
+				return
+			}
+			if len(parsed.Parts) != 1 || !strings.Contains(parsed.Parts[0].Body, "Reference: STMT-4") || len(parsed.Attachments) != 0 {
+				t.Errorf("expected the cleartext as the only part, got %+v and %+v", parsed.Parts, parsed.Attachments)
+			}
+			cleartext := sec.Cleartext
+			if cleartext == nil || !strings.Contains(cleartext.Subject, "statement") || len(cleartext.From) != 1 || cleartext.PlainText() == "" {
+				t.Errorf("unexpected cleartext message %+v", cleartext)
+			}
+		})
+	}
+}
+
+func TestGetMessageSecurity(t *testing.T) {
+	t.Parallel()
+
+	source := string(readSecurityFixture(t, "smime-encrypted.eml"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []byte
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			data, _ = json.Marshal(models.APIMessage{ID: 3, Subject: "Encrypted statement", Source: source})
+		} else {
+			data, _ = json.Marshal([]models.APIMessage{{ID: 3, Subject: "Encrypted statement", Source: source}})
+		}
+		resp := models.APIResponse{Code: "OK", Data: json.RawMessage(data)}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithSecurityKeys(testSecurityKeys(t, false)))
+	msg, err := client.GetMessage("3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const body = "Your statement is ready.\r\nReference: STMT-42\r\n"
+	if msg.Security == nil || !msg.Security.Decrypted || len(msg.Parts) != 1 || msg.Parts[0].Body != body {
+		t.Errorf("expected the decrypted body, got %+v and %+v", msg.Security, msg.Parts)
+	}
+	if cleartext := msg.Cleartext(); cleartext == msg || cleartext.Subject != "Encrypted statement" || cleartext.PlainText() != body {
+		t.Errorf("unexpected cleartext %+v", cleartext)
+	}
+
+	list, err := client.ListMessages(1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listed := list.Messages[0]; listed.Cleartext().PlainText() != body || listed.Security == nil {
+		t.Errorf("expected lazily parsed messages to be decrypted, got %+v", listed.Security)
+	}
+
+	plain, err := NewClient(server.URL).GetMessage("3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plain.Security == nil || plain.Security.Decrypted || plain.Cleartext() != plain {
+		t.Errorf("expected an encrypted message without cleartext, got %+v", plain.Security)
+	}
+}
@@ -0,0 +1,187 @@
+package sendria
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// OpenMessageSource streams the raw source of a message. The caller must
+// close the returned reader.
+func (c *Client) OpenMessageSource(ctx context.Context, id string) (io.ReadCloser, error) {
+	return c.open(ctx, fmt.Sprintf("/api/messages/%s.source", id))
+}
+
+// OpenMessageEML streams the message as an EML file. The caller must close
+// the returned reader.
+func (c *Client) OpenMessageEML(ctx context.Context, id string) (io.ReadCloser, error) {
+	return c.open(ctx, fmt.Sprintf("/api/messages/%s.eml", id))
+}
+
+// OpenAttachment streams a message attachment by CID. The caller must close
+// the returned reader.
+func (c *Client) OpenAttachment(ctx context.Context, messageID, cid string) (io.ReadCloser, error) {
+	return c.open(ctx, fmt.Sprintf("/api/messages/%s/parts/%s", messageID, cid))
+}
+
+// WriteMessageTo copies the message as an EML file to w without buffering it
+// and returns the number of bytes written
+func (c *Client) WriteMessageTo(ctx context.Context, id string, w io.Writer) (int64, error) {
+	body, err := c.OpenMessageEML(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return n, fmt.Errorf("copying message %s: %w", id, err)
+	}
+	return n, nil
+}
+
+// WriteAttachmentTo copies a message attachment to w without buffering it and
+// returns the number of bytes written
+func (c *Client) WriteAttachmentTo(ctx context.Context, messageID, cid string, w io.Writer) (int64, error) {
+	body, err := c.OpenAttachment(ctx, messageID, cid)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return n, fmt.Errorf("copying attachment %s of message %s: %w", cid, messageID, err)
+	}
+	return n, nil
+}
+
+// WalkMessage streams the source of a message through WalkMIME
+func (c *Client) WalkMessage(ctx context.Context, id string, fn func(part *WalkPart) error) error {
+	body, err := c.OpenMessageSource(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	return WalkMIME(body, fn)
+}
+
+// open performs a GET request and returns the response body on success
+func (c *Client) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// Read and discard the response body to ensure the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// WalkPart is a leaf part of a MIME message visited by WalkMIME
+type WalkPart struct {
+	// Header is the header of the part, or of the message for single part
+	// messages
+	Header textproto.MIMEHeader
+	// MediaType is the lower-case media type, e.g. "application/pdf"
+	MediaType string
+	// Params are the media type parameters, e.g. "charset"
+	Params map[string]string
+	// Filename is the attachment filename, if any
+	Filename string
+	// Depth is the multipart nesting level, 0 for single part messages
+	Depth int
+	// Body streams the content with its transfer encoding decoded. It is only
+	// valid during the callback.
+	Body io.Reader
+}
+
+// WalkMIME reads a raw message from r and calls fn for every leaf part in
+// order, streaming the content instead of buffering the message. Multipart
+// containers are descended into and not visited themselves.
+func WalkMIME(r io.Reader, fn func(part *WalkPart) error) error {
+	tr := textproto.NewReader(bufio.NewReader(r))
+	header, err := tr.ReadMIMEHeader()
+	if err != nil && header == nil {
+		return fmt.Errorf("reading message header: %w", err)
+	}
+
+	return walkEntity(header, tr.R, 0, fn)
+}
+
+// walkEntity visits the entity with the given header and body
+func walkEntity(header textproto.MIMEHeader, body io.Reader, depth int, fn func(part *WalkPart) error) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading part: %w", err)
+			}
+			if err := walkEntity(p.Header, p, depth+1, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	filename := ""
+	if _, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		filename = dispParams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	return fn(&WalkPart{
+		Header:    header,
+		MediaType: mediaType,
+		Params:    params,
+		Filename:  filename,
+		Depth:     depth,
+		Body:      decodeReader(body, header.Get("Content-Transfer-Encoding")),
+	})
+}
+
+// decodeReader decodes a stream based on its transfer encoding
+func decodeReader(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
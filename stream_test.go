@@ -0,0 +1,213 @@
+package sendria
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const walkSource = "From: a@example.com\r\nSubject: Report\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+	"--outer\r\nContent-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+	"--inner\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+	"Caf=C3=A9 report\r\n" +
+	"--inner\r\nContent-Type: text/html\r\n\r\n<p>Report</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\nContent-Type: application/pdf; name=report.pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+	"JVBERi0x\r\nLjQK\r\n" +
+	"--outer--\r\n"
+
+func TestWalkMIME(t *testing.T) {
+	t.Parallel()
+
+	type visited struct {
+		mediaType, filename, body string
+		depth                     int
+	}
+	var got []visited
+	err := WalkMIME(strings.NewReader(walkSource), func(part *WalkPart) error {
+		body, err := io.ReadAll(part.Body)
+		if err != nil {
+			return err
+		}
+		got = append(got, visited{part.MediaType, part.Filename, string(body), part.Depth})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []visited{
+		{"text/plain", "", "Café report", 2},
+		{"text/html", "", "<p>Report</p>", 2},
+		{"application/pdf", "report.pdf", "%PDF-1.4\n", 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d parts, got %+v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("part %d: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestWalkMIMESinglePart(t *testing.T) {
+	t.Parallel()
+
+	var bodies []string
+	err := WalkMIME(strings.NewReader("Subject: Hi\r\n\r\nHello"), func(part *WalkPart) error {
+		body, _ := io.ReadAll(part.Body)
+		bodies = append(bodies, part.MediaType+": "+string(body))
+		return nil
+	})
+	if err != nil || len(bodies) != 1 || bodies[0] != "text/plain: Hello" {
+		t.Errorf("unexpected walk %v, %v", bodies, err)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/messages/1.eml", "/api/messages/1.source":
+			_, _ = io.WriteString(w, walkSource)
+		case "/api/messages/1/parts/report":
+			_, _ = io.WriteString(w, "%PDF-1.4\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(server.URL)
+
+	var buf bytes.Buffer
+	n, err := client.WriteMessageTo(ctx, "1", &buf)
+	if err != nil || n != int64(len(walkSource)) || buf.String() != walkSource {
+		t.Errorf("unexpected WriteMessageTo result %d, %v", n, err)
+	}
+
+	attachment, err := client.OpenAttachment(ctx, "1", "report")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(attachment)
+	_ = attachment.Close()
+	if string(data) != "%PDF-1.4\n" {
+		t.Errorf("unexpected attachment %q", data)
+	}
+
+	if _, err := client.OpenMessageEML(ctx, "2"); err == nil {
+		t.Error("expected error for missing message")
+	}
+
+	parts := 0
+	if err := client.WalkMessage(ctx, "1", func(*WalkPart) error { parts++; return nil }); err != nil || parts != 3 {
+		t.Errorf("expected 3 parts, got %d, %v", parts, err)
+	}
+}
+
+// largeAttachmentSize is the size of the attachment used by the benchmarks
+const largeAttachmentSize = 32 << 20
+
+// newLargeMessageServer serves a message with a large base64 attachment
+// without holding it in memory
+func newLargeMessageServer(b *testing.B) *httptest.Server {
+	b.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "Subject: Export\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n"+
+			"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=export.pdf\r\n"+
+			"Content-Transfer-Encoding: base64\r\n\r\n")
+		line := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'x'}, 57)) + "\r\n"
+		for written := 0; written < largeAttachmentSize; written += 57 {
+			_, _ = io.WriteString(w, line)
+		}
+		_, _ = io.WriteString(w, "--b--\r\n")
+	}))
+	b.Cleanup(server.Close)
+	return server
+}
+
+// measurePeakHeap reports the peak growth of the live heap while running fn
+func measurePeakHeap(b *testing.B, fn func()) {
+	b.Helper()
+
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	read := func() int64 {
+		metrics.Read(sample)
+		return int64(sample[0].Value.Uint64())
+	}
+
+	runtime.GC()
+	base := read()
+	var peak atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if v := read() - base; v > peak.Load() {
+					peak.Store(v)
+				}
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	fn()
+	b.StopTimer()
+	close(done)
+	b.ReportMetric(float64(peak.Load())/(1<<20), "peak-MB")
+}
+
+func BenchmarkLargeAttachmentBuffered(b *testing.B) {
+	client := NewClient(newLargeMessageServer(b).URL)
+
+	measurePeakHeap(b, func() {
+		for i := 0; i < b.N; i++ {
+			source, err := client.GetMessageSource("1")
+			if err != nil {
+				b.Fatal(err)
+			}
+			parsed, err := parseSource(source, discardLogger)
+			if err != nil || len(parsed.Attachments) != 1 {
+				b.Fatalf("unexpected parse result %v, %v", parsed, err)
+			}
+		}
+	})
+}
+
+func BenchmarkLargeAttachmentStreamed(b *testing.B) {
+	client := NewClient(newLargeMessageServer(b).URL)
+
+	measurePeakHeap(b, func() {
+		for i := 0; i < b.N; i++ {
+			err := client.WalkMessage(context.Background(), "1", func(part *WalkPart) error {
+				_, err := io.Copy(io.Discard, part.Body)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+#!/bin/sh
+# Generates the S/MIME and PGP/MIME fixtures of security_test.go with
+# OpenSSL and GnuPG. The keys are test keys and must not be used elsewhere.
+set -e
+cd "$(dirname "$0")"
+TMP=$(mktemp -d)
+trap 'rm -rf "$TMP"' EXIT
+
+entity='Content-Type: text/plain; charset=utf-8\r\n\r\nYour statement is ready.\r\nReference: STMT-42\r\n'
+printf "$entity" > "$TMP/entity.txt"
+
+# S/MIME: a test CA and a certificate for alice@example.com
+openssl req -x509 -newkey rsa:2048 -nodes -keyout "$TMP/ca.key" -out ca.pem -days 36500 -subj "/CN=Sendria Test CA" 2>/dev/null
+openssl req -newkey rsa:2048 -nodes -keyout alice.key -out "$TMP/alice.csr" -subj "/CN=Alice/emailAddress=alice@example.com" 2>/dev/null
+printf "subjectAltName=email:alice@example.com\nkeyUsage=digitalSignature,keyEncipherment\nextendedKeyUsage=emailProtection\n" > "$TMP/ext.cnf"
+openssl x509 -req -in "$TMP/alice.csr" -CA ca.pem -CAkey "$TMP/ca.key" -CAcreateserial -CAserial "$TMP/ca.srl" \
+	-out alice.pem -days 36500 -extfile "$TMP/ext.cnf" 2>/dev/null
+
+openssl cms -sign -in "$TMP/entity.txt" -signer alice.pem -inkey alice.key \
+	-from alice@example.com -to bob@example.org -subject "Signed statement" -out smime-signed.eml
+openssl cms -sign -nodetach -in "$TMP/entity.txt" -signer alice.pem -inkey alice.key \
+	-from alice@example.com -to bob@example.org -subject "Opaque statement" -out smime-opaque.eml
+openssl cms -encrypt -aes256 -in "$TMP/entity.txt" \
+	-from bob@example.org -to alice@example.com -subject "Encrypted statement" -out smime-encrypted.eml alice.pem
+
+# PGP: alice (RSA), bob (RSA, passphrase "secret") and carol (Ed25519)
+export GNUPGHOME="$TMP/gnupg"
+mkdir -m 700 "$GNUPGHOME"
+G="gpg --batch --yes --quiet --no-greeting --pinentry-mode loopback"
+$G --passphrase '' --quick-gen-key 'Alice <alice@example.com>' rsa2048 sign,cert never
+$G --passphrase '' --quick-add-key "$(gpg --list-keys --with-colons alice@example.com | awk -F: '/^fpr/ {print $10; exit}')" rsa2048 encr never
+$G --passphrase 'secret' --quick-gen-key 'Bob <bob@example.org>' rsa2048 sign,cert never
+$G --passphrase 'secret' --quick-add-key "$(gpg --list-keys --with-colons bob@example.org | awk -F: '/^fpr/ {print $10; exit}')" rsa2048 encr never
+$G --passphrase '' --quick-gen-key 'Carol <carol@example.com>' ed25519 sign never
+
+$G --armor --export alice@example.com carol@example.com > pgp-public.asc
+$G --passphrase '' --armor --export-secret-keys alice@example.com > pgp-alice-secret.asc
+$G --passphrase 'secret' --armor --export-secret-keys bob@example.org > pgp-bob-secret.asc
+
+$G --passphrase '' --armor --digest-algo SHA256 -u alice@example.com --detach-sign -o "$TMP/alice.sig" "$TMP/entity.txt"
+$G --passphrase '' --armor -u carol@example.com --detach-sign -o "$TMP/carol.sig" "$TMP/entity.txt"
+$G --armor --trust-model always -r alice@example.com --encrypt -o "$TMP/to-alice.asc" "$TMP/entity.txt"
+$G --passphrase '' --armor --trust-model always -u carol@example.com -r bob@example.org --sign --encrypt -o "$TMP/to-bob.asc" "$TMP/entity.txt"
+
+# signed writes a multipart/signed PGP/MIME message
+signed() {
+	printf 'From: %s\r\nTo: bob@example.org\r\nSubject: %s\r\nMIME-Version: 1.0\r\n' "$1" "$2"
+	printf 'Content-Type: multipart/signed; boundary="sig"; micalg=%s; protocol="application/pgp-signature"\r\n\r\n' "$3"
+	printf '%s\r\n' --sig
+	printf "$entity"
+	printf '\r\n%s\r\n' --sig
+	printf 'Content-Type: application/pgp-signature; name="signature.asc"\r\n'
+	printf 'Content-Disposition: attachment; filename="signature.asc"\r\n\r\n'
+	sed 's/$/\r/' "$4"
+	printf '%s\r\n' --sig--
+}
+
+# encrypted writes a multipart/encrypted PGP/MIME message
+encrypted() {
+	printf 'From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n' "$1" "$2" "$3"
+	printf 'Content-Type: multipart/encrypted; boundary="enc"; protocol="application/pgp-encrypted"\r\n\r\n'
+	printf '%s\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n\r\n%s\r\n' --enc --enc
+	printf 'Content-Type: application/octet-stream; name="encrypted.asc"\r\n\r\n'
+	sed 's/$/\r/' "$4"
+	printf '%s\r\n' --enc--
+}
+
+signed alice@example.com "Signed statement" pgp-sha256 "$TMP/alice.sig" > pgp-signed.eml
+signed carol@example.com "Signed statement" pgp-sha256 "$TMP/carol.sig" > pgp-signed-ed25519.eml
+encrypted bob@example.org alice@example.com "Encrypted statement" "$TMP/to-alice.asc" > pgp-encrypted.eml
+encrypted carol@example.com bob@example.org "Signed and encrypted statement" "$TMP/to-bob.asc" > pgp-signed-encrypted.eml
@@ -0,0 +1,161 @@
+package testhelpers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// ArtifactsDirEnv names the environment variable that enables the failure
+// artifact dump of NewEmailTestClient
+const ArtifactsDirEnv = "SENDRIA_ARTIFACTS_DIR"
+
+// artifactMessage describes the files written for one message
+type artifactMessage struct {
+	ID          string
+	Subject     string
+	From        string
+	To          string
+	EML         string
+	HTML        string
+	Text        string
+	Attachments []string
+	Errors      []string
+}
+
+// artifactIndex renders the gallery linking all written files
+var artifactIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+section { border: 1px solid #ccc; margin-bottom: 2em; padding: 1em; }
+.error { color: #b00; }
+iframe { width: 100%; height: 400px; border: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Messages}} captured message(s)</p>
+{{range .Messages}}<section>
+<h2>{{.Subject}}</h2>
+<p>ID {{.ID}} &middot; From: {{.From}} &middot; To: {{.To}}</p>
+{{range .Errors}}<p class="error">{{.}}</p>
+{{end}}<ul>
+{{if .EML}}<li><a href="{{.EML}}">{{.EML}}</a></li>{{end}}
+{{if .HTML}}<li><a href="{{.HTML}}">{{.HTML}}</a></li>{{end}}
+{{if .Text}}<li><a href="{{.Text}}">{{.Text}}</a></li>{{end}}
+{{range .Attachments}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{if .HTML}}<iframe src="{{.HTML}}" sandbox></iframe>{{end}}
+</section>
+{{end}}</body>
+</html>
+`))
+
+// DumpArtifacts writes every captured message into dir: the .eml, the
+// rendered .html and .txt bodies, the attachments and an index.html gallery
+// linking them all. A message whose files cannot be fetched or written is
+// listed in the gallery with its errors. It returns the path of the gallery.
+func (i *Inbox) DumpArtifacts(dir, title string) (string, error) {
+	messages, err := i.Messages()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating artifacts directory: %w", err)
+	}
+
+	entries := make([]artifactMessage, 0, len(messages))
+	for _, msg := range messages {
+		entries = append(entries, i.dumpMessage(dir, msg))
+	}
+
+	var index bytes.Buffer
+	err = artifactIndex.Execute(&index, struct {
+		Title    string
+		Messages []artifactMessage
+	}{title, entries})
+	if err != nil {
+		return "", fmt.Errorf("rendering index: %w", err)
+	}
+
+	path := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(path, index.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("writing index: %w", err)
+	}
+	return path, nil
+}
+
+// dumpMessage writes the files of a single message. Failures are recorded
+// in the entry, so a broken message still shows up in the gallery.
+func (i *Inbox) dumpMessage(dir string, msg sendria.Message) artifactMessage {
+	entry := artifactMessage{
+		ID:      msg.ID,
+		Subject: msg.Subject,
+		From:    formatRecipients(msg.From),
+		To:      formatRecipients(msg.To),
+	}
+	write := func(name string, data []byte) bool {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			entry.Errors = append(entry.Errors, err.Error())
+			return false
+		}
+		return true
+	}
+
+	eml, err := i.client.GetMessageEML(msg.ID)
+	if err != nil {
+		entry.Errors = append(entry.Errors, fmt.Sprintf("getting eml: %v", err))
+		eml = []byte(msg.Source)
+	}
+	if len(eml) > 0 && write(msg.ID+".eml", eml) {
+		entry.EML = msg.ID + ".eml"
+	}
+
+	if html, err := i.client.GetMessageHTML(msg.ID); err == nil && html != "" {
+		// Embed inline images, which the artifact could not load otherwise
+		if r, err := msg.ResolveCIDs(); err == nil && len(r.References) > len(r.Broken) {
+			html = r.InlineHTML()
+		}
+		if write(msg.ID+".html", []byte(html)) {
+			entry.HTML = msg.ID + ".html"
+		}
+	}
+
+	if plain, err := i.client.GetMessagePlain(msg.ID); err == nil && plain != "" {
+		if write(msg.ID+".txt", []byte(plain)) {
+			entry.Text = msg.ID + ".txt"
+		}
+	}
+
+	if err := msg.LoadParts(); err != nil {
+		entry.Errors = append(entry.Errors, fmt.Sprintf("parsing message: %v", err))
+	}
+	// A broken message should not hide the attachments found so far
+	n := 0
+	msg.GetMIME().Walk(func(node *sendria.MIMENode) bool {
+		if node.IsMultipart() || !node.IsAttachment() {
+			return true
+		}
+		n++
+		filename := node.Filename
+		if filename == "" {
+			filename = "attachment"
+		}
+		name := fmt.Sprintf("%s-%d-%s", msg.ID, n, sanitizeFileName(filename))
+		if write(name, node.Body()) {
+			entry.Attachments = append(entry.Attachments, name)
+		}
+		return true
+	})
+
+	return entry
+}
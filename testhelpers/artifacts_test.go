@@ -0,0 +1,71 @@
+package testhelpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+)
+
+func TestDumpArtifacts(t *testing.T) {
+	fake := newFakeSendria(t)
+	inbox := NewInbox(sendria.NewClient(fake.URL))
+
+	id := fake.Add(t, invoiceEmail)
+	dir := filepath.Join(t.TempDir(), sanitizeFileName("TestSignup/welcome"))
+
+	index, err := inbox.DumpArtifacts(dir, "TestSignup/welcome")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		id + ".eml":           "Subject: Welcome aboard",
+		id + ".html":          `href="https://example.com/verify?token=abc"`,
+		id + "-1-invoice.pdf": "%PDF-1.4\n",
+		filepath.Base(index):  `<a href="` + id + `-1-invoice.pdf">`,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("missing artifact %s: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("artifact %s missing %q:\n%s", name, want, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, id+".txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no text artifact for HTML-only message, got %v", err)
+	}
+}
+
+func TestDumpArtifactsRecordsMessageErrors(t *testing.T) {
+	fake := newFakeSendria(t)
+	inbox := NewInbox(sendria.NewClient(fake.URL))
+
+	id := fake.Add(t, invoiceEmail)
+	dir := t.TempDir()
+	// A directory in place of the HTML file makes writing it fail
+	if err := os.Mkdir(filepath.Join(dir, id+".html"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	index, err := inbox.DumpArtifacts(dir, "broken")
+	if err != nil {
+		t.Fatalf("expected the dump to continue, got %v", err)
+	}
+
+	data, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `<p class="error">`) || !strings.Contains(string(data), id+"-1-invoice.pdf") {
+		t.Errorf("expected the error and the remaining files in the index:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, id+".eml")); err != nil {
+		t.Errorf("expected the eml artifact, got %v", err)
+	}
+}
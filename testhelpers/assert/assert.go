@@ -0,0 +1,156 @@
+// Package assert provides testify-style assertions for emails captured by
+// Sendria. Failed assertions report the error through TestingT and return
+// normally; see package require for assertions that stop the test.
+package assert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/testhelpers"
+)
+
+// TestingT is the subset of testing.TB used by the assertions. It is
+// compatible with testify's assert.TestingT.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+type tHelper interface {
+	Helper()
+}
+
+// EmailSent asserts that an email to the recipient with the subject arrives
+// within the default wait timeout of testhelpers.Inbox. It returns the
+// message, or nil on failure.
+func EmailSent(t TestingT, client *sendria.Client, to, subject string, msgAndArgs ...interface{}) *sendria.Message {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return EmailReceivedWithin(t, client, 0,
+		[]testhelpers.Criterion{testhelpers.To(to), testhelpers.Subject(subject)}, msgAndArgs...)
+}
+
+// EmailReceivedWithin asserts that an email satisfying all criteria arrives
+// within the timeout. A non-positive timeout uses the default wait timeout.
+// It returns the message, or nil on failure.
+func EmailReceivedWithin(t TestingT, client *sendria.Client, timeout time.Duration, criteria []testhelpers.Criterion, msgAndArgs ...interface{}) *sendria.Message {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	msg, err := testhelpers.NewInbox(client).WaitFor(timeout, criteria...)
+	if err != nil {
+		Fail(t, err, msgAndArgs...)
+		return nil
+	}
+	return msg
+}
+
+// EmailContains asserts that the plain text body of the message contains text
+func EmailContains(t TestingT, client *sendria.Client, msg *sendria.Message, text string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return NoError(t, testhelpers.NewInbox(client).CheckContent(msg, text), msgAndArgs...)
+}
+
+// NoEmailsSent asserts that no emails are captured after waiting for waitTime
+func NoEmailsSent(t TestingT, client *sendria.Client, waitTime time.Duration, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return NoError(t, testhelpers.NewInbox(client).CheckNoEmails(waitTime), msgAndArgs...)
+}
+
+// EmailCount asserts the number of captured emails
+func EmailCount(t TestingT, client *sendria.Client, expected int, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	count, err := testhelpers.NewInbox(client).Count()
+	if err != nil {
+		return Fail(t, err, msgAndArgs...)
+	}
+	if count != expected {
+		return Fail(t, fmt.Errorf("expected %d emails, got %d", expected, count), msgAndArgs...)
+	}
+	return true
+}
+
+// Subject asserts the subject of the message
+func Subject(t TestingT, msg *sendria.Message, expected string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return MessageMatches(t, msg, []testhelpers.Criterion{testhelpers.Subject(expected)}, msgAndArgs...)
+}
+
+// HasAttachment asserts that the message carries an attachment with the given
+// filename. An empty contentType matches any content type.
+func HasAttachment(t TestingT, msg *sendria.Message, filename, contentType string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return MessageMatches(t, msg, []testhelpers.Criterion{testhelpers.HasAttachment(filename, contentType)}, msgAndArgs...)
+}
+
+// MessageMatches asserts that the message satisfies all criteria
+func MessageMatches(t TestingT, msg *sendria.Message, criteria []testhelpers.Criterion, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return NoError(t, testhelpers.Check(msg, criteria...), msgAndArgs...)
+}
+
+// NoError reports err as an assertion failure if it is not nil
+func NoError(t TestingT, err error, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if err != nil {
+		return Fail(t, err, msgAndArgs...)
+	}
+	return true
+}
+
+// Fail reports a failed assertion with an optional message
+func Fail(t TestingT, err error, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if msg := messageFromMsgAndArgs(msgAndArgs...); msg != "" {
+		t.Errorf("%v\nMessages: %s", err, msg)
+		return false
+	}
+	t.Errorf("%v", err)
+	return false
+}
+
+// messageFromMsgAndArgs formats the optional message arguments like testify
+func messageFromMsgAndArgs(msgAndArgs ...interface{}) string {
+	switch len(msgAndArgs) {
+	case 0:
+		return ""
+	case 1:
+		if msg, ok := msgAndArgs[0].(string); ok {
+			return msg
+		}
+		return fmt.Sprintf("%+v", msgAndArgs[0])
+	default:
+		if format, ok := msgAndArgs[0].(string); ok {
+			return fmt.Sprintf(format, msgAndArgs[1:]...)
+		}
+		return fmt.Sprint(msgAndArgs...)
+	}
+}
@@ -0,0 +1,46 @@
+package assert
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// recorder captures assertion failures instead of failing the test
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMessageAssertions(t *testing.T) {
+	t.Parallel()
+
+	msg := &sendria.Message{
+		ID:          "1",
+		Subject:     "Invoice",
+		Attachments: []sendria.Attachment{{Filename: "invoice.pdf", Type: "application/pdf"}},
+	}
+
+	rec := &recorder{}
+	if !Subject(rec, msg, "Invoice") {
+		t.Errorf("expected subject assertion to pass: %v", rec.errors)
+	}
+	if !HasAttachment(rec, msg, "invoice.pdf", "application/pdf") {
+		t.Errorf("expected attachment assertion to pass: %v", rec.errors)
+	}
+
+	if Subject(rec, msg, "Other", "checking subject") {
+		t.Error("expected subject assertion to fail")
+	}
+	if len(rec.errors) != 1 {
+		t.Fatalf("expected 1 failure, got %d", len(rec.errors))
+	}
+	if !strings.Contains(rec.errors[0], `- subject "Other"`) || !strings.Contains(rec.errors[0], "Messages: checking subject") {
+		t.Errorf("unexpected failure: %s", rec.errors[0])
+	}
+}
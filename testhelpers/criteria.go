@@ -0,0 +1,551 @@
+package testhelpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/models"
+)
+
+// hrefPattern matches href attributes in HTML bodies
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']*)["']`)
+
+// Criterion is a single condition a captured email must satisfy. Criteria are
+// evaluated by Inbox, Expectation and the assert, require and gomega packages.
+type Criterion struct {
+	desc string
+	eval func(cd *candidate) (bool, string)
+}
+
+// String describes the criterion
+func (c Criterion) String() string {
+	return c.desc
+}
+
+// To matches emails addressed to the given recipient
+func To(email string) Criterion {
+	return Criterion{fmt.Sprintf("to %q", email), func(cd *candidate) (bool, string) {
+		return hasRecipient(cd.msg.To, email), fmt.Sprintf("to %s", formatRecipients(cd.msg.To))
+	}}
+}
+
+// From matches emails sent by the given address
+func From(email string) Criterion {
+	return Criterion{fmt.Sprintf("from %q", email), func(cd *candidate) (bool, string) {
+		return hasRecipient(cd.msg.From, email), fmt.Sprintf("from %s", formatRecipients(cd.msg.From))
+	}}
+}
+
+// Subject matches emails whose subject equals the given text
+func Subject(subject string) Criterion {
+	return Criterion{fmt.Sprintf("subject %q", subject), func(cd *candidate) (bool, string) {
+		return cd.msg.Subject == subject, fmt.Sprintf("subject %q", cd.msg.Subject)
+	}}
+}
+
+// SubjectContains matches emails whose subject contains the given text
+func SubjectContains(text string) Criterion {
+	return Criterion{fmt.Sprintf("subject contains %q", text), func(cd *candidate) (bool, string) {
+		return strings.Contains(cd.msg.Subject, text), fmt.Sprintf("subject %q", cd.msg.Subject)
+	}}
+}
+
+// BodyContains matches emails whose plain text body contains the given text
+func BodyContains(text string) Criterion {
+	return Criterion{fmt.Sprintf("body contains %q", text), func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		body := readableBody(msg)
+		return strings.Contains(body, text), fmt.Sprintf("body %q", truncate(body, 80))
+	}}
+}
+
+// HTMLContains matches emails whose HTML body contains the given text
+func HTMLContains(text string) Criterion {
+	return Criterion{fmt.Sprintf("html contains %q", text), func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		html := partBody(msg, "text/html")
+		return strings.Contains(html, text), fmt.Sprintf("html %q", truncate(html, 80))
+	}}
+}
+
+// HTMLHasLink matches emails whose HTML body contains a link whose href
+// contains the given text
+func HTMLHasLink(text string) Criterion {
+	return Criterion{fmt.Sprintf("html has link containing %q", text), func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		links := htmlLinks(partBody(msg, "text/html"))
+		for _, link := range links {
+			if strings.Contains(link, text) {
+				return true, fmt.Sprintf("link %q", link)
+			}
+		}
+		return false, fmt.Sprintf("links %q", links)
+	}}
+}
+
+// InlineImagesResolved matches emails whose HTML body references only
+// existing parts by cid: URL and that carry no unreferenced inline parts
+func InlineImagesResolved() Criterion {
+	return Criterion{"inline images resolved", func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		r, err := msg.ResolveCIDs()
+		if err != nil {
+			return false, err.Error()
+		}
+		problems := cidProblems(r)
+		if len(problems) == 0 {
+			return true, fmt.Sprintf("%d references resolved", len(r.References))
+		}
+		return false, strings.Join(problems, ", ")
+	}}
+}
+
+// cidProblems describes the broken references and orphan parts of a
+// resolution
+func cidProblems(r *sendria.CIDResolution) []string {
+	var problems []string
+	for _, ref := range r.Broken {
+		problems = append(problems, fmt.Sprintf("broken reference %q", ref.URL))
+	}
+	for _, node := range r.Orphans {
+		problems = append(problems, fmt.Sprintf("unreferenced inline part <%s> (%s)", node.ContentID, node.ContentType))
+	}
+	return problems
+}
+
+// ConsistentAlternatives matches emails whose text/plain body has all links
+// of the HTML body and whose words diverge from the text of the HTML body by
+// at most maxDivergence. A non-positive maxDivergence uses
+// models.DefaultMaxDivergence.
+func ConsistentAlternatives(maxDivergence float64) Criterion {
+	return Criterion{"consistent plain text and html", func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		report, err := msg.CheckAlternatives(maxDivergence)
+		if err != nil {
+			return false, err.Error()
+		}
+		return report.Consistent(), describeConsistency(report)
+	}}
+}
+
+// describeConsistency summarizes the differences of a consistency report
+func describeConsistency(r *sendria.ConsistencyReport) string {
+	desc := fmt.Sprintf("divergence %.2f (max %.2f)", r.Divergence, r.MaxDivergence)
+	if len(r.MissingLinks) > 0 {
+		desc += fmt.Sprintf(", plain text lacks links %q", r.MissingLinks)
+	}
+	if len(r.MissingWords) > 0 {
+		desc += fmt.Sprintf(", plain text lacks %q", truncateWords(r.MissingWords, 10))
+	}
+	if len(r.ExtraWords) > 0 {
+		desc += fmt.Sprintf(", html lacks %q", truncateWords(r.ExtraWords, 10))
+	}
+	return desc
+}
+
+// truncateWords shortens a word list to at most n words
+func truncateWords(words []string, n int) []string {
+	if len(words) <= n {
+		return words
+	}
+	return append(words[:n:n], "...")
+}
+
+// HasAttachment matches emails carrying an attachment with the given
+// filename. An empty contentType matches any content type.
+func HasAttachment(filename, contentType string) Criterion {
+	desc := fmt.Sprintf("has attachment %q", filename)
+	if contentType != "" {
+		desc = fmt.Sprintf("has attachment %q (%s)", filename, contentType)
+	}
+	return Criterion{desc, func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		attachments := msg.GetAttachments()
+		found := make([]string, 0, len(attachments))
+		for _, att := range attachments {
+			if att.Filename == filename && (contentType == "" || strings.EqualFold(att.Type, contentType)) {
+				return true, fmt.Sprintf("attachment %q (%s)", att.Filename, att.Type)
+			}
+			found = append(found, fmt.Sprintf("%s (%s)", att.Filename, att.Type))
+		}
+		return false, fmt.Sprintf("attachments %q", found)
+	}}
+}
+
+// HeaderEquals matches emails where the given header has exactly the given
+// value
+func HeaderEquals(name, value string) Criterion {
+	return Criterion{fmt.Sprintf("header %s: %q", name, value), func(cd *candidate) (bool, string) {
+		header, err := cd.headers()
+		if err != nil {
+			return false, err.Error()
+		}
+		if _, ok := header[textproto.CanonicalMIMEHeaderKey(name)]; !ok {
+			return false, fmt.Sprintf("header %s missing", name)
+		}
+		got := header.Get(name)
+		return got == value, fmt.Sprintf("header %s: %q", name, got)
+	}}
+}
+
+// Correlated matches emails whose X-Correlation-ID header or traceparent trace
+// ID equals id
+func Correlated(id string) Criterion {
+	return Criterion{fmt.Sprintf("correlated with %q", id), func(cd *candidate) (bool, string) {
+		header, err := cd.headers()
+		if err != nil {
+			return false, err.Error()
+		}
+		c := sendria.CorrelationFromHeader(header)
+		return c.Matches(id), fmt.Sprintf("correlation ID %q, trace ID %q", c.ID, c.TraceID)
+	}}
+}
+
+// BounceFor matches delivery status notifications reporting that delivery to
+// the given recipient failed
+func BounceFor(email string) Criterion {
+	return Criterion{fmt.Sprintf("bounce for %q", email), func(cd *candidate) (bool, string) {
+		status, got := recipientStatus(cd, email)
+		if status == nil {
+			return false, got
+		}
+		return status.Action == models.ActionFailed, got
+	}}
+}
+
+// DeliveryStatus matches delivery status notifications reporting the given
+// enhanced status code, e.g. "5.1.1", for the recipient
+func DeliveryStatus(email, status string) Criterion {
+	return Criterion{fmt.Sprintf("delivery status %s for %q", status, email), func(cd *candidate) (bool, string) {
+		got, desc := recipientStatus(cd, email)
+		if got == nil {
+			return false, desc
+		}
+		return got.Status == status, desc
+	}}
+}
+
+// recipientStatus returns the delivery status of a recipient reported by the
+// candidate, or nil and a description of what was found instead
+func recipientStatus(cd *candidate, email string) (*sendria.RecipientStatus, string) {
+	msg, err := cd.message()
+	if err != nil {
+		return nil, err.Error()
+	}
+	report, err := msg.DeliveryReport()
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	status, ok := report.Recipient(email)
+	if !ok {
+		found := make([]string, 0, len(report.Recipients))
+		for _, r := range report.Recipients {
+			found = append(found, r.FinalRecipient)
+		}
+		return nil, fmt.Sprintf("report for %q", found)
+	}
+	return &status, fmt.Sprintf("action %s, status %s, diagnostic %q", status.Action, status.Status, status.DiagnosticCode)
+}
+
+// InviteFor matches calendar invites (METHOD:REQUEST) to the attendee for an
+// event starting at start. A zero start matches any time.
+func InviteFor(attendee string, start time.Time) Criterion {
+	return calendarEvent(models.MethodRequest, attendee, start)
+}
+
+// CancellationFor matches calendar cancellations (METHOD:CANCEL) sent to the
+// attendee for an event starting at start. A zero start matches any time.
+func CancellationFor(attendee string, start time.Time) Criterion {
+	return calendarEvent(models.MethodCancel, attendee, start)
+}
+
+// calendarEvent matches calendar messages of the iTIP method for the
+// attendee and start time
+func calendarEvent(method, attendee string, start time.Time) Criterion {
+	desc := fmt.Sprintf("calendar %s for %q", method, attendee)
+	if !start.IsZero() {
+		desc += " at " + start.Format(time.RFC3339)
+	}
+	return Criterion{desc, func(cd *candidate) (bool, string) {
+		invite, got := calendarInvite(cd)
+		if invite == nil {
+			return false, got
+		}
+		_, invited := invite.Attendee(attendee)
+		return invite.Method == method && invited && (start.IsZero() || invite.Start.Equal(start)), got
+	}}
+}
+
+// CalendarUID matches calendar messages for the event with the given UID
+func CalendarUID(uid string) Criterion {
+	return Criterion{fmt.Sprintf("calendar event %q", uid), func(cd *candidate) (bool, string) {
+		invite, got := calendarInvite(cd)
+		if invite == nil {
+			return false, got
+		}
+		return invite.UID == uid, got
+	}}
+}
+
+// calendarInvite returns the calendar invite of the candidate and a
+// description of it, or nil and a description of the problem
+func calendarInvite(cd *candidate) (*sendria.CalendarInvite, string) {
+	msg, err := cd.message()
+	if err != nil {
+		return nil, err.Error()
+	}
+	invite, err := msg.CalendarInvite()
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	attendees := make([]string, 0, len(invite.Attendees))
+	for _, a := range invite.Attendees {
+		attendees = append(attendees, a.Email)
+	}
+	return invite, fmt.Sprintf("calendar %s %q for %q at %s", invite.Method, invite.UID, attendees, invite.Start.Format(time.RFC3339))
+}
+
+// Matching matches emails satisfying a custom predicate
+func Matching(desc string, fn func(msg *sendria.Message) bool) Criterion {
+	return Criterion{desc, func(cd *candidate) (bool, string) {
+		msg, err := cd.message()
+		if err != nil {
+			return false, err.Error()
+		}
+		return fn(msg), "predicate not satisfied"
+	}}
+}
+
+// Check verifies that a single message satisfies all criteria. The message
+// must carry its Source if any criterion inspects the headers.
+func Check(msg *sendria.Message, criteria ...Criterion) error {
+	if msg == nil {
+		return errors.New("message is nil")
+	}
+
+	r := evaluate(&candidate{msg: *msg}, criteria)
+	if r.matched == len(criteria) {
+		return nil
+	}
+	return &MatchError{criteria: criteria, results: []result{r}}
+}
+
+// MatchError is returned when no captured email satisfies all criteria. Its
+// message explains which criteria the closest messages missed.
+type MatchError struct {
+	criteria []Criterion
+	results  []result
+	waited   string
+}
+
+// Error renders a diff-style report of the closest non-matching messages
+func (e *MatchError) Error() string {
+	var b strings.Builder
+	b.WriteString("No email matched expectation")
+	if e.waited != "" {
+		fmt.Fprintf(&b, " within %s", e.waited)
+	}
+	b.WriteString(":\n")
+	for _, c := range e.criteria {
+		fmt.Fprintf(&b, "    %s\n", c.desc)
+	}
+
+	if len(e.results) == 0 {
+		b.WriteString("No messages were captured")
+		return b.String()
+	}
+
+	shown := len(e.results)
+	if shown > 3 {
+		shown = 3
+	}
+	fmt.Fprintf(&b, "Closest messages (%d of %d):", shown, len(e.results))
+	for _, r := range e.results[:shown] {
+		fmt.Fprintf(&b, "\n  --- ID %s, Subject %q (%d/%d criteria matched)",
+			r.cd.msg.ID, r.cd.msg.Subject, r.matched, len(e.criteria))
+		for _, d := range r.details {
+			if d.ok {
+				fmt.Fprintf(&b, "\n      %s", d.desc)
+				continue
+			}
+			fmt.Fprintf(&b, "\n    - %s\n    + %s", d.desc, d.got)
+		}
+	}
+	return b.String()
+}
+
+// candidate is a captured message evaluated against criteria. The full
+// message and its headers are loaded lazily and cached, since messages are
+// immutable once captured.
+type candidate struct {
+	ctx     context.Context
+	client  *sendria.Client
+	msg     sendria.Message
+	full    *sendria.Message
+	header  mail.Header
+	loadErr error
+	loaded  bool
+}
+
+// result holds the outcome of evaluating one candidate
+type result struct {
+	cd      *candidate
+	matched int
+	details []checkResult
+}
+
+// checkResult holds the outcome of a single criterion
+type checkResult struct {
+	desc string
+	ok   bool
+	got  string
+}
+
+// evaluate runs all criteria against a candidate
+func evaluate(cd *candidate, criteria []Criterion) result {
+	r := result{cd: cd}
+	for _, c := range criteria {
+		ok, got := c.eval(cd)
+		if ok {
+			r.matched++
+		}
+		r.details = append(r.details, checkResult{desc: c.desc, ok: ok, got: got})
+	}
+	return r
+}
+
+// rank orders results by the number of satisfied criteria, best first
+func rank(results []result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].matched > results[j].matched
+	})
+}
+
+// message returns the full message including parsed parts and attachments
+func (cd *candidate) message() (*sendria.Message, error) {
+	if cd.loaded {
+		return cd.full, cd.loadErr
+	}
+
+	cd.loaded = true
+	// Without a client the message is used as it is
+	if cd.msg.Source != "" || cd.client == nil {
+		msg := cd.msg
+		cd.full = &msg
+		return cd.full, nil
+	}
+
+	cd.full, cd.loadErr = cd.client.GetMessageContext(cd.ctx, cd.msg.ID)
+	if cd.loadErr != nil {
+		cd.loadErr = fmt.Errorf("loading message %s: %w", cd.msg.ID, cd.loadErr)
+	}
+	return cd.full, cd.loadErr
+}
+
+// headers returns the parsed headers of the message source
+func (cd *candidate) headers() (mail.Header, error) {
+	if cd.header != nil {
+		return cd.header, nil
+	}
+
+	msg, err := cd.message()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Source == "" {
+		return nil, fmt.Errorf("message %s has no source loaded", msg.ID)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.Source))
+	if err != nil {
+		return nil, fmt.Errorf("parsing headers: %w", err)
+	}
+	cd.header = parsed.Header
+	return cd.header, nil
+}
+
+// hasRecipient reports whether the list contains the given address
+func hasRecipient(recipients []sendria.Recipient, email string) bool {
+	for _, r := range recipients {
+		if strings.EqualFold(r.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRecipients renders the addresses of a recipient list
+func formatRecipients(recipients []sendria.Recipient) string {
+	emails := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		emails = append(emails, r.Email)
+	}
+	return fmt.Sprintf("%q", emails)
+}
+
+// partBody returns the concatenated bodies of all parts of the media type
+func partBody(msg *sendria.Message, mediaType string) string {
+	var bodies []string
+	for _, part := range msg.GetParts() {
+		if strings.EqualFold(part.Type, mediaType) {
+			bodies = append(bodies, part.Body)
+		}
+	}
+	return strings.Join(bodies, "\n")
+}
+
+// readableBody returns the text/plain bodies of an email, or the text of its
+// HTML bodies if it has no plain text
+func readableBody(msg *sendria.Message) string {
+	if body := partBody(msg, "text/plain"); strings.TrimSpace(body) != "" {
+		return body
+	}
+	return models.HTMLToText(partBody(msg, "text/html"))
+}
+
+// htmlLinks returns the href targets found in an HTML body
+func htmlLinks(html string) []string {
+	matches := hrefPattern.FindAllStringSubmatch(html, -1)
+	links := make([]string, 0, len(matches))
+	for _, m := range matches {
+		links = append(links, m[1])
+	}
+	return links
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
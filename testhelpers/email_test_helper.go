@@ -2,32 +2,116 @@
 package testhelpers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/lint"
 )
 
 // EmailTestClient wraps Sendria client with test-friendly helpers
 type EmailTestClient struct {
 	*sendria.Client
-	t *testing.T
+	t     *testing.T
+	ctx   context.Context
+	inbox *Inbox
 }
 
+// TestClientOption is a functional option for configuring the EmailTestClient
+type TestClientOption func(*testClientConfig)
+
+// testClientConfig holds the options of an EmailTestClient
+type testClientConfig struct {
+	artifactsDir string
+	inboxOpts    []InboxOption
+	clientOpts   []sendria.Option
+}
+
+// WithArtifactsDir writes every captured message into dir/<TestName>/ when
+// the test fails, so CI systems can upload them. It defaults to the
+// SENDRIA_ARTIFACTS_DIR environment variable; an empty dir disables the dump.
+func WithArtifactsDir(dir string) TestClientOption {
+	return func(c *testClientConfig) {
+		c.artifactsDir = dir
+	}
+}
+
+// WithInboxOptions configures the Inbox behind the client, e.g. its clock,
+// wait timeout or polling intervals
+func WithInboxOptions(opts ...InboxOption) TestClientOption {
+	return func(c *testClientConfig) {
+		c.inboxOpts = append(c.inboxOpts, opts...)
+	}
+}
+
+// WithClientOptions configures the sendria.Client behind the client, e.g.
+// sendria.WithSecurityKeys to verify and decrypt signed and encrypted emails
+func WithClientOptions(opts ...sendria.Option) TestClientOption {
+	return func(c *testClientConfig) {
+		c.clientOpts = append(c.clientOpts, opts...)
+	}
+}
+
+// deadlineMargin is the time left to a test for reporting after its deadline
+// bounded waits give up
+const deadlineMargin = 5 * time.Second
+
+// minWaitTimeout is the shortest wait of a test client, used when the test
+// deadline is closer than deadlineMargin
+const minWaitTimeout = time.Second
+
+// testClientCacheSize is the size of the response bodies cached by a test
+// client
+const testClientCacheSize = 32 << 20
+
 // NewEmailTestClient creates a test-friendly email client with automatic cleanup
-func NewEmailTestClient(t *testing.T) *EmailTestClient {
+func NewEmailTestClient(t *testing.T, opts ...TestClientOption) *EmailTestClient {
 	t.Helper()
 
+	cfg := &testClientConfig{
+		artifactsDir: os.Getenv(ArtifactsDirEnv),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	// Get URL from environment or use default
 	url := os.Getenv("SENDRIA_URL")
 	if url == "" {
 		url = "http://localhost:1080"
 	}
 
-	client := sendria.NewClient(url)
+	// Helpers read the same messages repeatedly, so responses are cached
+	clientOpts := append([]sendria.Option{sendria.WithLogger(TestLogger(t)), sendria.WithCache(testClientCacheSize)}, cfg.clientOpts...)
+	client := sendria.NewClient(url, clientOpts...)
+
+	// Waits must give up before the test binary times out, so that the
+	// failure is reported with an explanation instead of a panic
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	timeout := DefaultWaitTimeout
+	if envTimeout, ok := envWaitTimeout(); ok {
+		timeout = envTimeout
+	}
+	if deadline, ok := t.Deadline(); ok {
+		remaining := time.Until(deadline) - deadlineMargin
+		if remaining < minWaitTimeout {
+			remaining = minWaitTimeout
+		}
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithTimeout(ctx, remaining)
+		t.Cleanup(cancelDeadline)
+		if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	inbox := NewInbox(client, append([]InboxOption{WithWaitTimeout(timeout)}, cfg.inboxOpts...)...)
 
 	// Clear messages at start
 	if err := client.DeleteAllMessages(); err != nil {
@@ -52,6 +136,15 @@ func NewEmailTestClient(t *testing.T) *EmailTestClient {
 				t.Logf("[%d] From: %s, To: %s, Subject: %s",
 					i+1, fromEmail, toEmail, msg.Subject)
 			}
+
+			if cfg.artifactsDir != "" {
+				dir := filepath.Join(cfg.artifactsDir, sanitizeFileName(t.Name()))
+				if index, err := inbox.DumpArtifacts(dir, t.Name()); err != nil {
+					t.Logf("Failed to write email artifacts: %v", err)
+				} else {
+					t.Logf("Email artifacts written to %s", index)
+				}
+			}
 		}
 		_ = client.DeleteAllMessages()
 	})
@@ -59,115 +152,182 @@ func NewEmailTestClient(t *testing.T) *EmailTestClient {
 	return &EmailTestClient{
 		Client: client,
 		t:      t,
+		ctx:    ctx,
+		inbox:  inbox,
 	}
 }
 
-// WaitForEmails waits for expected number of emails to arrive
+// Inbox returns the testing-framework independent core of the client
+func (c *EmailTestClient) Inbox() *Inbox {
+	return c.inbox
+}
+
+// Context returns a context that ends shortly before the test deadline
+func (c *EmailTestClient) Context() context.Context {
+	return c.ctx
+}
+
+// WaitForEmails waits for expected number of emails to arrive. A
+// non-positive timeout uses the default wait timeout.
 func (c *EmailTestClient) WaitForEmails(count int, timeout time.Duration) []sendria.Message {
 	c.t.Helper()
 
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		messages, err := c.ListMessages(1, count+10) // Get a few extra in case
-		if err != nil {
-			c.t.Fatalf("Failed to list messages: %v", err)
-		}
+	messages, err := c.inbox.waitForEmails(c.ctx, count, timeout)
+	if err != nil {
+		c.t.Fatalf("%v", err)
+	}
+	return messages
+}
 
-		if len(messages.Messages) >= count {
-			return messages.Messages[:count]
-		}
+// AssertEmailSent verifies an email was sent to recipient with subject
+func (c *EmailTestClient) AssertEmailSent(to, subject string) *sendria.Message {
+	c.t.Helper()
 
-		time.Sleep(50 * time.Millisecond)
+	msg, err := c.inbox.WaitForContext(c.ctx, To(to), Subject(subject))
+	if err != nil {
+		c.t.Fatalf("%v", err)
 	}
+	return msg
+}
 
-	// Timeout - show what we have
-	messages, _ := c.ListMessages(1, 100)
-	c.t.Fatalf("Timeout waiting for %d emails, got %d", count, len(messages.Messages))
-	return nil
+// AssertEmailContent verifies email contains expected text
+func (c *EmailTestClient) AssertEmailContent(msg *sendria.Message, expectedTexts ...string) {
+	c.t.Helper()
+
+	if err := c.inbox.CheckContent(msg, expectedTexts...); err != nil {
+		c.t.Errorf("%v", err)
+	}
 }
 
-// AssertEmailSent verifies an email was sent to recipient with subject
-func (c *EmailTestClient) AssertEmailSent(to, subject string) *sendria.Message {
+// AssertDeliveryReport verifies the email is a delivery status notification
+// and returns its parsed report
+func (c *EmailTestClient) AssertDeliveryReport(msg *sendria.Message) *sendria.DeliveryReport {
 	c.t.Helper()
 
-	// Wait for the specific email to appear, checking periodically
-	deadline := time.Now().Add(3 * time.Second)
-	for time.Now().Before(deadline) {
-		messages, err := c.ListMessages(1, 10)
-		if err != nil {
-			c.t.Fatalf("Failed to list messages: %v", err)
-		}
-		
-		for _, msg := range messages.Messages {
-			// Check if this message matches
-			recipientMatch := false
-			for _, recipient := range msg.To {
-				if recipient.Email == to {
-					recipientMatch = true
-					break
-				}
-			}
-			
-			if recipientMatch && msg.Subject == subject {
-				return &msg
-			}
-		}
-		
-		time.Sleep(100 * time.Millisecond)
+	report, err := msg.DeliveryReport()
+	if err != nil {
+		c.t.Fatalf("message %s: %v", msg.ID, err)
 	}
+	return report
+}
+
+// AssertCalendarInvite verifies the email carries an iCalendar invite and
+// returns it
+func (c *EmailTestClient) AssertCalendarInvite(msg *sendria.Message) *sendria.CalendarInvite {
+	c.t.Helper()
 
-	// Not found - show what we have
-	messages, _ := c.ListMessages(1, 100)
-	c.t.Errorf("No email found with recipient=%s and subject=%s", to, subject)
-	c.t.Logf("Available messages:")
-	for _, msg := range messages.Messages {
-		c.t.Logf("  - To: %v, Subject: %s", msg.To, msg.Subject)
+	invite, err := msg.CalendarInvite()
+	if err != nil {
+		c.t.Fatalf("message %s: %v", msg.ID, err)
 	}
-	c.t.FailNow()
-	return nil
+	return invite
 }
 
-// AssertEmailContent verifies email contains expected text
-func (c *EmailTestClient) AssertEmailContent(msg *sendria.Message, expectedTexts ...string) {
+// AssertInlineImagesResolved verifies every cid: reference of the HTML body
+// resolves to a part and every inline part is referenced, and returns the
+// resolution
+func (c *EmailTestClient) AssertInlineImagesResolved(msg *sendria.Message) *sendria.CIDResolution {
 	c.t.Helper()
 
-	body, err := c.GetMessagePlain(msg.ID)
+	r, err := msg.ResolveCIDs()
 	if err != nil {
-		c.t.Fatalf("Failed to get message content: %v", err)
+		c.t.Fatalf("message %s: %v", msg.ID, err)
+	}
+	for _, problem := range cidProblems(r) {
+		c.t.Errorf("message %s: %s", msg.ID, problem)
 	}
+	return r
+}
 
-	for _, text := range expectedTexts {
-		if !strings.Contains(body, text) {
-			c.t.Errorf("Email missing expected text: %q", text)
-			c.t.Logf("Email body:\n%s", body)
-		}
+// AssertConsistentAlternatives verifies the text/plain body has all links of
+// the HTML body and diverges from its text by at most maxDivergence, and
+// returns the report. A non-positive maxDivergence uses the default.
+func (c *EmailTestClient) AssertConsistentAlternatives(msg *sendria.Message, maxDivergence float64) *sendria.ConsistencyReport {
+	c.t.Helper()
+
+	report, err := msg.CheckAlternatives(maxDivergence)
+	if err != nil {
+		c.t.Fatalf("message %s: %v", msg.ID, err)
+	}
+	if !report.Consistent() {
+		c.t.Errorf("message %s: plain text and html differ: %s", msg.ID, describeConsistency(report))
 	}
+	return report
 }
 
-// AssertNoEmailsSent verifies no emails were sent
-func (c *EmailTestClient) AssertNoEmailsSent(waitTime time.Duration) {
+// AssertLintClean verifies the lint rules find no problems of warning or
+// error severity in the message, and returns all findings, including those
+// of info severity
+func (c *EmailTestClient) AssertLintClean(msg *sendria.Message, opts ...lint.Option) lint.Findings {
 	c.t.Helper()
 
-	time.Sleep(waitTime)
-	
-	messages, err := c.ListMessages(1, 10)
+	findings, err := lint.Lint(msg, opts...)
 	if err != nil {
-		c.t.Fatalf("Failed to list messages: %v", err)
+		c.t.Fatalf("message %s: %v", msg.ID, err)
+	}
+	for _, f := range findings.AtLeast(lint.SeverityWarning) {
+		c.t.Errorf("message %s: %s", msg.ID, f)
 	}
+	return findings
+}
 
-	if len(messages.Messages) > 0 {
-		c.t.Errorf("Expected no emails, but found %d", len(messages.Messages))
-		for _, msg := range messages.Messages {
-			c.t.Logf("  - To: %v, Subject: %s", msg.To, msg.Subject)
+// AssertSignatureVerified verifies the email is signed with S/MIME or PGP,
+// decrypted if it is encrypted, and every signature is valid and trusted. It
+// returns the security of the email, whose Cleartext is the signed message.
+func (c *EmailTestClient) AssertSignatureVerified(msg *sendria.Message) *sendria.Security {
+	c.t.Helper()
+
+	if err := msg.LoadParts(); err != nil {
+		c.t.Fatalf("message %s: %v", msg.ID, err)
+	}
+	sec := msg.Security
+	switch {
+	case sec == nil:
+		c.t.Fatalf("message %s: not signed", msg.ID)
+	case sec.Encrypted && !sec.Decrypted:
+		c.t.Fatalf("message %s: cannot decrypt the %s message: %v", msg.ID, sec.Protocol, sec.DecryptError)
+	case !sec.Signed:
+		c.t.Fatalf("message %s: encrypted, but not signed", msg.ID)
+	}
+	for _, sig := range sec.Signatures {
+		if sig.Err != nil {
+			signer := sig.Signer
+			if signer == "" {
+				signer = "key " + sig.KeyID
+			}
+			c.t.Errorf("message %s: %s signature by %s: %v", msg.ID, sig.Protocol, signer, sig.Err)
 		}
 	}
+	return sec
+}
+
+// AssertNoEmailsSent verifies no emails were sent until the inbox has been
+// quiet for waitTime after the last observed activity
+func (c *EmailTestClient) AssertNoEmailsSent(waitTime time.Duration) {
+	c.t.Helper()
+
+	if err := c.inbox.CheckNoEmailsContext(c.ctx, waitTime); err != nil {
+		c.t.Errorf("%v", err)
+	}
+}
+
+// WaitForQuiescence waits until no new email has arrived for the quiet
+// period and returns the captured emails
+func (c *EmailTestClient) WaitForQuiescence(quiet time.Duration) []sendria.Message {
+	c.t.Helper()
+
+	messages, err := c.inbox.WaitForQuiescence(c.ctx, quiet)
+	if err != nil {
+		c.t.Fatalf("%v", err)
+	}
+	return messages
 }
 
 // GetLatestEmail returns the most recent email
 func (c *EmailTestClient) GetLatestEmail() *sendria.Message {
 	c.t.Helper()
 
-	messages := c.WaitForEmails(1, 2*time.Second)
+	messages := c.WaitForEmails(1, 0)
 	if len(messages) == 0 {
 		c.t.Fatal("No emails found")
 		return nil
@@ -193,7 +353,7 @@ func (c *EmailTestClient) ClearMessages() {
 		}
 		break
 	}
-	
+
 	// Small delay to allow connection to stabilize
 	time.Sleep(50 * time.Millisecond)
 }
@@ -202,78 +362,49 @@ func (c *EmailTestClient) ClearMessages() {
 func (c *EmailTestClient) CountEmails() int {
 	c.t.Helper()
 
-	messages, err := c.ListMessages(1, 100)
+	count, err := c.inbox.Count()
 	if err != nil {
 		c.t.Fatalf("Failed to count messages: %v", err)
 	}
 
-	return len(messages.Messages)
+	return count
 }
 
 // FindEmail searches for an email by recipient and/or subject
 func (c *EmailTestClient) FindEmail(to, subject string) *sendria.Message {
 	c.t.Helper()
 
-	messages, err := c.ListMessages(1, 100)
-	if err != nil {
-		c.t.Fatalf("Failed to list messages: %v", err)
+	var criteria []Criterion
+	// Match recipient if specified
+	if to != "" {
+		criteria = append(criteria, To(to))
+	}
+	// Match subject if specified
+	if subject != "" {
+		criteria = append(criteria, Subject(subject))
 	}
 
-	for _, msg := range messages.Messages {
-		// Match recipient if specified
-		if to != "" {
-			recipientMatch := false
-			for _, recipient := range msg.To {
-				if recipient.Email == to {
-					recipientMatch = true
-					break
-				}
-			}
-			if !recipientMatch {
-				continue
-			}
-		}
-
-		// Match subject if specified
-		if subject != "" && msg.Subject != subject {
-			continue
+	msg, err := c.inbox.Find(criteria...)
+	if err != nil {
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			return nil
 		}
-
-		return &msg
+		c.t.Fatalf("Failed to list messages: %v", err)
 	}
 
-	return nil
+	return msg
 }
 
 // ExtractLink extracts a URL matching the pattern from email body
 func (c *EmailTestClient) ExtractLink(msg *sendria.Message, urlPattern string) string {
 	c.t.Helper()
 
-	body, err := c.GetMessagePlain(msg.ID)
+	link, err := c.inbox.ExtractLink(msg, urlPattern)
 	if err != nil {
-		c.t.Fatalf("Failed to get message content: %v", err)
-	}
-
-	// Find URLs in the body
-	lines := strings.Split(body, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, urlPattern) {
-			// Extract the URL (simple approach - you might need regex for complex cases)
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "http") {
-				// Find where URL ends (space or newline)
-				endIdx := strings.IndexAny(line, " \t\r\n")
-				if endIdx == -1 {
-					return line
-				}
-				return line[:endIdx]
-			}
-		}
+		c.t.Errorf("%v", err)
 	}
-
-	c.t.Errorf("No link found matching pattern: %s", urlPattern)
-	c.t.Logf("Email body:\n%s", body)
-	return ""
+	return link
 }
 
 // DebugPrintEmail prints email details for debugging
@@ -286,15 +417,15 @@ func (c *EmailTestClient) DebugPrintEmail(msg *sendria.Message) {
 	c.t.Logf("To: %v", msg.To)
 	c.t.Logf("Subject: %s", msg.Subject)
 	c.t.Logf("Created: %s", msg.CreatedAt)
-	
+
 	if body, err := c.GetMessagePlain(msg.ID); err == nil {
 		c.t.Logf("Plain Body:\n%s", body)
 	}
-	
+
 	if html, err := c.GetMessageHTML(msg.ID); err == nil && html != "" {
 		c.t.Logf("HTML Body:\n%s", html)
 	}
-	
+
 	c.t.Logf("==================")
 }
 
@@ -319,4 +450,4 @@ func CreateTestEmail(testName string) (subject, body string) {
 	body = fmt.Sprintf("This is a test email for %s\nTimestamp: %d\nTest ID: %s",
 		testName, timestamp, fmt.Sprintf("%s-%d", testName, timestamp))
 	return subject, body
-}
\ No newline at end of file
+}
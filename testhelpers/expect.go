@@ -0,0 +1,142 @@
+package testhelpers
+
+import (
+	"time"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// Expectation describes an email that is expected to arrive. It is built with
+// chainable criteria and resolved with Within.
+type Expectation struct {
+	c        *EmailTestClient
+	criteria []Criterion
+}
+
+// Expect starts a new expectation for an email
+func (c *EmailTestClient) Expect() *Expectation {
+	return &Expectation{c: c}
+}
+
+// ExpectCorrelated starts an expectation for an email caused by the request
+// with the given correlation or trace ID. Emails of other requests are
+// ignored, so it works on an inbox shared by many services.
+func (c *EmailTestClient) ExpectCorrelated(id string) *Expectation {
+	return c.Expect().Where(Correlated(id))
+}
+
+// ExpectBounceFor starts an expectation for a delivery status notification
+// reporting that delivery to the given recipient failed
+func (c *EmailTestClient) ExpectBounceFor(recipient string) *Expectation {
+	return c.Expect().Where(BounceFor(recipient))
+}
+
+// ExpectInviteFor starts an expectation for a calendar invite to the attendee
+// for an event starting at start. A zero start matches any time.
+func (c *EmailTestClient) ExpectInviteFor(attendee string, start time.Time) *Expectation {
+	return c.Expect().Where(InviteFor(attendee, start))
+}
+
+// ExpectCancellationFor starts an expectation for a calendar cancellation
+// sent to the attendee for an event starting at start. A zero start matches
+// any time.
+func (c *EmailTestClient) ExpectCancellationFor(attendee string, start time.Time) *Expectation {
+	return c.Expect().Where(CancellationFor(attendee, start))
+}
+
+// Where adds arbitrary criteria to the expectation
+func (e *Expectation) Where(criteria ...Criterion) *Expectation {
+	e.criteria = append(e.criteria, criteria...)
+	return e
+}
+
+// To expects the email to be addressed to the given recipient
+func (e *Expectation) To(email string) *Expectation {
+	return e.Where(To(email))
+}
+
+// From expects the email to be sent by the given address
+func (e *Expectation) From(email string) *Expectation {
+	return e.Where(From(email))
+}
+
+// Subject expects the email subject to equal the given text
+func (e *Expectation) Subject(subject string) *Expectation {
+	return e.Where(Subject(subject))
+}
+
+// SubjectContains expects the email subject to contain the given text
+func (e *Expectation) SubjectContains(text string) *Expectation {
+	return e.Where(SubjectContains(text))
+}
+
+// BodyContains expects the plain text body to contain the given text
+func (e *Expectation) BodyContains(text string) *Expectation {
+	return e.Where(BodyContains(text))
+}
+
+// HTMLContains expects the HTML body to contain the given text
+func (e *Expectation) HTMLContains(text string) *Expectation {
+	return e.Where(HTMLContains(text))
+}
+
+// HTMLHasLink expects the HTML body to contain a link whose href contains the
+// given text
+func (e *Expectation) HTMLHasLink(text string) *Expectation {
+	return e.Where(HTMLHasLink(text))
+}
+
+// InlineImagesResolved expects every cid: reference of the HTML body to
+// resolve and every inline part to be referenced
+func (e *Expectation) InlineImagesResolved() *Expectation {
+	return e.Where(InlineImagesResolved())
+}
+
+// ConsistentAlternatives expects the text/plain body to have all links of
+// the HTML body and to diverge from its text by at most maxDivergence
+func (e *Expectation) ConsistentAlternatives(maxDivergence float64) *Expectation {
+	return e.Where(ConsistentAlternatives(maxDivergence))
+}
+
+// HasAttachment expects the email to carry an attachment with the given
+// filename. An empty contentType matches any content type.
+func (e *Expectation) HasAttachment(filename, contentType string) *Expectation {
+	return e.Where(HasAttachment(filename, contentType))
+}
+
+// HeaderEquals expects the given header to have exactly the given value
+func (e *Expectation) HeaderEquals(name, value string) *Expectation {
+	return e.Where(HeaderEquals(name, value))
+}
+
+// DeliveryStatus expects the email to be a delivery status notification
+// reporting the given enhanced status code, e.g. "5.1.1", for the recipient
+func (e *Expectation) DeliveryStatus(recipient, status string) *Expectation {
+	return e.Where(DeliveryStatus(recipient, status))
+}
+
+// CalendarUID expects the email to be a calendar message for the event with
+// the given UID
+func (e *Expectation) CalendarUID(uid string) *Expectation {
+	return e.Where(CalendarUID(uid))
+}
+
+// Matching expects the email to satisfy a custom predicate
+func (e *Expectation) Matching(desc string, fn func(msg *sendria.Message) bool) *Expectation {
+	return e.Where(Matching(desc, fn))
+}
+
+// Within waits until an email matching all criteria arrives and returns it.
+// If none arrives before the timeout, the test fails with an explanation of
+// the closest non-matching messages. A non-positive timeout uses the default
+// wait timeout.
+func (e *Expectation) Within(timeout time.Duration) *sendria.Message {
+	e.c.t.Helper()
+
+	msg, err := e.c.inbox.waitFor(e.c.ctx, timeout, e.criteria)
+	if err != nil {
+		e.c.t.Fatalf("%v", err)
+		return nil
+	}
+	return msg
+}
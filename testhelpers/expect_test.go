@@ -0,0 +1,239 @@
+package testhelpers
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/lint"
+	"github.com/enthus-golang/sendria/models"
+)
+
+const invoiceEmail = "From: billing@example.com\r\n" +
+	"To: a@example.com\r\n" +
+	"Subject: Welcome aboard\r\n" +
+	"X-Tenant: acme\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Hello</p><a href=\"https://example.com/verify?token=abc\">Verify</a>\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer--\r\n"
+
+func TestExpectWithin(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	fake.Add(t, testEmail("noreply@example.com", "b@example.com", "Welcome aboard", nil, "hi", "<p>hi</p>"))
+	fake.AddLater(t, 150*time.Millisecond, invoiceEmail)
+
+	msg := c.Expect().
+		To("a@example.com").
+		SubjectContains("Welcome").
+		HTMLHasLink("/verify").
+		HasAttachment("invoice.pdf", "application/pdf").
+		HeaderEquals("X-Tenant", "acme").
+		Within(5 * time.Second)
+
+	if msg.To[0].Email != "a@example.com" {
+		t.Errorf("expected message to a@example.com, got %v", msg.To)
+	}
+}
+
+func TestInboxFindExplainsMismatch(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	fake.Add(t, invoiceEmail)
+	fake.Add(t, testEmail("noreply@example.com", "c@example.com", "Other", nil, "hi", "<p>hi</p>"))
+
+	_, err := c.Inbox().Find(
+		To("a@example.com"),
+		HTMLHasLink("/reset"),
+		HeaderEquals("X-Tenant", "globex"),
+	)
+	var matchErr *MatchError
+	if !errors.As(err, &matchErr) {
+		t.Fatalf("expected *MatchError, got %v", err)
+	}
+
+	report := err.Error()
+	for _, want := range []string{
+		"No email matched expectation:",
+		`Subject "Welcome aboard" (1/3 criteria matched)`,
+		`- html has link containing "/reset"`,
+		`+ links ["https://example.com/verify?token=abc"]`,
+		`+ header X-Tenant: "acme"`,
+		`Subject "Other" (0/3 criteria matched)`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+	if strings.Index(report, "Welcome aboard") > strings.Index(report, `"Other"`) {
+		t.Errorf("expected closest message first:\n%s", report)
+	}
+}
+
+func TestExpectCorrelated(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	// Another service sends to the same recipient during the test
+	fake.Add(t, testEmail("billing@example.com", "a@example.com", "Your receipt",
+		map[string]string{"X-Correlation-ID": "req-other"}, "hi", "<p>hi</p>"))
+	fake.AddLater(t, 100*time.Millisecond, testEmail("noreply@example.com", "a@example.com", "Your receipt",
+		map[string]string{"X-Correlation-ID": "req-42"}, "hi", "<p>hi</p>"))
+
+	msg := c.ExpectCorrelated("req-42").To("a@example.com").Within(5 * time.Second)
+	if msg.From[0].Email != "noreply@example.com" {
+		t.Errorf("expected the correlated message, got one from %v", msg.From)
+	}
+}
+
+// bounce builds a delivery status notification for one recipient
+func bounce(recipient, action, status string) string {
+	return "From: MAILER-DAEMON@mx.example.com\r\nTo: app@example.com\r\nSubject: Undelivered Mail\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=B\r\n\r\n" +
+		"--B\r\nContent-Type: text/plain\r\n\r\nDelivery failed.\r\n" +
+		"--B\r\nContent-Type: message/delivery-status\r\n\r\nReporting-MTA: dns; mx.example.com\r\n\r\n" +
+		"Final-Recipient: rfc822; " + recipient + "\r\nAction: " + action + "\r\nStatus: " + status + "\r\n" +
+		"Diagnostic-Code: smtp; 550 User unknown\r\n" +
+		"--B\r\nContent-Type: text/rfc822-headers\r\n\r\nSubject: Welcome\r\nMessage-ID: <w-1@example.com>\r\n" +
+		"--B--\r\n"
+}
+
+func TestExpectBounceFor(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	fake.Add(t, testEmail("app@example.com", "nobody@example.org", "Welcome", nil, "hi", "<p>hi</p>"))
+	fake.Add(t, bounce("slow@example.org", "delayed", "4.4.1"))
+	fake.AddLater(t, 100*time.Millisecond, bounce("nobody@example.org", "failed", "5.1.1"))
+
+	msg := c.ExpectBounceFor("nobody@example.org").DeliveryStatus("nobody@example.org", "5.1.1").Within(5 * time.Second)
+	report := c.AssertDeliveryReport(msg)
+	if report.OriginalMessageID != "<w-1@example.com>" {
+		t.Errorf("unexpected original message %q", report.OriginalMessageID)
+	}
+
+	err := Check(msg, BounceFor("slow@example.org"))
+	if err == nil || !strings.Contains(err.Error(), `report for ["nobody@example.org"]`) {
+		t.Errorf("expected mismatch naming the reported recipients, got %v", err)
+	}
+}
+
+func invite(method, attendee, start string) string {
+	return "From: organizer@example.com\r\nTo: " + attendee + "\r\nSubject: Planning\r\n" +
+		"Content-Type: text/calendar; method=" + method + "\r\n\r\n" +
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:" + method + "\r\nBEGIN:VEVENT\r\nUID:plan-1\r\n" +
+		"ORGANIZER:mailto:organizer@example.com\r\nATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:" + attendee + "\r\n" +
+		"DTSTART:" + start + "\r\nDURATION:PT1H\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestExpectInviteFor(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	start := time.Date(2026, 4, 13, 8, 0, 0, 0, time.UTC)
+	fake.Add(t, invite("REQUEST", "jane@example.org", "20260414T080000Z"))
+	fake.AddLater(t, 100*time.Millisecond, invite("REQUEST", "jane@example.org", "20260413T080000Z"))
+	fake.AddLater(t, 100*time.Millisecond, invite("CANCEL", "bob@example.org", "20260413T080000Z"))
+
+	msg := c.ExpectInviteFor("jane@example.org", start).CalendarUID("plan-1").Within(5 * time.Second)
+	if got := c.AssertCalendarInvite(msg); !got.End.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected end %s", got.End)
+	}
+	c.ExpectCancellationFor("bob@example.org", start).Within(5 * time.Second)
+
+	err := Check(msg, CancellationFor("jane@example.org", time.Time{}))
+	if err == nil || !strings.Contains(err.Error(), `calendar REQUEST "plan-1" for ["jane@example.org"]`) {
+		t.Errorf("expected mismatch describing the invite, got %v", err)
+	}
+}
+
+func related(html string) string {
+	return "From: news@example.com\r\nTo: jane@example.org\r\nSubject: News\r\n" +
+		"Content-Type: multipart/related; boundary=rel\r\n\r\n" +
+		"--rel\r\nContent-Type: text/html\r\n\r\n" + html + "\r\n" +
+		"--rel\r\nContent-Type: image/png\r\nContent-ID: <logo@example.com>\r\n\r\nPNG\r\n--rel--\r\n"
+}
+
+func TestExpectInlineImagesResolved(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	fake.Add(t, related(`<img src="cid:missing@example.com">`))
+	fake.AddLater(t, 100*time.Millisecond, related(`<img src="cid:logo@example.com">`))
+
+	msg := c.Expect().To("jane@example.org").InlineImagesResolved().Within(5 * time.Second)
+	if r := c.AssertInlineImagesResolved(msg); len(r.References) != 1 {
+		t.Errorf("expected 1 reference, got %+v", r.References)
+	}
+
+	// Messages are returned newest first
+	err := Check(&c.WaitForEmails(2, 0)[1], InlineImagesResolved())
+	if err == nil || !strings.Contains(err.Error(), `broken reference "cid:missing@example.com"`) ||
+		!strings.Contains(err.Error(), "unreferenced inline part <logo@example.com>") {
+		t.Errorf("expected the broken reference and orphan to be described, got %v", err)
+	}
+}
+
+func TestAssertLintClean(t *testing.T) {
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t)
+
+	headers := map[string]string{"Date": "Mon, 02 Jan 2006 15:04:05 +0000", "Message-ID": "<1@example.com>"}
+	fake.Add(t, testEmail("noreply@example.com", "a@example.com", "Welcome", headers,
+		"Verify: https://example.com/verify", `<a href="https://example.com/verify">Verify</a>`))
+
+	msg := c.AssertEmailSent("a@example.com", "Welcome")
+	if findings := c.AssertLintClean(msg); len(findings) != 0 {
+		t.Errorf("expected no findings, got\n%s", findings)
+	}
+	if findings := c.AssertLintClean(msg, lint.AsBulk(), lint.Without(lint.RuleListUnsubscribe)); len(findings) != 0 {
+		t.Errorf("expected no findings, got\n%s", findings)
+	}
+}
+
+func TestAssertSignatureVerified(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile("../testdata/security/" + name)
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		return data
+	}
+	keyring, err := models.ReadPGPKeyring(read("pgp-bob-secret.asc"), "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := keyring.Add(read("pgp-public.asc"), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake := newFakeSendria(t)
+	c := NewEmailTestClient(t, WithClientOptions(sendria.WithSecurityKeys(&models.SecurityKeys{PGPKeyring: keyring})))
+	fake.Add(t, string(read("pgp-signed-encrypted.eml")))
+
+	msg := c.AssertEmailSent("bob@example.org", "Signed and encrypted statement")
+	sec := c.AssertSignatureVerified(msg)
+	if sec.Protocol != models.ProtocolPGP || !sec.Encrypted || sec.Signatures[0].Signer != "Carol <carol@example.com>" {
+		t.Errorf("unexpected security %+v", sec)
+	}
+	if err := Check(msg, BodyContains("Reference: STMT-42")); err != nil {
+		t.Errorf("expected criteria to match the cleartext, got %v", err)
+	}
+	c.AssertEmailContent(msg, "Your statement is ready.")
+}
@@ -0,0 +1,33 @@
+package testhelpers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria/internal/fakesendria"
+)
+
+// newFakeSendria starts a fake Sendria server and points SENDRIA_URL at it
+func newFakeSendria(t *testing.T) *fakesendria.Server {
+	t.Helper()
+
+	fake := fakesendria.New(t)
+	t.Setenv("SENDRIA_URL", fake.URL)
+	return fake
+}
+
+// testEmail builds a raw email source for tests
+func testEmail(from, to, subject string, headers map[string]string, plain, html string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", from, to, subject)
+	for k, v := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/alternative; boundary=\"b1\"\r\n\r\n")
+	fmt.Fprintf(&b, "--b1\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", plain)
+	fmt.Fprintf(&b, "--b1\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", html)
+	b.WriteString("--b1--\r\n")
+	return b.String()
+}
@@ -0,0 +1,146 @@
+// Package gomegamatchers provides Gomega matchers for emails captured by
+// Sendria. The matchers satisfy gomega's types.GomegaMatcher interface without
+// this module depending on Gomega:
+//
+//	Eventually(client).Should(HaveReceivedEmail(testhelpers.To("a@example.com")))
+//	Expect(msg).To(HaveSubject("Welcome"))
+package gomegamatchers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/testhelpers"
+)
+
+// Matcher mirrors gomega's types.GomegaMatcher
+type Matcher interface {
+	Match(actual interface{}) (success bool, err error)
+	FailureMessage(actual interface{}) (message string)
+	NegatedFailureMessage(actual interface{}) (message string)
+}
+
+// HaveReceivedEmail succeeds if the actual inbox holds an email satisfying all
+// criteria. The actual value may be a *sendria.Client, *testhelpers.Inbox or
+// *testhelpers.EmailTestClient. Use it with Eventually to wait for delivery.
+func HaveReceivedEmail(criteria ...testhelpers.Criterion) Matcher {
+	return &inboxMatcher{criteria: criteria}
+}
+
+// HaveSubject succeeds if the actual message has exactly the given subject
+func HaveSubject(subject string) Matcher {
+	return MatchEmail(testhelpers.Subject(subject))
+}
+
+// HaveRecipient succeeds if the actual message is addressed to the given
+// recipient
+func HaveRecipient(email string) Matcher {
+	return MatchEmail(testhelpers.To(email))
+}
+
+// HaveAttachment succeeds if the actual message carries an attachment with the
+// given filename. An empty contentType matches any content type.
+func HaveAttachment(filename, contentType string) Matcher {
+	return MatchEmail(testhelpers.HasAttachment(filename, contentType))
+}
+
+// MatchEmail succeeds if the actual message satisfies all criteria. The actual
+// value may be a sendria.Message or *sendria.Message.
+func MatchEmail(criteria ...testhelpers.Criterion) Matcher {
+	return &messageMatcher{criteria: criteria}
+}
+
+// inboxMatcher matches the captured messages of an inbox
+type inboxMatcher struct {
+	criteria []testhelpers.Criterion
+	failure  error
+	found    *sendria.Message
+}
+
+func (m *inboxMatcher) Match(actual interface{}) (bool, error) {
+	inbox, err := toInbox(actual)
+	if err != nil {
+		return false, err
+	}
+
+	m.found, m.failure = inbox.Find(m.criteria...)
+	if m.failure != nil {
+		var matchErr *testhelpers.MatchError
+		if !errors.As(m.failure, &matchErr) {
+			return false, m.failure
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func (m *inboxMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected inbox to have received an email\n%v", m.failure)
+}
+
+func (m *inboxMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected inbox not to have received an email matching %v\nFound ID %s, Subject %q",
+		m.criteria, m.found.ID, m.found.Subject)
+}
+
+// messageMatcher matches a single message
+type messageMatcher struct {
+	criteria []testhelpers.Criterion
+	failure  error
+}
+
+func (m *messageMatcher) Match(actual interface{}) (bool, error) {
+	msg, err := toMessage(actual)
+	if err != nil {
+		return false, err
+	}
+
+	m.failure = testhelpers.Check(msg, m.criteria...)
+	if m.failure != nil {
+		var matchErr *testhelpers.MatchError
+		if !errors.As(m.failure, &matchErr) {
+			return false, m.failure
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func (m *messageMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected message to match\n%v", m.failure)
+}
+
+func (m *messageMatcher) NegatedFailureMessage(actual interface{}) string {
+	msg, _ := toMessage(actual)
+	return fmt.Sprintf("Expected message ID %s, Subject %q not to match %v", msg.ID, msg.Subject, m.criteria)
+}
+
+// toInbox converts the supported actual values to an inbox
+func toInbox(actual interface{}) (*testhelpers.Inbox, error) {
+	switch v := actual.(type) {
+	case *testhelpers.Inbox:
+		return v, nil
+	case *testhelpers.EmailTestClient:
+		return v.Inbox(), nil
+	case *sendria.Client:
+		return testhelpers.NewInbox(v), nil
+	default:
+		return nil, fmt.Errorf("HaveReceivedEmail expects a *sendria.Client, *testhelpers.Inbox or *testhelpers.EmailTestClient, got %T", actual)
+	}
+}
+
+// toMessage converts the supported actual values to a message
+func toMessage(actual interface{}) (*sendria.Message, error) {
+	switch v := actual.(type) {
+	case *sendria.Message:
+		if v == nil {
+			return nil, errors.New("expected a message, got nil")
+		}
+		return v, nil
+	case sendria.Message:
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("expected a sendria.Message or *sendria.Message, got %T", actual)
+	}
+}
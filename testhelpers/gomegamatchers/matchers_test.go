@@ -0,0 +1,82 @@
+package gomegamatchers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/internal/fakesendria"
+	"github.com/enthus-golang/sendria/testhelpers"
+)
+
+func TestHaveReceivedEmail(t *testing.T) {
+	t.Parallel()
+
+	fake := fakesendria.New(t)
+	fake.Add(t, "Subject: Welcome\r\nTo: a@example.com\r\n\r\nHello")
+	client := sendria.NewClient(fake.URL)
+
+	m := HaveReceivedEmail(testhelpers.To("a@example.com"), testhelpers.SubjectContains("Welcome"))
+	ok, err := m.Match(client)
+	if err != nil || !ok {
+		t.Fatalf("expected match, got %v, %v", ok, err)
+	}
+	if msg := m.NegatedFailureMessage(client); !strings.Contains(msg, `"Welcome"`) {
+		t.Errorf("unexpected negated failure message: %s", msg)
+	}
+
+	m = HaveReceivedEmail(testhelpers.To("b@example.com"))
+	ok, err = m.Match(testhelpers.NewInbox(client))
+	if err != nil || ok {
+		t.Fatalf("expected no match, got %v, %v", ok, err)
+	}
+	if msg := m.FailureMessage(client); !strings.Contains(msg, `- to "b@example.com"`) {
+		t.Errorf("unexpected failure message: %s", msg)
+	}
+
+	if _, err := m.Match("not an inbox"); err == nil {
+		t.Error("expected error for unsupported actual value")
+	}
+}
+
+func TestMessageMatchers(t *testing.T) {
+	t.Parallel()
+
+	msg := sendria.Message{
+		ID:          "1",
+		Subject:     "Invoice",
+		To:          []sendria.Recipient{{Email: "a@example.com"}},
+		Source:      "Subject: Invoice\r\n\r\n",
+		Attachments: []sendria.Attachment{{Filename: "invoice.pdf", Type: "application/pdf"}},
+	}
+
+	tests := []struct {
+		name    string
+		matcher Matcher
+		actual  interface{}
+		want    bool
+	}{
+		{"subject", HaveSubject("Invoice"), msg, true},
+		{"subject pointer", HaveSubject("Invoice"), &msg, true},
+		{"wrong subject", HaveSubject("Other"), msg, false},
+		{"recipient", HaveRecipient("a@example.com"), msg, true},
+		{"attachment", HaveAttachment("invoice.pdf", "application/pdf"), msg, true},
+		{"attachment any type", HaveAttachment("invoice.pdf", ""), msg, true},
+		{"wrong attachment type", HaveAttachment("invoice.pdf", "text/plain"), msg, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt // capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ok, err := tt.matcher.Match(tt.actual)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.want {
+				t.Errorf("expected %v, got %v: %s", tt.want, ok, tt.matcher.FailureMessage(tt.actual))
+			}
+		})
+	}
+}
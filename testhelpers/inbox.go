@@ -0,0 +1,353 @@
+package testhelpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/models"
+)
+
+// Inbox is the testing-framework independent core of the helpers in this
+// package. Instead of failing a test, every check returns an error that
+// explains the failure, so it can back testing.T helpers as well as testify
+// or Gomega style assertions.
+//
+// Waits are driven by a context and a Clock. They wake up on Sendria push
+// events when the server supports them and otherwise poll with adaptive
+// backoff.
+type Inbox struct {
+	client   *sendria.Client
+	clock    Clock
+	timeout  time.Duration
+	minPoll  time.Duration
+	maxPoll  time.Duration
+	notifier Notifier
+	logger   *slog.Logger
+
+	pushUnavailable atomic.Bool
+}
+
+// NewInbox creates an Inbox on top of a Sendria client. The default wait
+// timeout is taken from SENDRIA_WAIT_TIMEOUT if set. Retries and push
+// fallbacks are logged through the logger of the client.
+func NewInbox(client *sendria.Client, opts ...InboxOption) *Inbox {
+	i := &Inbox{
+		client:   client,
+		clock:    systemClock{},
+		timeout:  DefaultWaitTimeout,
+		minPoll:  DefaultMinPollInterval,
+		maxPoll:  DefaultMaxPollInterval,
+		notifier: client,
+		logger:   client.Logger(),
+	}
+	if timeout, ok := envWaitTimeout(); ok {
+		i.timeout = timeout
+	}
+
+	// Apply all options
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Client returns the underlying Sendria client
+func (i *Inbox) Client() *sendria.Client {
+	return i.client
+}
+
+// Timeout returns the timeout of waits that do not specify one
+func (i *Inbox) Timeout() time.Duration {
+	return i.timeout
+}
+
+// Messages returns the currently captured messages, newest first
+func (i *Inbox) Messages() ([]sendria.Message, error) {
+	return i.MessagesContext(context.Background())
+}
+
+// MessagesContext returns the currently captured messages using the given
+// context
+func (i *Inbox) MessagesContext(ctx context.Context) ([]sendria.Message, error) {
+	messages, err := i.client.ListMessagesContext(ctx, 1, 100)
+	if err != nil {
+		return nil, fmt.Errorf("listing messages: %w", err)
+	}
+	return messages.Messages, nil
+}
+
+// Count returns the current number of emails
+func (i *Inbox) Count() (int, error) {
+	messages, err := i.client.ListMessages(1, 100, sendria.WithoutSources(), sendria.WithExactTotal())
+	if err != nil {
+		return 0, fmt.Errorf("listing messages: %w", err)
+	}
+	return messages.Total, nil
+}
+
+// WaitForEmails waits for the expected number of emails to arrive. A
+// non-positive timeout uses the default wait timeout.
+func (i *Inbox) WaitForEmails(count int, timeout time.Duration) ([]sendria.Message, error) {
+	return i.waitForEmails(context.Background(), count, timeout)
+}
+
+// WaitForEmailsContext waits for the expected number of emails to arrive
+// until the context ends or the default timeout elapses
+func (i *Inbox) WaitForEmailsContext(ctx context.Context, count int) ([]sendria.Message, error) {
+	return i.waitForEmails(ctx, count, 0)
+}
+
+func (i *Inbox) waitForEmails(ctx context.Context, count int, timeout time.Duration) ([]sendria.Message, error) {
+	var result []sendria.Message
+	got := 0
+	err := i.wait(ctx, i.deadline(timeout), 0, func(ctx context.Context, _ bool) (bool, error) {
+		messages, err := i.client.ListMessagesContext(ctx, 1, count+10) // Get a few extra in case
+		if err != nil {
+			return false, fmt.Errorf("listing messages: %w", err)
+		}
+
+		got = len(messages.Messages)
+		if got >= count {
+			result = messages.Messages[:count]
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, waitError(err, fmt.Sprintf("waiting for %d emails, got %d", count, got))
+	}
+	return result, nil
+}
+
+// Find returns the newest captured email satisfying all criteria. If none
+// does, the returned *MatchError explains the closest messages.
+func (i *Inbox) Find(criteria ...Criterion) (*sendria.Message, error) {
+	return i.find(context.Background(), make(map[string]*candidate), criteria)
+}
+
+// WaitFor waits until an email satisfying all criteria arrives. A
+// non-positive timeout uses the default wait timeout.
+func (i *Inbox) WaitFor(timeout time.Duration, criteria ...Criterion) (*sendria.Message, error) {
+	return i.waitFor(context.Background(), timeout, criteria)
+}
+
+// WaitForContext waits until an email satisfying all criteria arrives, the
+// context ends or the default timeout elapses
+func (i *Inbox) WaitForContext(ctx context.Context, criteria ...Criterion) (*sendria.Message, error) {
+	return i.waitFor(ctx, 0, criteria)
+}
+
+func (i *Inbox) waitFor(ctx context.Context, timeout time.Duration, criteria []Criterion) (*sendria.Message, error) {
+	if timeout <= 0 {
+		timeout = i.timeout
+	}
+
+	candidates := make(map[string]*candidate)
+	var found *sendria.Message
+	var matchErr *MatchError
+	err := i.wait(ctx, i.deadline(timeout), 0, func(ctx context.Context, _ bool) (bool, error) {
+		msg, err := i.find(ctx, candidates, criteria)
+		if errors.As(err, &matchErr) {
+			return false, nil
+		}
+		found = msg
+		return err == nil, err
+	})
+	if err != nil {
+		if matchErr != nil && (err == errWaitTimeout || ctx.Err() != nil) {
+			matchErr.waited = timeout.String()
+			return nil, matchErr
+		}
+		return nil, err
+	}
+	return found, nil
+}
+
+// find evaluates the captured messages, reusing already loaded candidates
+func (i *Inbox) find(ctx context.Context, candidates map[string]*candidate, criteria []Criterion) (*sendria.Message, error) {
+	messages, err := i.MessagesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]result, 0, len(messages))
+	for _, msg := range messages {
+		cd, ok := candidates[msg.ID]
+		if !ok {
+			cd = &candidate{ctx: ctx, client: i.client, msg: msg}
+			candidates[msg.ID] = cd
+		}
+
+		r := evaluate(cd, criteria)
+		if r.matched == len(criteria) {
+			// Make sure the returned message is fully loaded
+			return cd.message()
+		}
+		results = append(results, r)
+	}
+
+	rank(results)
+	return nil, &MatchError{criteria: criteria, results: results}
+}
+
+// CheckContent verifies the plain text body of an email contains all texts
+func (i *Inbox) CheckContent(msg *sendria.Message, expectedTexts ...string) error {
+	body, err := i.plainBody(msg)
+	if err != nil {
+		return fmt.Errorf("getting message content: %w", err)
+	}
+	// HTML-only emails are checked against the text of their HTML body
+	if strings.TrimSpace(body) == "" {
+		if html, err := i.client.GetMessageHTML(msg.ID); err == nil {
+			body = models.HTMLToText(html)
+		}
+	}
+
+	var missing []string
+	for _, text := range expectedTexts {
+		if !strings.Contains(body, text) {
+			missing = append(missing, fmt.Sprintf("%q", text))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("email missing expected text: %s\nEmail body:\n%s", strings.Join(missing, ", "), body)
+	}
+	return nil
+}
+
+// plainBody returns the plain text body of an email as rendered by the
+// server, or the readable body of the cleartext of encrypted and opaque
+// signed emails, which the server cannot render
+func (i *Inbox) plainBody(msg *sendria.Message) (string, error) {
+	if msg.Cleartext() != msg {
+		return readableBody(msg), nil
+	}
+	return i.client.GetMessagePlain(msg.ID)
+}
+
+// CheckNoEmails verifies no emails are captured until the inbox has been
+// quiet for waitTime. Push events restart the quiet period; an arriving
+// email fails the check immediately.
+func (i *Inbox) CheckNoEmails(waitTime time.Duration) error {
+	return i.CheckNoEmailsContext(context.Background(), waitTime)
+}
+
+// CheckNoEmailsContext is CheckNoEmails using the given context
+func (i *Inbox) CheckNoEmailsContext(ctx context.Context, waitTime time.Duration) error {
+	var messages []sendria.Message
+	err := i.waitQuiet(ctx, waitTime, func(ctx context.Context) (bool, bool, error) {
+		var err error
+		messages, err = i.MessagesContext(ctx)
+		return len(messages) > 0, false, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(messages) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "expected no emails, but found %d", len(messages))
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "\n  - To: %v, Subject: %s", msg.To, msg.Subject)
+		}
+		return errors.New(b.String())
+	}
+	return nil
+}
+
+// WaitForQuiescence waits until no new email has arrived for the quiet
+// period after the last observed activity and returns the captured emails.
+// It gives up after the default timeout plus the quiet period.
+func (i *Inbox) WaitForQuiescence(ctx context.Context, quiet time.Duration) ([]sendria.Message, error) {
+	var messages []sendria.Message
+	fingerprint := ""
+	err := i.waitQuiet(ctx, quiet, func(ctx context.Context) (bool, bool, error) {
+		var err error
+		messages, err = i.MessagesContext(ctx)
+		if err != nil {
+			return false, false, err
+		}
+
+		current := strconv.Itoa(len(messages))
+		if len(messages) > 0 {
+			current += "/" + messages[0].ID
+		}
+		changed := fingerprint != "" && current != fingerprint
+		fingerprint = current
+		return false, changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// waitQuiet polls until nothing happened for the quiet period after the last
+// observed activity. Push events and activity reported by poll restart the
+// period; poll can end the wait early by reporting stop.
+func (i *Inbox) waitQuiet(ctx context.Context, quiet time.Duration, poll func(ctx context.Context) (stop, activity bool, err error)) error {
+	limit := i.timeout + quiet
+	lastActivity := i.clock.Now()
+	err := i.wait(ctx, lastActivity.Add(limit), quiet/4, func(ctx context.Context, pushed bool) (bool, error) {
+		stop, activity, err := poll(ctx)
+		if err != nil || stop {
+			return true, err
+		}
+
+		now := i.clock.Now()
+		if pushed || activity {
+			lastActivity = now
+		}
+		return now.Sub(lastActivity) >= quiet, nil
+	})
+	if err != nil {
+		return waitError(err, fmt.Sprintf("waiting %s for the inbox to become quiet", quiet))
+	}
+	return nil
+}
+
+// waitError describes why a wait ended without success
+func waitError(err error, what string) error {
+	if err == errWaitTimeout {
+		return fmt.Errorf("timeout %s", what)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return err
+}
+
+// ExtractLink extracts a URL matching the pattern from the plain text body
+func (i *Inbox) ExtractLink(msg *sendria.Message, urlPattern string) (string, error) {
+	body, err := i.plainBody(msg)
+	if err != nil {
+		return "", fmt.Errorf("getting message content: %w", err)
+	}
+
+	// Find URLs in the body
+	lines := strings.Split(body, "\n")
+	for _, line := range lines {
+		if strings.Contains(line, urlPattern) {
+			// Extract the URL (simple approach - you might need regex for complex cases)
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "http") {
+				// Find where URL ends (space or newline)
+				endIdx := strings.IndexAny(line, " \t\r\n")
+				if endIdx == -1 {
+					return line, nil
+				}
+				return line[:endIdx], nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no link found matching pattern: %s\nEmail body:\n%s", urlPattern, body)
+}
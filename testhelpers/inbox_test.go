@@ -0,0 +1,90 @@
+package testhelpers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+)
+
+func TestInboxChecks(t *testing.T) {
+	fake := newFakeSendria(t)
+	inbox := NewInbox(sendria.NewClient(fake.URL))
+
+	if err := inbox.CheckNoEmails(0); err != nil {
+		t.Errorf("expected empty inbox, got %v", err)
+	}
+
+	fake.Add(t, testEmail("noreply@example.com", "a@example.com", "Reset", nil,
+		"Reset here:\nhttps://example.com/reset?token=xyz\n", "<p>Reset</p>"))
+
+	msg, err := inbox.WaitFor(time.Second, To("a@example.com"), Subject("Reset"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := inbox.CheckContent(msg, "Reset here", "token=xyz"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := inbox.CheckContent(msg, "missing text"); err == nil || !strings.Contains(err.Error(), `"missing text"`) {
+		t.Errorf("expected missing text error, got %v", err)
+	}
+
+	link, err := inbox.ExtractLink(msg, "/reset")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if link != "https://example.com/reset?token=xyz" {
+		t.Errorf("unexpected link %q", link)
+	}
+
+	if err := inbox.CheckNoEmails(0); err == nil {
+		t.Error("expected error for non-empty inbox")
+	}
+	if _, err := inbox.WaitFor(200*time.Millisecond, Subject("Nope")); err == nil ||
+		!strings.Contains(err.Error(), "within 200ms") {
+		t.Errorf("expected timeout explanation, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	msg := &sendria.Message{
+		ID:      "1",
+		Subject: "Hello",
+		To:      []sendria.Recipient{{Email: "a@example.com"}},
+	}
+
+	if err := Check(msg, To("A@example.com"), Subject("Hello")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Check(msg, HeaderEquals("X-Tenant", "acme")); err == nil || !strings.Contains(err.Error(), "no source loaded") {
+		t.Errorf("expected missing source error, got %v", err)
+	}
+}
+
+func TestInboxHTMLOnlyContent(t *testing.T) {
+	fake := newFakeSendria(t)
+	inbox := NewInbox(sendria.NewClient(fake.URL))
+
+	html := `<h1>Reset</h1><p>Click <a href="https://example.com/reset?token=xyz">here</a></p>`
+	fake.Add(t, testEmail("noreply@example.com", "a@example.com", "HTML only", nil, "", html))
+	fake.Add(t, testEmail("noreply@example.com", "b@example.com", "Both", nil, "Reset\n\nClick here", html))
+
+	msg, err := inbox.WaitFor(time.Second, To("a@example.com"), BodyContains("Click here [https://example.com/reset?token=xyz]"))
+	if err != nil {
+		t.Fatalf("expected the body to be rendered from the HTML, got %v", err)
+	}
+	if err := inbox.CheckContent(msg, "Reset", "here [https://example.com/reset"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	both, err := inbox.Find(To("b@example.com"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = Check(both, ConsistentAlternatives(0))
+	if err == nil || !strings.Contains(err.Error(), `plain text lacks links ["https://example.com/reset?token=xyz"]`) {
+		t.Errorf("expected the missing link to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package testhelpers
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestLogger returns a logger that writes to t.Log, so its records are only
+// shown when the test fails or runs with -v. Records emitted after the test
+// has finished, e.g. by background goroutines, are dropped.
+func TestLogger(t testing.TB) *slog.Logger {
+	w := &testLogWriter{t: t}
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.done = true
+	})
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// testLogWriter forwards each record written by a slog.TextHandler to t.Log
+type testLogWriter struct {
+	t    testing.TB
+	mu   sync.Mutex
+	done bool
+}
+
+func (w *testLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.done {
+		w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
+	return len(p), nil
+}
@@ -0,0 +1,37 @@
+package testhelpers
+
+import (
+	"strings"
+	"testing"
+)
+
+// recordingTB captures t.Log output and cleanups
+type recordingTB struct {
+	testing.TB
+	logs     []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Log(args ...interface{}) { r.logs = append(r.logs, args[0].(string)) }
+func (r *recordingTB) Cleanup(f func())        { r.cleanups = append(r.cleanups, f) }
+
+func TestTestLogger(t *testing.T) {
+	rec := &recordingTB{TB: t}
+	logger := TestLogger(rec)
+
+	logger.Debug("sendria request", "path", "/api/messages/")
+	if len(rec.logs) != 1 || !strings.Contains(rec.logs[0], "path=/api/messages/") {
+		t.Fatalf("expected the record in t.Log, got %q", rec.logs)
+	}
+	if strings.HasSuffix(rec.logs[0], "\n") {
+		t.Error("expected the trailing newline to be trimmed")
+	}
+
+	for _, f := range rec.cleanups {
+		f()
+	}
+	logger.Warn("late record")
+	if len(rec.logs) != 1 {
+		t.Errorf("expected records after the test to be dropped, got %q", rec.logs)
+	}
+}
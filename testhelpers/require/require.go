@@ -0,0 +1,128 @@
+// Package require provides the assertions of package assert, but stops the
+// test with FailNow when an assertion fails.
+package require
+
+import (
+	"time"
+
+	"github.com/enthus-golang/sendria"
+	"github.com/enthus-golang/sendria/testhelpers"
+	"github.com/enthus-golang/sendria/testhelpers/assert"
+)
+
+// TestingT is the subset of testing.TB used by the assertions. It is
+// compatible with testify's require.TestingT.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+type tHelper interface {
+	Helper()
+}
+
+// EmailSent requires that an email to the recipient with the subject arrives
+// within the default wait timeout of testhelpers.Inbox
+func EmailSent(t TestingT, client *sendria.Client, to, subject string, msgAndArgs ...interface{}) *sendria.Message {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	msg := assert.EmailSent(t, client, to, subject, msgAndArgs...)
+	if msg == nil {
+		t.FailNow()
+	}
+	return msg
+}
+
+// EmailReceivedWithin requires that an email satisfying all criteria arrives
+// within the timeout
+func EmailReceivedWithin(t TestingT, client *sendria.Client, timeout time.Duration, criteria []testhelpers.Criterion, msgAndArgs ...interface{}) *sendria.Message {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	msg := assert.EmailReceivedWithin(t, client, timeout, criteria, msgAndArgs...)
+	if msg == nil {
+		t.FailNow()
+	}
+	return msg
+}
+
+// EmailContains requires that the plain text body of the message contains text
+func EmailContains(t TestingT, client *sendria.Client, msg *sendria.Message, text string, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.EmailContains(t, client, msg, text, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// NoEmailsSent requires that no emails are captured after waiting for waitTime
+func NoEmailsSent(t TestingT, client *sendria.Client, waitTime time.Duration, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.NoEmailsSent(t, client, waitTime, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// EmailCount requires the number of captured emails
+func EmailCount(t TestingT, client *sendria.Client, expected int, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.EmailCount(t, client, expected, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// Subject requires the subject of the message
+func Subject(t TestingT, msg *sendria.Message, expected string, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.Subject(t, msg, expected, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// HasAttachment requires that the message carries an attachment with the
+// given filename. An empty contentType matches any content type.
+func HasAttachment(t TestingT, msg *sendria.Message, filename, contentType string, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.HasAttachment(t, msg, filename, contentType, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// MessageMatches requires that the message satisfies all criteria
+func MessageMatches(t TestingT, msg *sendria.Message, criteria []testhelpers.Criterion, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.MessageMatches(t, msg, criteria, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+// NoError requires that err is nil
+func NoError(t TestingT, err error, msgAndArgs ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if !assert.NoError(t, err, msgAndArgs...) {
+		t.FailNow()
+	}
+}
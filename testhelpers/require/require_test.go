@@ -0,0 +1,99 @@
+package require
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// recorder captures assertion failures and stops the goroutine on FailNow,
+// as testing.T does
+type recorder struct {
+	errors []string
+	failed bool
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) FailNow() {
+	r.failed = true
+	runtime.Goexit()
+}
+
+// run calls the assertion in its own goroutine and reports whether it
+// returned to the caller
+func run(rec *recorder, assertion func(TestingT)) (returned bool) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assertion(rec)
+		returned = true
+	}()
+	<-done
+	return returned
+}
+
+func TestRequireStopsTest(t *testing.T) {
+	t.Parallel()
+
+	msg := &sendria.Message{
+		ID:          "1",
+		Subject:     "Invoice",
+		Attachments: []sendria.Attachment{{Filename: "invoice.pdf", Type: "application/pdf"}},
+	}
+
+	tests := []struct {
+		name      string
+		assertion func(TestingT)
+		wantStop  bool
+	}{
+		{
+			name:      "passing subject",
+			assertion: func(t TestingT) { Subject(t, msg, "Invoice") },
+		},
+		{
+			name:      "failing subject",
+			assertion: func(t TestingT) { Subject(t, msg, "Other") },
+			wantStop:  true,
+		},
+		{
+			name:      "passing attachment",
+			assertion: func(t TestingT) { HasAttachment(t, msg, "invoice.pdf", "") },
+		},
+		{
+			name:      "failing attachment",
+			assertion: func(t TestingT) { HasAttachment(t, msg, "report.csv", "") },
+			wantStop:  true,
+		},
+		{
+			name:      "nil error",
+			assertion: func(t TestingT) { NoError(t, nil) },
+		},
+		{
+			name:      "error",
+			assertion: func(t TestingT) { NoError(t, errors.New("boom"), "sending welcome") },
+			wantStop:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := &recorder{}
+			returned := run(rec, tt.assertion)
+			if returned == tt.wantStop || rec.failed != tt.wantStop {
+				t.Errorf("expected stop %t, got returned %t, failed %t", tt.wantStop, returned, rec.failed)
+			}
+			if tt.wantStop && len(rec.errors) != 1 {
+				t.Errorf("expected 1 failure before stopping, got %q", rec.errors)
+			}
+		})
+	}
+}
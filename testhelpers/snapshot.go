@@ -0,0 +1,312 @@
+package testhelpers
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// UpdateSnapshotsEnv is the environment variable that makes MatchSnapshot
+// rewrite golden files instead of comparing against them when set to 1
+const UpdateSnapshotsEnv = "SENDRIA_UPDATE_SNAPSHOTS"
+
+// Redaction masks volatile values in a snapshot
+type Redaction struct {
+	// Pattern selects the text to mask
+	Pattern *regexp.Regexp
+	// Replacement is the replacement text and may reference submatches
+	Replacement string
+}
+
+// DefaultRedactions mask values that change on every send: boundaries,
+// tokens, timestamps like the ones CreateTestEmail generates, and UUIDs
+var DefaultRedactions = []Redaction{
+	{regexp.MustCompile(`boundary="?[^";\s]+"?`), `boundary="<boundary>"`},
+	{regexp.MustCompile(`(?i)\b(token|code|signature|sig)=[A-Za-z0-9._~%-]+`), `$1=<token>`},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), `<timestamp>`},
+	{regexp.MustCompile(`\b1\d{9}\b`), `<timestamp>`},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), `<uuid>`},
+}
+
+// DefaultRedactedHeaders are replaced entirely in snapshots
+var DefaultRedactedHeaders = []string{"Date", "Message-Id", "Received"}
+
+// snapshotConfig holds the options of a snapshot
+type snapshotConfig struct {
+	name        string
+	dir         string
+	redactions  []Redaction
+	headers     map[string]bool
+	skipHeaders map[string]bool
+}
+
+// SnapshotOption configures MatchSnapshot and RenderSnapshot
+type SnapshotOption func(*snapshotConfig)
+
+// SnapshotName sets the golden file name. It defaults to the test name.
+func SnapshotName(name string) SnapshotOption {
+	return func(c *snapshotConfig) {
+		c.name = name
+	}
+}
+
+// SnapshotDir sets the directory of the golden files. It defaults to testdata.
+func SnapshotDir(dir string) SnapshotOption {
+	return func(c *snapshotConfig) {
+		c.dir = dir
+	}
+}
+
+// RedactPattern masks every match of the regular expression
+func RedactPattern(pattern, replacement string) SnapshotOption {
+	re := regexp.MustCompile(pattern)
+	return func(c *snapshotConfig) {
+		c.redactions = append(c.redactions, Redaction{Pattern: re, Replacement: replacement})
+	}
+}
+
+// RedactHeaders replaces the values of the given headers
+func RedactHeaders(names ...string) SnapshotOption {
+	return func(c *snapshotConfig) {
+		for _, name := range names {
+			c.headers[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// SkipHeaders leaves the given headers out of the snapshot
+func SkipHeaders(names ...string) SnapshotOption {
+	return func(c *snapshotConfig) {
+		for _, name := range names {
+			c.skipHeaders[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// WithoutDefaultRedactions disables DefaultRedactions and
+// DefaultRedactedHeaders. Options applied before it are discarded.
+func WithoutDefaultRedactions() SnapshotOption {
+	return func(c *snapshotConfig) {
+		c.redactions = nil
+		c.headers = make(map[string]bool)
+	}
+}
+
+func newSnapshotConfig(opts []SnapshotOption) *snapshotConfig {
+	c := &snapshotConfig{
+		dir:         "testdata",
+		redactions:  append([]Redaction(nil), DefaultRedactions...),
+		headers:     make(map[string]bool),
+		skipHeaders: make(map[string]bool),
+	}
+	for _, name := range DefaultRedactedHeaders {
+		c.headers[strings.ToLower(name)] = true
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// MatchSnapshot compares a normalized view of the message with the golden
+// file testdata/<TestName>.golden. Run the tests with
+// SENDRIA_UPDATE_SNAPSHOTS=1, or with -update if the test binary defines that
+// flag, to rewrite the golden files. On mismatch the test fails with a
+// unified diff.
+func MatchSnapshot(t testing.TB, msg *sendria.Message, opts ...SnapshotOption) {
+	t.Helper()
+
+	cfg := newSnapshotConfig(opts)
+	actual, err := renderSnapshot(msg, cfg)
+	if err != nil {
+		t.Fatalf("Failed to render snapshot: %v", err)
+	}
+
+	name := cfg.name
+	if name == "" {
+		name = t.Name()
+	}
+	path := filepath.Join(cfg.dir, snapshotFileName(name))
+
+	if shouldUpdateSnapshots() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create snapshot directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Fatalf("Failed to write snapshot: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Snapshot %s does not exist, run the test with %s=1 to create it", path, UpdateSnapshotsEnv)
+	}
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	if diff := unifiedDiff(path, "actual", string(expected), actual); diff != "" {
+		t.Errorf("Email does not match snapshot, run the test with %s=1 to accept the change:\n%s", UpdateSnapshotsEnv, diff)
+	}
+}
+
+// RenderSnapshot returns the normalized view of a message used by
+// MatchSnapshot: headers, the plain part, pretty-printed HTML and the
+// attachment manifest, with volatile values redacted
+func RenderSnapshot(msg *sendria.Message, opts ...SnapshotOption) (string, error) {
+	return renderSnapshot(msg, newSnapshotConfig(opts))
+}
+
+func renderSnapshot(msg *sendria.Message, cfg *snapshotConfig) (string, error) {
+	if msg.Source == "" {
+		return "", fmt.Errorf("message %s has no source loaded", msg.ID)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.Source))
+	if err != nil {
+		return "", fmt.Errorf("parsing message: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("== Headers ==\n")
+	names := make([]string, 0, len(parsed.Header))
+	for name := range parsed.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if cfg.skipHeaders[key] {
+			continue
+		}
+		for _, value := range parsed.Header[name] {
+			if cfg.headers[key] {
+				value = "<redacted>"
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+
+	if plain := partBody(msg, "text/plain"); plain != "" {
+		b.WriteString("\n== Plain ==\n")
+		b.WriteString(normalizeNewlines(plain))
+	}
+
+	if html := partBody(msg, "text/html"); html != "" {
+		b.WriteString("\n== HTML ==\n")
+		b.WriteString(prettyHTML(html))
+	}
+
+	if attachments := msg.GetAttachments(); len(attachments) > 0 {
+		b.WriteString("\n== Attachments ==\n")
+		for _, att := range attachments {
+			fmt.Fprintf(&b, "%s\t%s\t%d bytes", att.Filename, att.Type, att.Size)
+			if att.CID != "" {
+				fmt.Fprintf(&b, "\tcid:%s", att.CID)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	out := b.String()
+	for _, r := range cfg.redactions {
+		out = r.Pattern.ReplaceAllString(out, r.Replacement)
+	}
+	return out, nil
+}
+
+// shouldUpdateSnapshots reports whether golden files should be rewritten
+func shouldUpdateSnapshots() bool {
+	if os.Getenv(UpdateSnapshotsEnv) == "1" {
+		return true
+	}
+	// The package is a library, so it only reads an -update flag defined by
+	// the test binary
+	if f := flag.Lookup("update"); f != nil {
+		return f.Value.String() == "true"
+	}
+	return false
+}
+
+// snapshotFileName turns a test name into a golden file name
+func snapshotFileName(name string) string {
+	return sanitizeFileName(name) + ".golden"
+}
+
+// sanitizeFileName replaces characters that are unsafe in file names
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// normalizeNewlines converts CRLF line endings and ensures a final newline
+func normalizeNewlines(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+var (
+	// htmlTokenPattern splits HTML into tags and text
+	htmlTokenPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>|[^<]+`)
+	// htmlTagNamePattern extracts the name of a tag
+	htmlTagNamePattern = regexp.MustCompile(`^</?\s*([a-zA-Z0-9]+)`)
+	// htmlSpacePattern matches runs of whitespace
+	htmlSpacePattern = regexp.MustCompile(`\s+`)
+)
+
+// htmlVoidElements never have a closing tag
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// prettyHTML puts every tag and text run on its own indented line, so that
+// snapshot diffs point at the changed element
+func prettyHTML(html string) string {
+	var b strings.Builder
+	depth := 0
+	for _, token := range htmlTokenPattern.FindAllString(html, -1) {
+		token = strings.TrimSpace(htmlSpacePattern.ReplaceAllString(token, " "))
+		if token == "" {
+			continue
+		}
+
+		closing := strings.HasPrefix(token, "</")
+		opening := !closing && strings.HasPrefix(token, "<") &&
+			!strings.HasPrefix(token, "<!") && !strings.HasSuffix(token, "/>")
+		if opening {
+			if m := htmlTagNamePattern.FindStringSubmatch(token); m != nil && htmlVoidElements[strings.ToLower(m[1])] {
+				opening = false
+			}
+		}
+
+		if closing && depth > 0 {
+			depth--
+		}
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(token)
+		b.WriteString("\n")
+		if opening {
+			depth++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package testhelpers
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enthus-golang/sendria"
+)
+
+func snapshotMessage() *sendria.Message {
+	subject, body := CreateTestEmail("Snapshot")
+	source := "From: noreply@example.com\r\n" +
+		"To: a@example.com\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+		"Message-ID: <1136214245.42@example.com>\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"abc123\"\r\n" +
+		"\r\n"
+	return &sendria.Message{
+		ID:      "1",
+		Subject: subject,
+		Source:  source,
+		Parts: []sendria.Part{
+			{Type: "text/plain", Body: body + "\r\nVerify: https://example.com/verify?token=s3cr3t\r\n"},
+			{Type: "text/html", Body: `<html><body><h1>Hello</h1><p>Click <a href="https://example.com/verify?token=s3cr3t">here</a><br></p></body></html>`},
+		},
+		Attachments: []sendria.Attachment{
+			{Filename: "invoice.pdf", Type: "application/pdf", Size: 1024},
+		},
+	}
+}
+
+func TestMatchSnapshot(t *testing.T) {
+	MatchSnapshot(t, snapshotMessage())
+}
+
+func TestMatchSnapshotUpdateEnv(t *testing.T) {
+	if flag.Lookup("update") != nil {
+		t.Fatal("testhelpers must not register an -update flag")
+	}
+
+	dir := t.TempDir()
+	t.Setenv(UpdateSnapshotsEnv, "1")
+	MatchSnapshot(t, snapshotMessage(), SnapshotDir(dir), SnapshotName("updated"))
+
+	written, err := os.ReadFile(filepath.Join(dir, snapshotFileName("updated")))
+	if err != nil {
+		t.Fatalf("expected the snapshot to be written: %v", err)
+	}
+	if !strings.Contains(string(written), "Subject: ") {
+		t.Errorf("unexpected snapshot %q", written)
+	}
+}
+
+func TestRenderSnapshotRedactions(t *testing.T) {
+	t.Parallel()
+
+	out, err := RenderSnapshot(snapshotMessage(),
+		RedactHeaders("From"),
+		SkipHeaders("To"),
+		RedactPattern(`Hello`, `<greeting>`),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"Date: <redacted>",
+		"From: <redacted>",
+		`boundary="<boundary>"`,
+		"Test Email - Snapshot - <timestamp>",
+		"verify?token=<token>",
+		"    <greeting>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("snapshot missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "To:") {
+		t.Errorf("expected To header to be skipped:\n%s", out)
+	}
+
+	out, err = RenderSnapshot(snapshotMessage(), WithoutDefaultRedactions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "token=s3cr3t") {
+		t.Errorf("expected token to be kept without default redactions:\n%s", out)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\n"
+
+	want := `--- golden
++++ actual
+@@ -1,10 +1,11 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if got := unifiedDiff("golden", "actual", from, to); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+	if got := unifiedDiff("golden", "actual", from, from); got != "" {
+		t.Errorf("expected no diff, got:\n%s", got)
+	}
+}
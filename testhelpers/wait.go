@@ -0,0 +1,171 @@
+package testhelpers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// WaitTimeoutEnv names the environment variable that overrides the default
+// wait timeout, e.g. SENDRIA_WAIT_TIMEOUT=30s on slow CI runners
+const WaitTimeoutEnv = "SENDRIA_WAIT_TIMEOUT"
+
+// Default waiting behaviour of an Inbox
+const (
+	DefaultWaitTimeout     = 10 * time.Second
+	DefaultMinPollInterval = 25 * time.Millisecond
+	DefaultMaxPollInterval = time.Second
+)
+
+// errWaitTimeout is returned by wait when the deadline passes
+var errWaitTimeout = errors.New("wait timeout")
+
+// Clock abstracts time for the waiting helpers, so tests of the helpers
+// themselves do not depend on the wall clock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Notifier pushes events whenever the captured messages change.
+// *sendria.Client implements it through the Sendria WebSocket.
+type Notifier interface {
+	Subscribe(ctx context.Context) (<-chan sendria.Event, error)
+}
+
+// InboxOption is a functional option for configuring an Inbox
+type InboxOption func(*Inbox)
+
+// WithClock sets the clock used for timeouts and polling
+func WithClock(clock Clock) InboxOption {
+	return func(i *Inbox) {
+		i.clock = clock
+	}
+}
+
+// WithWaitTimeout sets the timeout of waits that do not specify one
+func WithWaitTimeout(timeout time.Duration) InboxOption {
+	return func(i *Inbox) {
+		i.timeout = timeout
+	}
+}
+
+// WithPollInterval sets the bounds of the adaptive polling backoff. Polling
+// starts at minInterval and doubles up to maxInterval while nothing changes.
+func WithPollInterval(minInterval, maxInterval time.Duration) InboxOption {
+	return func(i *Inbox) {
+		i.minPoll = minInterval
+		i.maxPoll = maxInterval
+	}
+}
+
+// WithNotifier sets the push source that wakes up waits. A nil notifier
+// disables push notifications and relies on polling only.
+func WithNotifier(notifier Notifier) InboxOption {
+	return func(i *Inbox) {
+		i.notifier = notifier
+	}
+}
+
+// envWaitTimeout returns the timeout configured through WaitTimeoutEnv
+func envWaitTimeout() (time.Duration, bool) {
+	value := os.Getenv(WaitTimeoutEnv)
+	if value == "" {
+		return 0, false
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, false
+	}
+	return timeout, true
+}
+
+// deadline returns the clock deadline for a timeout, falling back to the
+// inbox default for non-positive values
+func (i *Inbox) deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		timeout = i.timeout
+	}
+	return i.clock.Now().Add(timeout)
+}
+
+// subscribe opens the push source. If the server does not support it, the
+// inbox falls back to polling for all further waits.
+func (i *Inbox) subscribe(ctx context.Context) <-chan sendria.Event {
+	if i.notifier == nil || i.pushUnavailable.Load() {
+		return nil
+	}
+
+	events, err := i.notifier.Subscribe(ctx)
+	if err != nil {
+		i.logger.InfoContext(ctx, "push events unavailable, falling back to polling", slog.String("error", err.Error()))
+		i.pushUnavailable.Store(true)
+		return nil
+	}
+	return events
+}
+
+// wait calls check until it reports done, the context ends or the deadline
+// passes. It wakes up on push events and otherwise polls with exponential
+// backoff between the inbox poll bounds, capped at maxInterval if positive.
+// The pushed argument tells check whether an event caused the wake-up.
+func (i *Inbox) wait(ctx context.Context, deadline time.Time, maxInterval time.Duration, check func(ctx context.Context, pushed bool) (bool, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxPoll := i.maxPoll
+	if maxInterval > 0 && maxInterval < maxPoll {
+		maxPoll = maxInterval
+	}
+
+	events := i.subscribe(ctx)
+	interval := i.minPoll
+	pushed := false
+	for attempt := 1; ; attempt++ {
+		done, err := check(ctx, pushed)
+		if err != nil || done {
+			return err
+		}
+
+		delay := interval
+		remaining := deadline.Sub(i.clock.Now())
+		if remaining <= 0 {
+			return errWaitTimeout
+		}
+		if remaining < delay {
+			delay = remaining
+		}
+
+		i.logger.DebugContext(ctx, "condition not met, retrying",
+			slog.Int("attempt", attempt), slog.Duration("delay", delay))
+
+		pushed = false
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-events:
+			if !ok {
+				// The push source broke, keep polling
+				events = nil
+				continue
+			}
+			pushed = true
+			interval = i.minPoll
+		case <-i.clock.After(delay):
+			interval *= 2
+			if interval > maxPoll {
+				interval = maxPoll
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package testhelpers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enthus-golang/sendria"
+)
+
+// fakeClock advances instantly whenever a wait sleeps and records the delays
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	delays  []time.Duration
+	onSleep func(n int)
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.delays = append(c.delays, d)
+	n, now, onSleep := len(c.delays), c.now, c.onSleep
+	c.mu.Unlock()
+
+	if onSleep != nil {
+		onSleep(n)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- now
+	return ch
+}
+
+// chanNotifier pushes the events sent on its channel
+type chanNotifier chan sendria.Event
+
+func (n chanNotifier) Subscribe(ctx context.Context) (<-chan sendria.Event, error) {
+	return n, nil
+}
+
+// failingNotifier reports that push notifications are unavailable
+type failingNotifier struct{ calls int }
+
+func (n *failingNotifier) Subscribe(ctx context.Context) (<-chan sendria.Event, error) {
+	n.calls++
+	return nil, errors.New("websocket not supported")
+}
+
+func TestWaitBacksOff(t *testing.T) {
+	fake := newFakeSendria(t)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithClock(clock), WithNotifier(nil),
+		WithPollInterval(100*time.Millisecond, 800*time.Millisecond))
+
+	_, err := inbox.WaitForEmails(1, 3*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	ms := time.Millisecond
+	expected := []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 800 * ms, 700 * ms}
+	if !reflect.DeepEqual(clock.delays, expected) {
+		t.Errorf("expected delays %v, got %v", expected, clock.delays)
+	}
+}
+
+func TestWaitWakesOnPush(t *testing.T) {
+	fake := newFakeSendria(t)
+	events := make(chanNotifier, 1)
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithNotifier(events),
+		WithPollInterval(time.Hour, time.Hour))
+
+	added := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		id, err := fake.Store(testEmail("noreply@example.com", "a@example.com", "Pushed", nil, "Hello", ""))
+		added <- err
+		if err == nil {
+			events <- sendria.Event{Type: sendria.EventAddMessage, MessageID: id}
+		}
+	}()
+
+	start := time.Now()
+	_, err := inbox.WaitFor(time.Minute, Subject("Pushed"))
+	if addErr := <-added; addErr != nil {
+		t.Fatalf("failed to add message: %v", addErr)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected push wake-up, waited %s", elapsed)
+	}
+}
+
+func TestWaitFallsBackToPolling(t *testing.T) {
+	fake := newFakeSendria(t)
+	notifier := &failingNotifier{}
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithNotifier(notifier),
+		WithPollInterval(5*time.Millisecond, 20*time.Millisecond))
+
+	fake.AddLater(t, 50*time.Millisecond, testEmail("noreply@example.com", "a@example.com", "Polled", nil, "Hello", ""))
+	for i := 0; i < 2; i++ {
+		if _, err := inbox.WaitFor(5*time.Second, Subject("Polled")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if notifier.calls != 1 {
+		t.Errorf("expected one subscribe attempt, got %d", notifier.calls)
+	}
+}
+
+func TestWaitHonoursContext(t *testing.T) {
+	fake := newFakeSendria(t)
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithNotifier(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := inbox.WaitForContext(ctx, Subject("Never"))
+	var matchErr *MatchError
+	if !errors.As(err, &matchErr) {
+		t.Fatalf("expected match error, got %v", err)
+	}
+}
+
+func TestWaitForQuiescence(t *testing.T) {
+	fake := newFakeSendria(t)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	clock.onSleep = func(n int) {
+		// Two more messages trickle in while waiting
+		if n <= 2 {
+			fake.Add(t, testEmail("noreply@example.com", "a@example.com", "Batch", nil, "Hello", ""))
+		}
+	}
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithClock(clock), WithNotifier(nil),
+		WithPollInterval(100*time.Millisecond, time.Second))
+	fake.Add(t, testEmail("noreply@example.com", "a@example.com", "Batch", nil, "Hello", ""))
+
+	start := clock.Now()
+	messages, err := inbox.WaitForQuiescence(context.Background(), 500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("expected 3 messages, got %d", len(messages))
+	}
+	// Polling is capped at a quarter of the quiet period, so the last message
+	// arrives after 100ms+125ms and must be followed by 500ms of quiet
+	if elapsed := clock.Now().Sub(start); elapsed < 725*time.Millisecond {
+		t.Errorf("expected to wait for quiet after the last message, waited %s", elapsed)
+	}
+}
+
+func TestCheckNoEmailsFailsEarly(t *testing.T) {
+	fake := newFakeSendria(t)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	clock.onSleep = func(n int) {
+		if n == 1 {
+			fake.Add(t, testEmail("noreply@example.com", "a@example.com", "Unexpected", nil, "Hello", ""))
+		}
+	}
+	inbox := NewInbox(sendria.NewClient(fake.URL), WithClock(clock), WithNotifier(nil))
+
+	err := inbox.CheckNoEmails(time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "Unexpected") {
+		t.Fatalf("expected error naming the unexpected email, got %v", err)
+	}
+	if len(clock.delays) > 2 {
+		t.Errorf("expected to fail right after the email arrived, slept %d times", len(clock.delays))
+	}
+}